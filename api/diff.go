@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/zalando/chimp/backend"
+	. "github.com/zalando/chimp/types"
+)
+
+//isDryRun returns true if the request asks only to show the changes, without applying them
+func isDryRun(ginCtx *gin.Context) bool {
+	return ginCtx.Query("dryRun") == "true"
+}
+
+//deployDryRun answers with the changes that a validated request would make to the app currently deployed.
+//The secrets are compared by reference, they are not resolved.
+func deployDryRun(ginCtx *gin.Context, requested *BaseRequest) {
+	result := &DiffResult{Name: requested.Name}
+	var current *BaseRequest
+	artifact, err := se.Backend.GetApp(&ArtifactRequest{Action: INFO, Name: requested.Name, Caller: requested.Caller})
+	if err != nil && !backend.IsAppNotFound(err) {
+		//the app may exist, it must not be shown as new
+		glog.Errorf("Could not get the current state of %s, caused by: %s", requested.Name, err.Error())
+		ginCtx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	if err == nil {
+		result.Exists = true
+		maskSecrets(artifact)
+		current, err = buildBaseRequest(deployRequestOf(requested.Name, artifact))
+		if err != nil {
+			glog.Errorf("Could not read the current state of %s, caused by: %s", requested.Name, err.Error())
+			ginCtx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			ginCtx.Error(err)
+			return
+		}
+	}
+	result.Changes, err = diffRequests(current, requested)
+	if err != nil {
+		glog.Errorf("Could not compare the state of %s, caused by: %s", requested.Name, err.Error())
+		ginCtx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	ginCtx.JSON(http.StatusOK, result)
+}
+
+//diffRequests compares two requests field by field, the settings of nested objects like env and labels
+//are compared one by one. Current can be nil if the app does not exist. The settings the requested app
+//leaves unset are not compared: the current app has the defaults of the backend there.
+func diffRequests(current, requested *BaseRequest) ([]*FieldChange, error) {
+	requestedDoc, err := requestDoc(requested)
+	if err != nil {
+		return nil, err
+	}
+	currentFields := map[string]string{}
+	if current != nil {
+		currentDoc, err := requestDoc(current)
+		if err != nil {
+			return nil, err
+		}
+		withoutDefaults(currentDoc, requestedDoc, reflect.TypeOf(*requested))
+		if currentFields, err = flattenDoc(currentDoc); err != nil {
+			return nil, err
+		}
+	}
+	requestedFields, err := flattenDoc(requestedDoc)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*FieldChange, 0)
+	for field, value := range requestedFields {
+		currentValue, exists := currentFields[field]
+		if !exists {
+			changes = append(changes, &FieldChange{Field: field, Action: DiffAdded, Requested: value})
+		} else if currentValue != value {
+			changes = append(changes, &FieldChange{Field: field, Action: DiffChanged, Current: currentValue, Requested: value})
+		}
+	}
+	for field, value := range currentFields {
+		if _, exists := requestedFields[field]; !exists {
+			changes = append(changes, &FieldChange{Field: field, Action: DiffRemoved, Current: value})
+		}
+	}
+	sort.Sort(byField(changes))
+	return changes, nil
+}
+
+//requestDoc returns a request as a JSON document. The force flag and the labels set by chimp are not settings.
+func requestDoc(req *BaseRequest) (map[string]interface{}, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "force")
+	if labels, ok := doc["labels"].(map[string]interface{}); ok {
+		delete(labels, secretsLabel)
+		delete(labels, "user") //who deployed last, not a setting of the app
+		if labels["team"] == "" {
+			delete(labels, "team") //without oauth2 apps have no owner
+		}
+	}
+	return doc, nil
+}
+
+//withoutDefaults removes from the current document of the given struct type the settings the requested one leaves
+//unset, p.e. the CPUs, the service ports or the update strategy, which the backend fills with its defaults.
+//The settings of the elements of lists, like the ports, are removed one by one. Lists and maps, like env, are
+//not settings left unset: their entries are compared as they are, so that removed ones are found.
+func withoutDefaults(current, requested map[string]interface{}, structType reflect.Type) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		switch fieldType.Kind() {
+		case reflect.Map:
+		case reflect.Slice:
+			elemType := fieldType.Elem()
+			for elemType.Kind() == reflect.Ptr {
+				elemType = elemType.Elem()
+			}
+			if elemType.Kind() != reflect.Struct {
+				continue
+			}
+			currentList, _ := current[name].([]interface{})
+			requestedList, _ := requested[name].([]interface{})
+			for i := range currentList {
+				currentElem, currentOk := currentList[i].(map[string]interface{})
+				if i < len(requestedList) && currentOk {
+					if requestedElem, ok := requestedList[i].(map[string]interface{}); ok {
+						withoutDefaults(currentElem, requestedElem, elemType)
+					}
+				}
+				withoutEmpty(currentElem)
+			}
+			for i := range requestedList {
+				if requestedElem, ok := requestedList[i].(map[string]interface{}); ok {
+					withoutEmpty(requestedElem)
+				}
+			}
+		case reflect.Struct:
+			requestedObject, ok := requested[name].(map[string]interface{})
+			currentObject, currentOk := current[name].(map[string]interface{})
+			if !ok {
+				delete(current, name)
+			} else if currentOk {
+				withoutDefaults(currentObject, requestedObject, fieldType)
+			}
+		default:
+			//a pointer is unset only when missing, zero can be a setting
+			if value := requested[name]; value == nil || (field.Type.Kind() != reflect.Ptr && isEmpty(value)) {
+				delete(current, name)
+			}
+		}
+	}
+}
+
+//withoutEmpty removes the empty settings of an object, so that p.e. a port without and with a zero host port are the same
+func withoutEmpty(object map[string]interface{}) {
+	for key, value := range object {
+		if isEmpty(value) {
+			delete(object, key)
+		}
+	}
+}
+
+//flattenDoc maps every setting of a request document to its value as JSON. Empty settings are left out, so that
+//p.e. a missing and an empty env are the same.
+func flattenDoc(doc map[string]interface{}) (map[string]string, error) {
+	var err error
+	fields := make(map[string]string)
+	for key, value := range doc {
+		if object, ok := value.(map[string]interface{}); ok && key != "updateStrategy" {
+			for k, v := range object {
+				fields[key+"."+k], _ = jsonString(v)
+			}
+			continue
+		}
+		if isEmpty(value) {
+			continue
+		}
+		if fields[key], err = jsonString(value); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+func jsonString(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+//isEmpty returns true for the JSON zero values
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+type byField []*FieldChange
+
+func (c byField) Len() int           { return len(c) }
+func (c byField) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byField) Less(i, j int) bool { return c[i].Field < c[j].Field }
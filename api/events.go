@@ -0,0 +1,70 @@
+package api
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	. "github.com/zalando/chimp/types"
+)
+
+//eventHub subscribes once to the events of the backend and dispatches them to the clients
+//watching a single app. The subscription starts with the first watcher.
+type eventHub struct {
+	sync.Mutex
+	watchers   map[chan *Event]string //channel of the watcher -> name of the watched app
+	subscribed bool
+}
+
+var hub = eventHub{watchers: make(map[chan *Event]string)}
+
+//watch returns a channel receiving the events of the app with the given name
+func (h *eventHub) watch(name string) (chan *Event, error) {
+	h.Lock()
+	defer h.Unlock()
+	if !h.subscribed {
+		events, err := se.Backend.Events()
+		if err != nil {
+			return nil, err
+		}
+		h.subscribed = true
+		go h.dispatch(events)
+	}
+	ch := make(chan *Event, 16)
+	h.watchers[ch] = normalizeAppName(name)
+	return ch, nil
+}
+
+//unwatch stops sending events to the given channel
+func (h *eventHub) unwatch(ch chan *Event) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.watchers, ch)
+}
+
+func (h *eventHub) dispatch(events <-chan *Event) {
+	for event := range events {
+		app := normalizeAppName(event.App)
+		h.Lock()
+		for ch, name := range h.watchers {
+			if name != app {
+				continue
+			}
+			select {
+			case ch <- event:
+			default:
+				glog.Warningf("Dropping event %s for %s, the watcher is too slow", event.Type, event.App)
+			}
+		}
+		h.Unlock()
+	}
+	//the backend closed the subscription, the next watcher will subscribe again
+	h.Lock()
+	h.subscribed = false
+	h.Unlock()
+}
+
+//normalizeAppName removes the leading slash used by marathon for app IDs
+func normalizeAppName(name string) string {
+	return strings.TrimPrefix(name, "/")
+}
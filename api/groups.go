@@ -0,0 +1,256 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	. "github.com/zalando/chimp/types"
+	"github.com/zalando/chimp/validators"
+)
+
+func groupInfo(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	group := ownedGroup(ginCtx, buildCaller(ginCtx), name, "INFO")
+	if group == nil {
+		return
+	}
+	for _, app := range group.Apps {
+		maskSecrets(app)
+	}
+	ginCtx.JSON(http.StatusOK, group)
+}
+
+func groupCreate(ginCtx *gin.Context) {
+	beReq, err := commonGroup(ginCtx, nil)
+	if err != nil {
+		glog.Errorf("Could not create a group, caused by: %s", err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	beRes, err := se.Backend.DeployGroup(beReq)
+	if err != nil {
+		glog.Errorf("Could not create a group, caused by: %s", err.Error())
+		ginCtx.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	glog.Infof("Deployed group: %s\n", beReq.Name)
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: beReq.Name, DeploymentID: beRes})
+}
+
+func groupUpsert(ginCtx *gin.Context) {
+	current := ownedGroup(ginCtx, buildCaller(ginCtx), ginCtx.Params.ByName("name"), "UPDATE")
+	if current == nil {
+		return
+	}
+	beReq, err := commonGroup(ginCtx, current)
+	if err != nil {
+		glog.Errorf("Could not update group, caused by: %s", err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	if name := ginCtx.Params.ByName("name"); name != beReq.Name {
+		err = fmt.Errorf("group name %s does not match the resource %s", beReq.Name, name)
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	beRes, err := se.Backend.UpdateGroup(beReq)
+	if err != nil {
+		glog.Errorf("Could not update group, caused by: %s", err.Error())
+		ginCtx.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	glog.Infof("Group updated")
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: beReq.Name, DeploymentID: beRes})
+}
+
+func groupDelete(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	glog.Infof("delete group by name: %s", name)
+	caller := buildCaller(ginCtx)
+	if ownedGroup(ginCtx, caller, name, "DELETE") == nil {
+		return
+	}
+	var ar = ArtifactRequest{Action: DELETE, Name: name, Caller: caller}
+	beRes, err := se.Backend.DeleteGroup(&ar)
+	if err != nil {
+		glog.Errorf("Could not delete group %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: name, DeploymentID: beRes})
+}
+
+//groupRollout merges the rollouts of the apps of a group: it is failed if any app failed,
+//in progress if any app is still being deployed and done otherwise.
+func groupRollout(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	caller := buildCaller(ginCtx)
+	group := ownedGroup(ginCtx, caller, name, "ROLLOUT")
+	if group == nil {
+		return
+	}
+	result := &Rollout{Name: group.Name, Status: RolloutDone, Deployments: make([]*RolloutDeployment, 0, 1)}
+	seen := make(map[string]bool)
+	for _, app := range group.Apps {
+		rollout, err := se.Backend.GetRollout(&RolloutRequest{Name: app.Name, DeploymentID: ginCtx.Query("deploymentID"), Caller: caller})
+		if err != nil {
+			glog.Errorf("Could not get rollout from backend for %s, caused by: %s", app.Name, err.Error())
+			ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			ginCtx.Error(err)
+			return
+		}
+		//the deployment of a group affects all its apps, so it is reported once
+		for _, deployment := range rollout.Deployments {
+			if !seen[deployment.ID] {
+				seen[deployment.ID] = true
+				result.Deployments = append(result.Deployments, deployment)
+			}
+		}
+		if rollout.Message != "" {
+			result.Message = fmt.Sprintf("%s: %s", app.Name, rollout.Message)
+		}
+		if rollout.Status == RolloutFailed || (rollout.Status == RolloutInProgress && result.Status == RolloutDone) {
+			result.Status = rollout.Status
+		}
+	}
+	ginCtx.JSON(http.StatusOK, result)
+}
+
+//ownedGroup returns a group if the caller owns all its apps, otherwise it answers with the error and returns nil
+func ownedGroup(ginCtx *gin.Context, caller Caller, name string, action string) *GroupArtifact {
+	group, err := se.Backend.GetGroup(&ArtifactRequest{Action: INFO, Name: name, Caller: caller})
+	if err != nil {
+		glog.Errorf("Could not get group from backend for %s request with name %s, caused by: %s", action, name, err.Error())
+		ginCtx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return nil
+	}
+	for _, app := range group.Apps {
+		if err = checkOwner(caller, app.Name, app); err != nil {
+			glog.Errorf("Could not %s group %s, caused by: %s", strings.ToLower(action), name, err.Error())
+			ginCtx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			ginCtx.Error(err)
+			return nil
+		}
+	}
+	return group
+}
+
+//commonGroup reads and validates a group request, converting it to the request for the backend.
+//The apps are labeled with team and user like single deployments; an admin updating the group
+//of another team, current, leaves its apps to that team.
+func commonGroup(ginCtx *gin.Context, current *GroupArtifact) (*GroupRequest, error) {
+	var givenGroup GroupDeployRequest
+	if err := ginCtx.BindWith(&givenGroup, binding.JSON); err != nil {
+		return nil, err
+	}
+	if err := validateGroup(&givenGroup); err != nil {
+		return nil, err
+	}
+	validator := validators.New()
+	team, uid := buildTeamLabel(ginCtx)
+	caller := buildCaller(ginCtx)
+	owners := make(map[string]string)
+	if current != nil && caller.Admin {
+		for _, app := range current.Apps {
+			if app.Labels != nil {
+				owners[path.Base(app.Name)] = (*app.Labels)["team"] //the apps are named after the group
+			}
+		}
+	}
+	beReq := &GroupRequest{Name: givenGroup.Name, Apps: make([]*BaseRequest, 0, len(givenGroup.Apps))}
+	for i := range givenGroup.Apps {
+		deploy := &givenGroup.Apps[i]
+		if valid, _ := validator.Validate(*deploy); !valid {
+			return nil, errors.New("Invalid request.")
+		}
+		if deploy.Labels == nil {
+			deploy.Labels = make(map[string]string, 2)
+		}
+		deploy.Labels["team"] = team
+		if owners[deploy.Name] != "" {
+			deploy.Labels["team"] = owners[deploy.Name]
+		}
+		deploy.Labels["user"] = uid
+		base, err := buildBaseRequest(deploy)
+		if err != nil {
+			return nil, fmt.Errorf("app %s: %s", deploy.Name, err)
+		}
+		base.Caller = caller
+		if err = resolveSecrets(base, team); err != nil {
+			return nil, fmt.Errorf("app %s: %s", deploy.Name, err)
+		}
+		beReq.Apps = append(beReq.Apps, base)
+	}
+	ginCtx.Set("data", givenGroup)
+	return beReq, nil
+}
+
+//validateGroup checks that the apps of a group have unique names and depend only on other apps of the group,
+//without cycles.
+func validateGroup(group *GroupDeployRequest) error {
+	if group.Name == "" {
+		return errors.New("the group has no name")
+	}
+	if len(group.Apps) == 0 {
+		return fmt.Errorf("group %s has no apps", group.Name)
+	}
+	dependencies := make(map[string][]string, len(group.Apps))
+	for _, app := range group.Apps {
+		if app.Name == "" {
+			return fmt.Errorf("group %s contains an app without name", group.Name)
+		}
+		if _, exists := dependencies[app.Name]; exists {
+			return fmt.Errorf("app %s is defined twice in group %s", app.Name, group.Name)
+		}
+		dependencies[app.Name] = app.Dependencies
+	}
+	for name, deps := range dependencies {
+		for _, dep := range deps {
+			if _, exists := dependencies[dep]; !exists {
+				return fmt.Errorf("app %s depends on %s, which is not part of group %s", name, dep, group.Name)
+			}
+		}
+	}
+	//depth first visit, an app found again on the current path closes a cycle
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(dependencies))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("the dependencies of app %s contain a cycle", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range dependencies[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range dependencies {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
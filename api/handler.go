@@ -3,15 +3,19 @@ package api
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/golang/glog"
 	backend "github.com/zalando/chimp/backend"
 	"github.com/zalando/chimp/conf"
+	"github.com/zalando/chimp/quantity"
+	"github.com/zalando/chimp/secrets"
 	. "github.com/zalando/chimp/types"
 	"github.com/zalando/chimp/validators"
 )
@@ -20,6 +24,7 @@ import (
 type Backend struct {
 	BackendType string
 	Backend     backend.Backend
+	Secrets     secrets.Store //nil if no store is configured
 }
 
 // Bootstrap backend
@@ -29,7 +34,12 @@ var se = Backend{
 
 //Start initializes the current backend
 func Start() {
-	se.Backend = backend.New()
+	se.Backend = backend.NewForType(conf.New().BackendType)
+	store, err := secrets.New(conf.New().Secrets)
+	if err != nil {
+		glog.Errorf("Could not create the secret store, secrets cannot be used. Caused by: %s", err)
+	}
+	se.Secrets = store
 }
 
 //BackendError is the erro representation that should be consumed by "frontend" serving layer
@@ -42,13 +52,31 @@ type BackendError struct {
 
 func rootHandler(ginCtx *gin.Context) {
 	config := conf.New()
-	ginCtx.JSON(http.StatusOK, gin.H{"chimp-server": fmt.Sprintf("Build Time: %s - Git Commit Hash: %s", config.VersionBuildStamp, config.VersionGitHash)})
+	response := gin.H{"chimp-server": fmt.Sprintf("Build Time: %s - Git Commit Hash: %s", config.VersionBuildStamp, config.VersionGitHash)}
+	//the info is returned also if the backend fails, as it tells which endpoints are not reachable
+	info, err := se.Backend.Info()
+	if err != nil {
+		glog.Errorf("Could not get backend info, caused by: %s", err.Error())
+		response["backendError"] = err.Error()
+	}
+	response["backend"] = info
+	ginCtx.JSON(http.StatusOK, response)
 }
 
 func healthHandler(ginCtx *gin.Context) {
 	ginCtx.String(http.StatusOK, "OK")
 }
 
+//readyHandler tells if chimp-server can serve requests, that is if the backend is reachable
+func readyHandler(ginCtx *gin.Context) {
+	if err := se.Backend.Ping(); err != nil {
+		glog.Errorf("Backend is not ready, caused by: %s", err.Error())
+		ginCtx.String(http.StatusServiceUnavailable, fmt.Sprintf("NOT READY: %s", err.Error()))
+		return
+	}
+	ginCtx.String(http.StatusOK, "OK")
+}
+
 //deployList is used to get a list of all the running application
 func deployList(ginCtx *gin.Context) {
 	team, uid := buildTeamLabel(ginCtx)
@@ -56,10 +84,21 @@ func deployList(ginCtx *gin.Context) {
 	var filter map[string]string
 	if all == "" {
 		filter = make(map[string]string, 2)
+		//further labels to match can be given as label=KEY=VALUE, the team cannot be changed
+		for _, label := range ginCtx.Request.URL.Query()["label"] {
+			kv := strings.SplitN(label, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				err := fmt.Errorf("invalid label filter %s, expected KEY=VALUE", label)
+				ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				ginCtx.Error(err)
+				return
+			}
+			filter[kv[0]] = kv[1]
+		}
 		filter["uid"] = uid
 		filter["team"] = team
 	}
-	result, err := se.Backend.GetAppNames(filter)
+	result, err := se.Backend.GetAppNames(buildCaller(ginCtx), filter)
 	if err != nil {
 		glog.Errorf("Could not get artifacts from backend for LIST request, caused by: %s", err.Error())
 		ginCtx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Could not get artifact from backend for INFO, caused by: %s", err)})
@@ -71,13 +110,14 @@ func deployList(ginCtx *gin.Context) {
 func deployInfo(ginCtx *gin.Context) {
 	name := ginCtx.Params.ByName("name")
 	glog.Infof("retrieve info by name: %s", name)
-	var arReq = ArtifactRequest{Action: INFO, Name: name}
+	var arReq = ArtifactRequest{Action: INFO, Name: name, Caller: buildCaller(ginCtx)}
 	result, err := se.Backend.GetApp(&arReq)
 	if err != nil {
 		glog.Errorf("Could not get artifact from backend for INFO request with name %s, caused by: %s", name, err.Error())
 		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Could not get artifact from backend for INFO request with name %s, caused by: %s", name, err)})
 		return
 	}
+	maskSecrets(result)
 	ginCtx.JSON(http.StatusOK, result)
 }
 
@@ -106,22 +146,26 @@ func deployCreate(ginCtx *gin.Context) {
 		return
 	}
 
-	memoryLimit, e := mapMemory(givenDeploy.MemoryLimit)
+	base, e := buildBaseRequest(&givenDeploy)
 	if e != nil {
 		glog.Errorf("Could not create a deploy, caused by: %s", e.Error())
 		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
-		ginCtx.Error(err)
+		ginCtx.Error(e)
 		return
 	}
-
-	volumes := make([]*Volume, len(givenDeploy.Volumes))
-	for i, vol := range givenDeploy.Volumes {
-		volumes[i] = &Volume{HostPath: vol.HostPath, ContainerPath: vol.ContainerPath, Mode: vol.Mode}
+	base.Caller = buildCaller(ginCtx)
+	if isDryRun(ginCtx) {
+		deployDryRun(ginCtx, base)
+		return
+	}
+	if e = resolveSecrets(base, team); e != nil {
+		glog.Errorf("Could not create a deploy, caused by: %s", e.Error())
+		ginCtx.JSON(secretErrorStatus(e), gin.H{"error": e.Error()})
+		ginCtx.Error(e)
+		return
 	}
 
-	var beReq = &CreateRequest{BaseRequest: BaseRequest{
-		Name: givenDeploy.Name, Ports: givenDeploy.Ports, Labels: givenDeploy.Labels, ImageURL: givenDeploy.ImageURL, Env: givenDeploy.Env, Replicas: givenDeploy.Replicas,
-		CPULimit: givenDeploy.CPULimit, MemoryLimit: memoryLimit, Force: givenDeploy.Force, Volumes: volumes}}
+	var beReq = &CreateRequest{BaseRequest: *base}
 	beRes, err := se.Backend.Deploy(beReq)
 	if err != nil {
 		glog.Errorf("Could not create a deploy, caused by: %s", err.Error())
@@ -130,7 +174,7 @@ func deployCreate(ginCtx *gin.Context) {
 		return
 	}
 	glog.Infof("Deployed: %+v\n", beRes)
-	ginCtx.JSON(http.StatusOK, gin.H{"name": beRes})
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: givenDeploy.Name, DeploymentID: beRes})
 }
 
 func deployUpsert(ginCtx *gin.Context) {
@@ -143,26 +187,64 @@ func deployUpsert(ginCtx *gin.Context) {
 		ginCtx.Error(errors.New("Invalid request"))
 		return
 	}
-	ginCtx.Set("data", deploy)
 	if err != nil {
 		glog.Errorf("Could not update deploy, caused by: %s", err.Error())
 		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		ginCtx.Error(err)
 		return
 	}
+	//only the owner of an existing app can update it, an app not found has no owner yet
+	caller := buildCaller(ginCtx)
+	current, err := se.Backend.GetApp(&ArtifactRequest{Action: INFO, Name: deploy.Name, Caller: caller})
+	if err != nil && !backend.IsAppNotFound(err) {
+		glog.Errorf("Could not get artifact from backend for UPDATE request with name %s, caused by: %s", deploy.Name, err.Error())
+		ginCtx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	if err == nil {
+		if err = checkOwner(caller, deploy.Name, current); err != nil {
+			glog.Errorf("Could not update deploy %s, caused by: %s", deploy.Name, err.Error())
+			ginCtx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			ginCtx.Error(err)
+			return
+		}
+	}
+	//an admin updating the app of another team leaves it to that team
+	team, uid := buildTeamLabel(ginCtx)
+	if deploy.Labels == nil {
+		deploy.Labels = make(map[string]string, 2)
+	}
+	deploy.Labels["team"] = team
+	if caller.Admin && current != nil && current.Labels != nil && (*current.Labels)["team"] != "" {
+		deploy.Labels["team"] = (*current.Labels)["team"]
+	}
+	deploy.Labels["user"] = uid
+	ginCtx.Set("data", deploy)
 
-	memoryLimit, err := mapMemory(deploy.MemoryLimit)
+	base, err := buildBaseRequest(&deploy)
 	if err != nil {
-		glog.Errorf("Could not create a deploy, caused by: %s", err.Error())
+		glog.Errorf("Could not update deploy, caused by: %s", err.Error())
 		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		ginCtx.Error(err)
 		return
 	}
+	base.Caller = caller
 
-	var beReq = UpdateRequest{BaseRequest: BaseRequest{Name: deploy.Name, Ports: deploy.Ports, Labels: deploy.Labels, ImageURL: deploy.ImageURL, Env: deploy.Env, Replicas: deploy.Replicas,
-		CPULimit: deploy.CPULimit, MemoryLimit: memoryLimit, Force: deploy.Force}}
+	if isDryRun(ginCtx) {
+		deployDryRun(ginCtx, base)
+		return
+	}
+	if err = resolveSecrets(base, team); err != nil {
+		glog.Errorf("Could not update deploy, caused by: %s", err.Error())
+		ginCtx.JSON(secretErrorStatus(err), gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
 
-	_, err = se.Backend.UpdateDeployment(&beReq)
+	var beReq = UpdateRequest{BaseRequest: *base}
+
+	beRes, err := se.Backend.UpdateDeployment(&beReq)
 	if err != nil {
 		glog.Errorf("Could not update deploy, caused by: %s", err.Error())
 		ginCtx.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
@@ -170,21 +252,21 @@ func deployUpsert(ginCtx *gin.Context) {
 		return
 	}
 	glog.Infof("Deployment updated")
-	ginCtx.JSON(http.StatusOK, gin.H{})
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: deploy.Name, DeploymentID: beRes})
 }
 
 func deployDelete(ginCtx *gin.Context) {
 	name := ginCtx.Params.ByName("name")
 	glog.Info("delete by name: %s", name)
-	var ar = ArtifactRequest{Action: DELETE, Name: name}
-	_, err := se.Backend.Delete(&ar)
+	var ar = ArtifactRequest{Action: DELETE, Name: name, Caller: buildCaller(ginCtx)}
+	beRes, err := se.Backend.Delete(&ar)
 	if err != nil {
 		glog.Errorf("Could not get artifact from backend for CANCEL request with name %s, caused by: %s", name, err.Error())
 		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		ginCtx.Error(err)
 		return
 	}
-	ginCtx.JSON(http.StatusOK, gin.H{})
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: name, DeploymentID: beRes})
 }
 
 func deployReplicasModify(ginCtx *gin.Context) {
@@ -203,51 +285,341 @@ func deployReplicasModify(ginCtx *gin.Context) {
 		ginCtx.Error(err)
 		return
 	}
-	var beReq = &ScaleRequest{Name: name, Replicas: replicas, Force: fs}
+	var beReq = &ScaleRequest{Name: name, Replicas: replicas, Force: fs, Caller: buildCaller(ginCtx)}
 
-	_, err = se.Backend.Scale(beReq)
+	beRes, err := se.Backend.Scale(beReq)
 	if err != nil {
 		glog.Errorf("Could not change instances for %s, caused by: %s", name, err.Error())
 		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		ginCtx.Error(err)
 		return
 	}
-	ginCtx.JSON(http.StatusOK, gin.H{})
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: name, DeploymentID: beRes})
+}
+
+//deployKill kills one replica of an app, or all of them when no replica ID is given.
+//With scale=true the app is scaled down instead of replacing the killed replicas.
+func deployKill(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	replicaID := ginCtx.Params.ByName("replicaID")
+	scale := ginCtx.Query("scale") == "true"
+	glog.Infof("killing replica %q of %s, scale: %t", replicaID, name, scale)
+	var beReq = &KillRequest{Name: name, ReplicaID: replicaID, Scale: scale, Caller: buildCaller(ginCtx)}
+	killed, err := se.Backend.Kill(beReq)
+	if err != nil {
+		glog.Errorf("Could not kill replicas of %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	ginCtx.JSON(http.StatusOK, KillResult{Name: name, Replicas: killed})
+}
+
+func deployVersions(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	var arReq = ArtifactRequest{Action: VERSIONS, Name: name, Caller: buildCaller(ginCtx)}
+	result, err := se.Backend.GetAppVersions(&arReq)
+	if err != nil {
+		glog.Errorf("Could not get versions from backend for %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Could not get versions from backend for %s, caused by: %s", name, err)})
+		return
+	}
+	ginCtx.JSON(http.StatusOK, gin.H{"versions": result})
+}
+
+func deployRollback(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	version := ginCtx.Query("version")
+	glog.Infof("rolling back %s to version %q", name, version)
+	caller := buildCaller(ginCtx)
+	if ownedApp(ginCtx, caller, name, "ROLLBACK") == nil {
+		return
+	}
+	var beReq = &RollbackRequest{Name: name, Version: version, Caller: caller}
+	beRes, err := se.Backend.Rollback(beReq)
+	if err != nil {
+		glog.Errorf("Could not roll back %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: name, DeploymentID: beRes})
+}
+
+func deployRollout(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	var beReq = &RolloutRequest{Name: name, DeploymentID: ginCtx.Query("deploymentID"), Caller: buildCaller(ginCtx)}
+	result, err := se.Backend.GetRollout(beReq)
+	if err != nil {
+		glog.Errorf("Could not get rollout from backend for %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	ginCtx.JSON(http.StatusOK, result)
+}
+
+//deployCancel cancels the deployments in progress for an app. With force=true the app is not rolled back.
+func deployCancel(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	force := ginCtx.Query("force") == "true"
+	glog.Infof("cancelling the rollout of %s, force: %t", name, force)
+	caller := buildCaller(ginCtx)
+	if ownedApp(ginCtx, caller, name, "CANCEL") == nil {
+		return
+	}
+	var beReq = &CancelRequest{Name: name, Force: force, Caller: caller}
+	cancelled, err := se.Backend.CancelRollout(beReq)
+	if err != nil {
+		glog.Errorf("Could not cancel the rollout of %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	ginCtx.JSON(http.StatusOK, CancelResult{Name: name, Deployments: cancelled})
+}
+
+//deployEvents streams the events of an app as server-sent events till the client disconnects.
+//When authentication is enabled only the team owning the app, or an admin, can watch it.
+func deployEvents(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	artifact, err := se.Backend.GetApp(&ArtifactRequest{Action: INFO, Name: name, Caller: buildCaller(ginCtx)})
+	if err != nil {
+		glog.Errorf("Could not get artifact from backend for EVENTS request with name %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err = checkOwner(buildCaller(ginCtx), name, artifact); err != nil {
+		ginCtx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := hub.watch(name)
+	if err != nil {
+		glog.Errorf("Could not subscribe to backend events, caused by: %s", err.Error())
+		ginCtx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer hub.unwatch(events)
+	clientGone := ginCtx.Writer.CloseNotify()
+	ginCtx.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			ginCtx.SSEvent(event.Type, event)
+			return true
+		case <-clientGone:
+			return false
+		}
+	})
 }
 
 func commonDeploy(ginCtx *gin.Context) (DeployRequest, error) {
 	ginCtx.Request.ParseForm()
 	var givenDeploy DeployRequest
 	ginCtx.BindWith(&givenDeploy, binding.JSON)
-	glog.Infof("given %+v", givenDeploy)
+	glog.Infof("given %+v", maskEnv(givenDeploy))
 	return givenDeploy, nil
 }
 
-//TODO this a very hacky implementation of resource handling.
-//A much better implementation is found in "github.com/GoogleCloudPlatform/kubernetes/pkg/api/resource"
-//We do not support this, but we only express in MB because this is the only amount supported by
-//marathon. I (rdifazio) really believe this a limitation in terms  of expressibite, but we keep it
-//simple for now.
-func mapMemory(memory string) (int, error) {
-	re, err := regexp.Compile(`^([0-9]*)(MB|GB){0,1}$`)
+//buildBaseRequest validates a deploy request and converts it to the request for the backend
+func buildBaseRequest(deploy *DeployRequest) (*BaseRequest, error) {
+	cpuLimit, err := quantity.ParseCPU(string(deploy.CPULimit))
+	if err != nil {
+		return nil, err
+	}
+	memoryLimit, err := quantity.ParseMebibytes(string(deploy.MemoryLimit))
 	if err != nil {
-		return 0, err
-	}
-	res := re.FindStringSubmatch(memory)
-	if len(res) == 0 {
-		return 0, errors.New("Memory formatting is wrong")
-	} else if res[2] == "" { //user didn't specify the size, assuming
-		return strconv.Atoi(res[1])
-	} else {
-		val, err := strconv.Atoi(res[1])
-		if res[2] == "GB" {
-			return val * 1000, err
-		} else if res[2] == "MB" {
-			return val, err
-		} else {
-			return 0, errors.New("Memory formatting is wrong")
+		return nil, fmt.Errorf("Memory limit: %s", err)
+	}
+	diskLimit, err := quantity.ParseMebibytes(string(deploy.DiskLimit))
+	if err != nil {
+		return nil, fmt.Errorf("Disk limit: %s", err)
+	}
+	ports, err := buildPorts(deploy.Ports)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateHealthChecks(deploy.HealthChecks, len(deploy.Ports)); err != nil {
+		return nil, err
+	}
+	if err = validateUpdateStrategy(deploy.UpdateStrategy); err != nil {
+		return nil, err
+	}
+	constraints, err := buildConstraints(deploy.Constraints)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateHost(deploy.Host, len(deploy.Ports)); err != nil {
+		return nil, err
+	}
+	volumes := make([]*Volume, len(deploy.Volumes))
+	for i, vol := range deploy.Volumes {
+		volumes[i] = &Volume{HostPath: vol.HostPath, ContainerPath: vol.ContainerPath, Mode: vol.Mode}
+	}
+	return &BaseRequest{Name: deploy.Name, Ports: ports, Labels: deploy.Labels, ImageURL: deploy.ImageURL, Env: deploy.Env,
+		Replicas: deploy.Replicas, CPULimit: cpuLimit, MemoryLimit: memoryLimit, DiskLimit: diskLimit, Force: deploy.Force, Volumes: volumes,
+		HealthChecks: deploy.HealthChecks, UpdateStrategy: deploy.UpdateStrategy, Dependencies: deploy.Dependencies,
+		Constraints: constraints, Host: strings.ToLower(deploy.Host)}, nil
+}
+
+//validateHost checks that the host of an app is a host name, like shop.example.org. An app needs
+//a port to be reached at its host.
+func validateHost(host string, ports int) error {
+	if host == "" {
+		return nil
+	}
+	if ports == 0 {
+		return errors.New("Host: the app needs a port to be reachable at its host")
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") ||
+			strings.IndexFunc(label, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-'
+			}) >= 0 {
+			return fmt.Errorf("Host: %s is not a valid host name", host)
+		}
+	}
+	return nil
+}
+
+//buildPorts checks the ports of a request and sets the default protocol. Names, host ports and
+//service ports must be unique among the ports of the app, when set.
+func buildPorts(ports []Port) ([]Port, error) {
+	result := make([]Port, len(ports))
+	names := make(map[string]bool, len(ports))
+	hostPorts := make(map[int]bool, len(ports))
+	servicePorts := make(map[int]bool, len(ports))
+	for i, port := range ports {
+		protocol := port.ProtocolOrDefault()
+		if protocol != PortProtocolTCP && protocol != PortProtocolUDP {
+			return nil, fmt.Errorf("Port %d: protocol must be %s or %s", i, PortProtocolTCP, PortProtocolUDP)
+		}
+		if port.ContainerPort < 1 || port.ContainerPort > 65535 {
+			return nil, fmt.Errorf("Port %d: container port %d is out of range", i, port.ContainerPort)
+		}
+		if port.HostPort < 0 || port.HostPort > 65535 || port.ServicePort < 0 || port.ServicePort > 65535 {
+			return nil, fmt.Errorf("Port %d: host and service ports must be between 0 and 65535", i)
+		}
+		if port.Name != "" {
+			if names[port.Name] {
+				return nil, fmt.Errorf("Port %d: name %s is used twice", i, port.Name)
+			}
+			names[port.Name] = true
+		}
+		if port.HostPort != 0 {
+			if hostPorts[port.HostPort] {
+				return nil, fmt.Errorf("Port %d: host port %d is used twice", i, port.HostPort)
+			}
+			hostPorts[port.HostPort] = true
+		}
+		if port.ServicePort != 0 {
+			if servicePorts[port.ServicePort] {
+				return nil, fmt.Errorf("Port %d: service port %d is used twice", i, port.ServicePort)
+			}
+			servicePorts[port.ServicePort] = true
+		}
+		port.Protocol = protocol
+		result[i] = port
+	}
+	return result, nil
+}
+
+//buildConstraints checks the placement constraints of a request, the operator is case insensitive.
+//UNIQUE takes no value, LIKE and UNLIKE need a regular expression and GROUP_BY an optional number of groups.
+func buildConstraints(constraints []*Constraint) ([]*Constraint, error) {
+	result := make([]*Constraint, 0, len(constraints))
+	for i, c := range constraints {
+		if c == nil || c.Field == "" {
+			return nil, fmt.Errorf("Constraint %d has no field", i)
+		}
+		operator := strings.ToUpper(c.Operator)
+		switch operator {
+		case ConstraintUnique:
+			if c.Value != "" {
+				return nil, fmt.Errorf("Constraint %d: %s takes no value", i, operator)
+			}
+		case ConstraintCluster:
+		case ConstraintGroupBy:
+			if c.Value != "" {
+				if groups, err := strconv.Atoi(c.Value); err != nil || groups < 1 {
+					return nil, fmt.Errorf("Constraint %d: the value of %s must be a positive number", i, operator)
+				}
+			}
+		case ConstraintLike, ConstraintUnlike:
+			if c.Value == "" {
+				return nil, fmt.Errorf("Constraint %d: %s needs a regular expression as value", i, operator)
+			}
+			if _, err := regexp.Compile(c.Value); err != nil {
+				return nil, fmt.Errorf("Constraint %d: invalid regular expression %s, caused by: %s", i, c.Value, err)
+			}
+		default:
+			return nil, fmt.Errorf("Constraint %d: operator must be one of %s, %s, %s, %s or %s", i,
+				ConstraintUnique, ConstraintCluster, ConstraintGroupBy, ConstraintLike, ConstraintUnlike)
+		}
+		result = append(result, &Constraint{Field: c.Field, Operator: operator, Value: c.Value})
+	}
+	return result, nil
+}
+
+//validateHealthChecks checks that the health checks can be understood by any backend.
+//HTTP and TCP checks must refer to one of the numPorts ports of the app.
+func validateHealthChecks(checks []*HealthCheck, numPorts int) error {
+	for i, check := range checks {
+		if check == nil {
+			return fmt.Errorf("Health check %d is empty", i)
+		}
+		switch strings.ToUpper(check.Protocol) {
+		case HealthCheckHTTP:
+			if !strings.HasPrefix(check.Path, "/") {
+				return fmt.Errorf("Health check %d: HTTP health checks need a path starting with /", i)
+			}
+		case HealthCheckTCP:
+		case HealthCheckCommand:
+			if check.Command == "" {
+				return fmt.Errorf("Health check %d: COMMAND health checks need a command", i)
+			}
+		default:
+			return fmt.Errorf("Health check %d: protocol must be one of %s, %s or %s", i, HealthCheckHTTP, HealthCheckTCP, HealthCheckCommand)
+		}
+		if check.PortIndex < 0 || check.IntervalSeconds < 0 || check.GracePeriodSeconds < 0 || check.MaxConsecutiveFailures < 0 {
+			return fmt.Errorf("Health check %d: port index, interval, grace period and max failures cannot be negative", i)
+		}
+		if strings.ToUpper(check.Protocol) != HealthCheckCommand && check.PortIndex >= numPorts {
+			return fmt.Errorf("Health check %d: port index %d is out of range, the app has %d ports", i, check.PortIndex, numPorts)
 		}
 	}
+	return nil
+}
+
+//capacities used by the backend for the ones not given in an update strategy, like marathon does
+const (
+	defaultMinimumHealthyCapacity = 1.0
+	defaultMaximumOverCapacity    = 1.0
+)
+
+//validateUpdateStrategy checks that both capacities are fractions between 0.0 and 1.0.
+//An empty strategy is valid, the backend default is used for the capacities not given,
+//so the combination is checked with the defaults filled in.
+func validateUpdateStrategy(strategy *UpdateStrategy) error {
+	if strategy == nil {
+		return nil
+	}
+	minimum, over := defaultMinimumHealthyCapacity, defaultMaximumOverCapacity
+	if strategy.MinimumHealthyCapacity != nil {
+		minimum = *strategy.MinimumHealthyCapacity
+	}
+	if strategy.MaximumOverCapacity != nil {
+		over = *strategy.MaximumOverCapacity
+	}
+	if minimum < 0 || minimum > 1 {
+		return fmt.Errorf("Update strategy: minimum healthy capacity must be between 0.0 and 1.0, got %g", minimum)
+	}
+	if over < 0 || over > 1 {
+		return fmt.Errorf("Update strategy: maximum over capacity must be between 0.0 and 1.0, got %g", over)
+	}
+	if minimum == 1 && over == 0 {
+		return errors.New("Update strategy: with a minimum healthy capacity of 1.0 the maximum over capacity must be greater than 0.0, or no replica can be replaced")
+	}
+	return nil
 }
 
 func buildTeamLabel(ginCtx *gin.Context) (string, string) {
@@ -258,3 +630,49 @@ func buildTeamLabel(ginCtx *gin.Context) (string, string) {
 	}
 	return "", ""
 }
+
+//checkOwner checks that an app belongs to the team of the caller when authentication is enabled.
+//Admins can manage the apps of every team.
+func checkOwner(caller Caller, name string, artifact *Artifact) error {
+	if caller.Team == "" || caller.Admin {
+		return nil
+	}
+	if artifact.Labels == nil || (*artifact.Labels)["team"] != caller.Team {
+		return fmt.Errorf("Application %s does not belong to team %s", name, caller.Team)
+	}
+	return nil
+}
+
+//ownedApp returns an app if the caller owns it, otherwise it answers with the error and returns nil
+func ownedApp(ginCtx *gin.Context, caller Caller, name string, action string) *Artifact {
+	artifact, err := se.Backend.GetApp(&ArtifactRequest{Action: INFO, Name: name, Caller: caller})
+	if err != nil {
+		glog.Errorf("Could not get artifact from backend for %s request with name %s, caused by: %s", action, name, err.Error())
+		status := http.StatusInternalServerError
+		if backend.IsAppNotFound(err) {
+			status = http.StatusNotFound
+		}
+		ginCtx.JSON(status, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return nil
+	}
+	if err = checkOwner(caller, name, artifact); err != nil {
+		glog.Errorf("Could not %s %s, caused by: %s", strings.ToLower(action), name, err.Error())
+		ginCtx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return nil
+	}
+	return artifact
+}
+
+//buildCaller returns who sends the request to the backend, an admin if the team is one of the AdminTeams
+func buildCaller(ginCtx *gin.Context) Caller {
+	team, _ := buildTeamLabel(ginCtx)
+	caller := Caller{Team: team}
+	for _, admin := range conf.New().AdminTeams {
+		if team != "" && admin == team {
+			caller.Admin = true
+		}
+	}
+	return caller
+}
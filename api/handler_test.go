@@ -2,45 +2,53 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zalando/chimp/backend"
+	"github.com/zalando/chimp/conf"
+	"github.com/zalando/chimp/secrets"
+	. "github.com/zalando/chimp/types"
 )
 
 func init() {
 	Start()
+	//the tests run with the simulation backend, fake-cat is the app they read and change
+	se.Backend.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "fake-cat", ImageURL: "pierone.test.techmonkeys/cat:1", Replicas: 1,
+		CPULimit: 1, MemoryLimit: 2048, Ports: []Port{{ContainerPort: 8080, Protocol: PortProtocolTCP}}}})
 }
 
-func TestMapMemory(t *testing.T) {
-	expected := 2048
-	val, err := mapMemory("2048MB")
+func TestBuildBaseRequestResources(t *testing.T) {
+	base, err := buildBaseRequest(&DeployRequest{Name: "app", CPULimit: "250m", MemoryLimit: "2GB", DiskLimit: "10Gi"})
 	if err != nil {
-		fmt.Printf(err.Error())
-		t.FailNow()
+		t.Fatal(err)
 	}
-	if val != expected {
-		fmt.Printf("Expected: %v, got: %v\n", expected, val)
-		t.FailNow()
+	if base.CPULimit != 0.25 || base.MemoryLimit != 2048 || base.DiskLimit != 10240 {
+		t.Errorf("Unexpected resources %v CPUs, %v MiB memory, %v MiB disk", base.CPULimit, base.MemoryLimit, base.DiskLimit)
 	}
-	val, err = mapMemory("2048")
-	if err != nil {
-		fmt.Printf(err.Error())
-		t.FailNow()
+	var deploy DeployRequest
+	if err = json.Unmarshal([]byte(`{"CPULimit": 1.5, "MemoryLimit": 2048}`), &deploy); err != nil {
+		t.Fatal(err)
 	}
-	if val != expected {
-		fmt.Printf("Expected: %v, got: %v\n", expected, val)
-		t.FailNow()
+	if base, err = buildBaseRequest(&deploy); err != nil || base.CPULimit != 1.5 || base.MemoryLimit != 2048 {
+		t.Errorf("Unexpected resources from numbers %+v, error %v", base, err)
 	}
-	val, err = mapMemory("2GB")
-	if err != nil {
-		fmt.Printf(err.Error())
-		t.FailNow()
-	}
-	if val != 2000 {
-		fmt.Printf("Expected: %v, got: %v\n", 2000, val)
-		t.FailNow()
+	invalid := []DeployRequest{{CPULimit: "two"}, {CPULimit: "1Gi"}, {MemoryLimit: "12XB"}, {DiskLimit: "-1Gi"}}
+	for i, deploy := range invalid {
+		if _, err := buildBaseRequest(&deploy); err == nil {
+			t.Errorf("Request %d should be invalid", i)
+		}
 	}
 }
 
@@ -57,6 +65,23 @@ func TestBuildTeamLabel(t *testing.T) {
 	}
 }
 
+func TestBuildCaller(t *testing.T) {
+	config := conf.New()
+	defer func(adminTeams []string) { config.AdminTeams = adminTeams }(config.AdminTeams)
+	config.AdminTeams = []string{"ops"}
+	for team, admin := range map[string]bool{"ops": true, "tm": false} {
+		fakeContext := gin.Context{}
+		fakeContext.Set("uid", "someone")
+		fakeContext.Set("team", team)
+		if caller := buildCaller(&fakeContext); caller.Team != team || caller.Admin != admin {
+			t.Errorf("Expected team %s to be admin: %t, got %+v", team, admin, caller)
+		}
+	}
+	if caller := buildCaller(&gin.Context{}); caller.Team != "" || caller.Admin {
+		t.Errorf("Expected no team without authentication, got %+v", caller)
+	}
+}
+
 func TestCommonDeploy(t *testing.T) {
 	fakeContext := gin.Context{}
 	fakeContext.Request, _ = http.NewRequest("POST", "/", bytes.NewBufferString(
@@ -69,12 +94,776 @@ func TestCommonDeploy(t *testing.T) {
 		fmt.Println("NAME doesn't match, GOT " + deployReq.Name)
 		t.FailNow()
 	}
-	if deployReq.Ports[0] != 8080 {
+	if deployReq.Ports[0].ContainerPort != 8080 {
 		fmt.Println()
 		t.FailNow()
 	}
 }
 
+func TestBuildPorts(t *testing.T) {
+	var deploy DeployRequest
+	err := json.Unmarshal([]byte(`{"Ports": [8080, {"ContainerPort": 53, "Protocol": "UDP", "Name": "dns", "HostPort": 53}]}`), &deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports, err := buildPorts(deploy.Ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ports[0] != (Port{ContainerPort: 8080, Protocol: PortProtocolTCP}) {
+		t.Errorf("Unexpected plain port %+v", ports[0])
+	}
+	if ports[1] != (Port{ContainerPort: 53, Protocol: PortProtocolUDP, Name: "dns", HostPort: 53}) {
+		t.Errorf("Unexpected udp port %+v", ports[1])
+	}
+	invalid := [][]Port{
+		{{ContainerPort: 80, Protocol: "sctp"}},
+		{{ContainerPort: 0}},
+		{{ContainerPort: 80, HostPort: 70000}},
+		{{ContainerPort: 80, Name: "web"}, {ContainerPort: 81, Name: "web"}},
+		{{ContainerPort: 80, HostPort: 8080}, {ContainerPort: 81, HostPort: 8080}},
+	}
+	for i, ports := range invalid {
+		if _, err := buildPorts(ports); err == nil {
+			t.Errorf("Ports %d should be invalid", i)
+		}
+	}
+}
+
+func TestBuildConstraints(t *testing.T) {
+	constraints, err := buildConstraints([]*Constraint{
+		{Field: "hostname", Operator: "unique"},
+		{Field: "zone", Operator: "LIKE", Value: "eu-1[ab]"},
+		{Field: "rack", Operator: "GROUP_BY", Value: "3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(constraints) != 3 || constraints[0].Operator != ConstraintUnique || constraints[1].Value != "eu-1[ab]" {
+		t.Errorf("Unexpected constraints %+v", constraints)
+	}
+	invalid := []*Constraint{
+		{Field: "", Operator: ConstraintUnique},
+		{Field: "hostname", Operator: "ONE_PER_HOST"},
+		{Field: "hostname", Operator: ConstraintUnique, Value: "x"},
+		{Field: "zone", Operator: ConstraintLike},
+		{Field: "zone", Operator: ConstraintUnlike, Value: "eu-("},
+		{Field: "rack", Operator: ConstraintGroupBy, Value: "many"},
+	}
+	for i, c := range invalid {
+		if _, err := buildConstraints([]*Constraint{c}); err == nil {
+			t.Errorf("Constraint %d should be invalid", i)
+		}
+	}
+}
+
 func TestDeployList(t *testing.T) {
 
 }
+
+func TestReadyAndRoot(t *testing.T) {
+	router := gin.New()
+	router.GET("/", rootHandler)
+	router.GET("/ready", readyHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ready", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected: %d, got: %d\n", http.StatusOK, w.Code)
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	var root struct {
+		Backend BackendInfo `json:"backend"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &root)
+	if w.Code != http.StatusOK || root.Backend.Type != backend.SimulationType || root.Backend.Leader == "" {
+		fmt.Printf("Expected the backend info, got: %d - %s\n", w.Code, w.Body.String())
+		t.FailNow()
+	}
+}
+
+func TestDeployVersionsAndRollback(t *testing.T) {
+	router := gin.New()
+	router.GET("/deployments/:name/versions", deployVersions)
+	router.POST("/deployments/:name/rollback", deployRollback)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/deployments/versioned/versions", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		fmt.Printf("Expected: %d for an unknown app, got: %d\n", http.StatusNotFound, w.Code)
+		t.FailNow()
+	}
+
+	se.Backend.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "versioned"}})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/deployments/versioned/rollback", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected: %d when there is no previous version, got: %d\n", http.StatusBadRequest, w.Code)
+		t.FailNow()
+	}
+
+	se.Backend.UpdateDeployment(&UpdateRequest{BaseRequest: BaseRequest{Name: "versioned"}})
+	versions, _ := se.Backend.GetAppVersions(&ArtifactRequest{Name: "versioned"})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/deployments/versioned/rollback?version="+url.QueryEscape(versions[1]), nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected: %d, got: %d\n", http.StatusOK, w.Code)
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/deployments/versioned/versions", nil)
+	router.ServeHTTP(w, req)
+	var lv ListVersions
+	json.Unmarshal(w.Body.Bytes(), &lv)
+	if w.Code != http.StatusOK || len(lv.Versions) != 3 {
+		fmt.Printf("Expected 3 versions, got: %d - %s\n", w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	//with authentication only the team owning the app can roll it back
+	se.Backend.UpdateDeployment(&UpdateRequest{BaseRequest: BaseRequest{Name: "versioned", Labels: map[string]string{"team": "cats"}}})
+	router = gin.New()
+	router.Use(func(ginCtx *gin.Context) {
+		ginCtx.Set("uid", "someone")
+		ginCtx.Set("team", ginCtx.Query("team"))
+	})
+	router.POST("/deployments/:name/rollback", deployRollback)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/deployments/versioned/rollback?team=dogs", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		fmt.Printf("Expected: %d for another team, got: %d - %s\n", http.StatusForbidden, w.Code, w.Body.String())
+		t.FailNow()
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/deployments/versioned/rollback?team=cats", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected: %d for the owning team, got: %d - %s\n", http.StatusOK, w.Code, w.Body.String())
+		t.FailNow()
+	}
+}
+
+func TestDeployKill(t *testing.T) {
+	router := gin.New()
+	router.DELETE("/deployments/:name/replicas", deployKill)
+	router.DELETE("/deployments/:name/replicas/:replicaID", deployKill)
+
+	se.Backend.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "killed", Replicas: 2}})
+	artifact, _ := se.Backend.GetApp(&ArtifactRequest{Name: "killed"})
+	replicaID := artifact.RunningReplicas[1].ID
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/deployments/killed/replicas/"+replicaID+"?scale=true", nil)
+	router.ServeHTTP(w, req)
+	var result KillResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || len(result.Replicas) != 1 || result.Replicas[0] != replicaID {
+		fmt.Printf("Expected replica %s to be killed, got: %d - %s\n", replicaID, w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/deployments/killed/replicas", nil)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || len(result.Replicas) != 1 || result.Replicas[0] == replicaID {
+		fmt.Printf("Expected the remaining replica to be killed, got: %d - %s\n", w.Code, w.Body.String())
+		t.FailNow()
+	}
+}
+
+func TestPatchDeployRequest(t *testing.T) {
+	current := &DeployRequest{Name: "app", ImageURL: "app:1", Replicas: 2, MemoryLimit: "512",
+		Env: map[string]string{"FOO": "foo", "BAR": "bar"}, Labels: map[string]string{"team": "cats"},
+		Volumes: []*Volume{{HostPath: "/etc/app", ContainerPath: "/etc/app", Mode: "RO"}}}
+	patched, err := patchDeployRequest(current, []byte(`{"imageURL": "app:2", "env": {"FOO": "new", "BAR": null, "BAZ": "baz"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.ImageURL != "app:2" || patched.Replicas != 2 || patched.MemoryLimit != "512" || patched.Labels["team"] != "cats" {
+		t.Errorf("Unexpected patched request %+v", patched)
+	}
+	if len(patched.Env) != 2 || patched.Env["FOO"] != "new" || patched.Env["BAZ"] != "baz" {
+		t.Errorf("Unexpected patched env %v", patched.Env)
+	}
+	if len(patched.Volumes) != 1 || patched.Volumes[0].HostPath != "/etc/app" {
+		t.Errorf("The volumes should be kept, got %+v", patched.Volumes)
+	}
+
+	//the fields can be written like in the other requests, the keys of the environment keep their case
+	patched, err = patchDeployRequest(current, []byte(`{"ImageURL": "app:3", "Env": {"foo": "lower"}, "UpdateStrategy": {"MinimumHealthyCapacity": 0.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.ImageURL != "app:3" || patched.Env["FOO"] != "foo" || patched.Env["foo"] != "lower" || *patched.UpdateStrategy.MinimumHealthyCapacity != 0.5 {
+		t.Errorf("Unexpected patched request %+v", patched)
+	}
+	current.UpdateStrategy = patched.UpdateStrategy
+	patched, err = patchDeployRequest(current, []byte(`{"updateStrategy": {"MINIMUMHEALTHYCAPACITY": 0.25}}`))
+	if err != nil || *patched.UpdateStrategy.MinimumHealthyCapacity != 0.25 {
+		t.Errorf("Unexpected patched update strategy %+v, error %v", patched, err)
+	}
+
+	for _, patch := range []string{`not json`, `["imageURL"]`, `{"name": "other"}`, `{"replicas": "many"}`, `{"image": "app:2"}`,
+		`{"imageURL": "app:2", "ImageURL": "app:3"}`, `{"updateStrategy": {"minimum": 1}}`} {
+		if _, err := patchDeployRequest(current, []byte(patch)); err == nil {
+			t.Errorf("Patch %s should be rejected", patch)
+		}
+	}
+}
+
+func TestDeployPatch(t *testing.T) {
+	router := gin.New()
+	router.PATCH("/deployments/:name", deployPatch)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/deployments/fake-cat", bytes.NewBufferString(`{"imageURL": "pierone.test.techmonkeys/cat:3"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected: %d, got: %d - %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/deployments/fake-cat", bytes.NewBufferString(`{"memoryLimit": "lots"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected: %d for a malformed quantity, got: %d", http.StatusBadRequest, w.Code)
+	}
+
+	//with authentication only the team owning the app can patch it
+	router = gin.New()
+	router.Use(func(ginCtx *gin.Context) {
+		ginCtx.Set("uid", "someone")
+		ginCtx.Set("team", ginCtx.Query("team"))
+	})
+	router.PATCH("/deployments/:name", deployPatch)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/deployments/fake-cat?team=dogs", bytes.NewBufferString(`{"ImageURL": "pierone.test.techmonkeys/cat:2"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected: %d for another team, got: %d - %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+}
+
+func TestCheckOwner(t *testing.T) {
+	artifact := &Artifact{Labels: &map[string]string{"team": "cats"}}
+	for _, caller := range []Caller{{}, {Team: "cats"}, {Team: "admins", Admin: true}} {
+		if err := checkOwner(caller, "app", artifact); err != nil {
+			t.Errorf("Expected %+v to own the app, got %s", caller, err)
+		}
+	}
+	for _, artifact := range []*Artifact{artifact, &Artifact{}} {
+		if err := checkOwner(Caller{Team: "dogs"}, "app", artifact); err == nil {
+			t.Errorf("Expected dogs not to own %+v", artifact)
+		}
+	}
+}
+
+func TestResolveAndMaskSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "cats"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "cats", "db"), []byte("s3cr3t"), 0600)
+	se.Secrets = &secrets.FileStore{Dir: dir}
+	defer func() { se.Secrets = nil }()
+
+	base := &BaseRequest{Name: "app", Env: map[string]string{"DB_PASSWORD": "secret://cats/db", "FOO": "bar"}}
+	if err = resolveSecrets(base, "cats"); err != nil {
+		t.Fatal(err)
+	}
+	if base.Env["DB_PASSWORD"] != "s3cr3t" || base.Env["FOO"] != "bar" || base.Labels[secretsLabel] == "" {
+		t.Fatalf("Unexpected resolved request %+v", base)
+	}
+	artifact := &Artifact{Name: "app", Env: &base.Env, Labels: &base.Labels}
+	maskSecrets(artifact)
+	if (*artifact.Env)["DB_PASSWORD"] != "secret://cats/db" || (*artifact.Env)["FOO"] != "bar" {
+		t.Fatalf("Unexpected masked env %v", *artifact.Env)
+	}
+	if err = resolveSecrets(&BaseRequest{Env: map[string]string{"X": "secret://cats/missing"}}, "cats"); err == nil {
+		t.Fatal("A missing secret should be an error")
+	}
+	if status := secretErrorStatus(&secrets.AccessError{}); status != http.StatusForbidden {
+		t.Fatalf("Expected %d for an access error, got %d", http.StatusForbidden, status)
+	}
+}
+
+func TestDiffRequests(t *testing.T) {
+	current := &BaseRequest{Name: "app", ImageURL: "app:1", Replicas: 2, MemoryLimit: 512,
+		Env: map[string]string{"FOO": "foo", "OLD": "old"}, Labels: map[string]string{secretsLabel: "{}"}}
+	requested := &BaseRequest{Name: "app", ImageURL: "app:2", Replicas: 2, MemoryLimit: 512, Force: true,
+		Env: map[string]string{"FOO": "foo", "NEW": "new"}}
+	changes, err := diffRequests(current, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FieldChange{
+		{Field: "env.NEW", Action: DiffAdded, Requested: `"new"`},
+		{Field: "env.OLD", Action: DiffRemoved, Current: `"old"`},
+		{Field: "imageURL", Action: DiffChanged, Current: `"app:1"`, Requested: `"app:2"`},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d", len(expected), len(changes))
+	}
+	for i := range expected {
+		if *changes[i] != expected[i] {
+			t.Errorf("Expected change %+v, got %+v", expected[i], *changes[i])
+		}
+	}
+
+	//the settings left unset in the request have the defaults of the backend in the current app
+	minimum, over := 1.0, 1.0
+	current = &BaseRequest{Name: "app", ImageURL: "app:1", Replicas: 2, CPULimit: 1, MemoryLimit: 128,
+		Ports:          []Port{{ContainerPort: 8080, Protocol: PortProtocolTCP, ServicePort: 10001}},
+		HealthChecks:   []*HealthCheck{{Protocol: HealthCheckHTTP, Path: "/health", IntervalSeconds: 60, GracePeriodSeconds: 300, MaxConsecutiveFailures: 3}},
+		Volumes:        []*Volume{{ContainerPath: "/data", HostPath: "/var/data", Mode: "RW"}},
+		UpdateStrategy: &UpdateStrategy{MinimumHealthyCapacity: &minimum, MaximumOverCapacity: &over},
+		Env:            map[string]string{"FOO": "foo"}}
+	requested = &BaseRequest{Name: "app", ImageURL: "app:1", Replicas: 2,
+		Ports:        []Port{{ContainerPort: 8080}},
+		HealthChecks: []*HealthCheck{{Protocol: HealthCheckHTTP, Path: "/health"}},
+		Volumes:      []*Volume{{ContainerPath: "/data", HostPath: "/var/data"}},
+		Env:          map[string]string{"FOO": "foo"}}
+	if changes, err = diffRequests(current, requested); err != nil || len(changes) != 0 {
+		t.Fatalf("Expected no changes for the defaults of the backend, got %v, error %v", changes, err)
+	}
+	requestedMinimum := 0.5
+	requested.UpdateStrategy = &UpdateStrategy{MinimumHealthyCapacity: &requestedMinimum}
+	requested.HealthChecks[0].GracePeriodSeconds = 30
+	requested.Ports = append(requested.Ports, Port{ContainerPort: 9090})
+	requested.Env = nil
+	changes, err = diffRequests(current, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make([]string, len(changes))
+	for i, change := range changes {
+		fields[i] = change.Action + " " + change.Field
+	}
+	if strings.Join(fields, ",") != "REMOVED env.FOO,CHANGED healthChecks,CHANGED ports,CHANGED updateStrategy" {
+		t.Fatalf("Expected only the settings given to change, got %v", fields)
+	}
+	if changes[3].Current != `{"minimumHealthyCapacity":1}` {
+		t.Errorf("Expected the unset capacity not to be compared, got %s", changes[3].Current)
+	}
+
+	changes, err = diffRequests(nil, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range changes {
+		if change.Action != DiffAdded {
+			t.Errorf("Every setting of a new app should be added, got %+v", change)
+		}
+	}
+}
+
+func TestDeployDryRun(t *testing.T) {
+	before, _ := se.Backend.GetAppVersions(&ArtifactRequest{Name: "fake-cat"})
+	router := gin.New()
+	router.PUT("/deployments/:name", deployUpsert)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/deployments/fake-cat?dryRun=true", bytes.NewBufferString(
+		`{"name": "fake-cat", "imageURL": "pierone.test.techmonkeys/cat:2", "replicas": 1, "cpuLimit": 1, "memoryLimit": "2Gi", "ports": [8080]}`))
+	router.ServeHTTP(w, req)
+	var result DiffResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || !result.Exists || len(result.Changes) != 1 || result.Changes[0].Field != "imageURL" {
+		t.Fatalf("Expected only the image to change, got: %d - %s", w.Code, w.Body.String())
+	}
+	if versions, _ := se.Backend.GetAppVersions(&ArtifactRequest{Name: "fake-cat"}); len(versions) != len(before) {
+		t.Fatalf("A dry run should not update the app, got versions %v", versions)
+	}
+
+	//only an app not found is new, when the backend fails the app may exist
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/deployments/new-cat?dryRun=true", bytes.NewBufferString(`{"name": "new-cat", "imageURL": "cat:1"}`))
+	router.ServeHTTP(w, req)
+	result = DiffResult{}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Exists {
+		t.Fatalf("Expected a new app, got: %d - %s", w.Code, w.Body.String())
+	}
+	defer func(previous backend.Backend) { se.Backend = previous }(se.Backend)
+	se.Backend = unreachableBackend{se.Backend}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/deployments/fake-cat?dryRun=true", bytes.NewBufferString(`{"name": "fake-cat", "imageURL": "cat:1"}`))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected: %d when the backend cannot be reached, got: %d - %s", http.StatusInternalServerError, w.Code, w.Body.String())
+	}
+}
+
+//unreachableBackend is a backend whose apps cannot be read
+type unreachableBackend struct {
+	backend.Backend
+}
+
+func (unreachableBackend) GetApp(req *ArtifactRequest) (*Artifact, error) {
+	return nil, errors.New("connection refused")
+}
+
+//TestDeployDryRunUnchanged checks that an app deployed with a definition has no changes for the same definition,
+//so that apply leaves it alone
+func TestDeployDryRunUnchanged(t *testing.T) {
+	router := gin.New()
+	router.POST("/deployments", deployCreate)
+	router.PUT("/deployments/:name", deployUpsert)
+
+	app := `{"name": "same", "imageURL": "same:1", "replicas": 2, "memoryLimit": "512MB", "ports": [8080, {"containerPort": 9090, "name": "admin"}],
+		"env": {"FOO": "foo"}, "labels": {"tier": "web"}, "healthChecks": [{"protocol": "HTTP", "path": "/health"}]}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/deployments", bytes.NewBufferString(app))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the app to be created, got: %d - %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/deployments/same?dryRun=true", bytes.NewBufferString(app))
+	router.ServeHTTP(w, req)
+	var result DiffResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || !result.Exists || len(result.Changes) != 0 {
+		t.Fatalf("Expected no changes for the definition deployed, got: %d - %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeployUpsertOwner(t *testing.T) {
+	config := conf.New()
+	defer func(adminTeams []string) { config.AdminTeams = adminTeams }(config.AdminTeams)
+	config.AdminTeams = []string{"ops"}
+	router := gin.New()
+	router.Use(func(ginCtx *gin.Context) {
+		ginCtx.Set("uid", ginCtx.Query("team")+"-user")
+		ginCtx.Set("team", ginCtx.Query("team"))
+	})
+	router.PUT("/deployments/:name", deployUpsert)
+
+	app := `{"name": "owned", "imageURL": "owned:1", "replicas": 1}`
+	se.Backend.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "owned", Labels: map[string]string{"team": "cats"}}})
+	for _, step := range []struct {
+		team   string
+		status int
+		owner  string
+	}{
+		{"dogs", http.StatusForbidden, "cats"},
+		{"cats", http.StatusOK, "cats"},
+		{"ops", http.StatusOK, "cats"}, //an admin leaves the app to its team
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/deployments/owned?team="+step.team, bytes.NewBufferString(app))
+		router.ServeHTTP(w, req)
+		if w.Code != step.status {
+			t.Fatalf("Expected: %d for a PUT by %s, got: %d - %s", step.status, step.team, w.Code, w.Body.String())
+		}
+		artifact, err := se.Backend.GetApp(&ArtifactRequest{Name: "owned"})
+		if err != nil || (*artifact.Labels)["team"] != step.owner {
+			t.Fatalf("Expected the app to belong to %s after a PUT by %s, got: %+v - %v", step.owner, step.team, artifact, err)
+		}
+	}
+	artifact, _ := se.Backend.GetApp(&ArtifactRequest{Name: "owned"})
+	if (*artifact.Labels)["user"] != "ops-user" {
+		t.Errorf("Expected the admin as last user, got: %v", *artifact.Labels)
+	}
+}
+
+func TestDeployCancel(t *testing.T) {
+	router := gin.New()
+	router.DELETE("/deployments/:name/rollout", deployCancel)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/deployments/fake-cat/rollout?force=true", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected: %d without deployments in progress, got: %d\n", http.StatusBadRequest, w.Code)
+		t.FailNow()
+	}
+
+	//with authentication only the team owning the app can cancel its rollout
+	se.Backend.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "cancelled", Labels: map[string]string{"team": "cats"}}})
+	router = gin.New()
+	router.Use(func(ginCtx *gin.Context) {
+		ginCtx.Set("uid", "someone")
+		ginCtx.Set("team", ginCtx.Query("team"))
+	})
+	router.DELETE("/deployments/:name/rollout", deployCancel)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/deployments/cancelled/rollout?force=true&team=dogs", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		fmt.Printf("Expected: %d for another team, got: %d - %s\n", http.StatusForbidden, w.Code, w.Body.String())
+		t.FailNow()
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/deployments/unknown/rollout", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		fmt.Printf("Expected: %d for an unknown app, got: %d\n", http.StatusNotFound, w.Code)
+		t.FailNow()
+	}
+}
+
+func TestGroups(t *testing.T) {
+	router := gin.New()
+	router.GET("/groups/:name", groupInfo)
+	router.POST("/groups", groupCreate)
+	router.DELETE("/groups/:name", groupDelete)
+	router.GET("/groups/:name/rollout", groupRollout)
+
+	group := `{"Name":"shop","Apps":[{"Name":"frontend","ImageURL":"frontend","MemoryLimit":"512MB","Dependencies":["backend"]},{"Name":"backend","ImageURL":"backend","MemoryLimit":"512MB"}]}`
+	for i, expected := range []int{http.StatusOK, http.StatusNotAcceptable} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/groups", bytes.NewBufferString(group))
+		router.ServeHTTP(w, req)
+		if w.Code != expected {
+			fmt.Printf("Expected: %d for creation %d, got: %d - %s\n", expected, i, w.Code, w.Body.String())
+			t.FailNow()
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/groups/shop", nil)
+	router.ServeHTTP(w, req)
+	var artifact GroupArtifact
+	json.Unmarshal(w.Body.Bytes(), &artifact)
+	if w.Code != http.StatusOK || len(artifact.Apps) != 2 || artifact.Apps[0].Name != "shop/frontend" {
+		fmt.Printf("Expected the 2 apps of the group, got: %d - %s\n", w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/groups/shop/rollout", nil)
+	router.ServeHTTP(w, req)
+	var rollout Rollout
+	json.Unmarshal(w.Body.Bytes(), &rollout)
+	if w.Code != http.StatusOK || rollout.Status != RolloutDone {
+		fmt.Printf("Expected a completed rollout, got: %d - %s\n", w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/groups/shop", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected: %d, got: %d\n", http.StatusOK, w.Code)
+		t.FailNow()
+	}
+}
+
+func TestGroupsOwner(t *testing.T) {
+	config := conf.New()
+	defer func(adminTeams []string) { config.AdminTeams = adminTeams }(config.AdminTeams)
+	config.AdminTeams = []string{"ops"}
+	router := gin.New()
+	router.Use(func(ginCtx *gin.Context) {
+		ginCtx.Set("uid", ginCtx.Query("team")+"-user")
+		ginCtx.Set("team", ginCtx.Query("team"))
+	})
+	router.GET("/groups/:name", groupInfo)
+	router.POST("/groups", groupCreate)
+	router.PUT("/groups/:name", groupUpsert)
+	router.DELETE("/groups/:name", groupDelete)
+	router.GET("/groups/:name/rollout", groupRollout)
+
+	group := `{"Name":"zoo","Apps":[{"Name":"cage","ImageURL":"cage","MemoryLimit":"512MB"}]}`
+	for _, step := range []struct {
+		method string
+		url    string
+		status int
+	}{
+		{"POST", "/groups?team=cats", http.StatusOK},
+		{"GET", "/groups/zoo?team=dogs", http.StatusForbidden},
+		{"PUT", "/groups/zoo?team=dogs", http.StatusForbidden},
+		{"GET", "/groups/zoo/rollout?team=dogs", http.StatusForbidden},
+		{"DELETE", "/groups/zoo?team=dogs", http.StatusForbidden},
+		{"PUT", "/groups/unknown?team=cats", http.StatusNotFound},
+		{"PUT", "/groups/zoo?team=cats", http.StatusOK},
+		{"PUT", "/groups/zoo?team=ops", http.StatusOK}, //an admin leaves the apps to their team
+		{"GET", "/groups/zoo?team=cats", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(step.method, step.url, bytes.NewBufferString(group))
+		router.ServeHTTP(w, req)
+		if w.Code != step.status {
+			t.Fatalf("Expected: %d for %s %s, got: %d - %s", step.status, step.method, step.url, w.Code, w.Body.String())
+		}
+	}
+	artifact, err := se.Backend.GetGroup(&ArtifactRequest{Name: "zoo"})
+	if err != nil || len(artifact.Apps) != 1 || (*artifact.Apps[0].Labels)["team"] != "cats" || (*artifact.Apps[0].Labels)["user"] != "ops-user" {
+		t.Fatalf("Expected the apps updated by the admin to belong to cats, got: %+v - %v", artifact, err)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/groups/zoo?team=cats", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected: %d for the owning team, got: %d - %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestSimulationBackend(t *testing.T) {
+	defer func(previous backend.Backend) { se.Backend = previous }(se.Backend)
+	se.Backend = backend.NewForType(backend.SimulationType)
+	router := gin.New()
+	router.GET("/deployments/:name", deployInfo)
+	router.POST("/deployments", deployCreate)
+	router.DELETE("/deployments/:name", deployDelete)
+	router.PATCH("/deployments/:name/replicas/:num", deployReplicasModify)
+
+	app := `{"Name":"simulated","ImageURL":"simulated","MemoryLimit":"512MB","Replicas":1}`
+	for i, expected := range []int{http.StatusOK, http.StatusNotAcceptable} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/deployments", bytes.NewBufferString(app))
+		router.ServeHTTP(w, req)
+		if w.Code != expected {
+			fmt.Printf("Expected: %d for creation %d, got: %d - %s\n", expected, i, w.Code, w.Body.String())
+			t.FailNow()
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/deployments/simulated/replicas/3", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected: %d, got: %d - %s\n", http.StatusOK, w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/deployments/simulated", nil)
+	router.ServeHTTP(w, req)
+	var artifact Artifact
+	json.Unmarshal(w.Body.Bytes(), &artifact)
+	if w.Code != http.StatusOK || artifact.RequestedReplicas != 3 || len(artifact.RunningReplicas) != 3 {
+		fmt.Printf("Expected 3 simulated replicas, got: %d - %s\n", w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	for i, expected := range []int{http.StatusOK, http.StatusBadRequest} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("DELETE", "/deployments/simulated", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != expected {
+			fmt.Printf("Expected: %d for deletion %d, got: %d - %s\n", expected, i, w.Code, w.Body.String())
+			t.FailNow()
+		}
+	}
+}
+
+func TestValidateGroup(t *testing.T) {
+	app := func(name string, deps ...string) DeployRequest {
+		return DeployRequest{Name: name, Dependencies: deps}
+	}
+	valid := []*GroupDeployRequest{
+		&GroupDeployRequest{Name: "shop", Apps: []DeployRequest{app("frontend", "backend"), app("backend", "db"), app("db")}},
+	}
+	invalid := []*GroupDeployRequest{
+		&GroupDeployRequest{Apps: []DeployRequest{app("frontend")}},
+		&GroupDeployRequest{Name: "shop"},
+		&GroupDeployRequest{Name: "shop", Apps: []DeployRequest{app("frontend"), app("frontend")}},
+		&GroupDeployRequest{Name: "shop", Apps: []DeployRequest{app("frontend", "backend")}},
+		&GroupDeployRequest{Name: "shop", Apps: []DeployRequest{app("frontend", "backend"), app("backend", "frontend")}},
+	}
+	for _, group := range valid {
+		if err := validateGroup(group); err != nil {
+			fmt.Printf("Expected %+v to be valid, got: %s\n", group, err)
+			t.FailNow()
+		}
+	}
+	for _, group := range invalid {
+		if err := validateGroup(group); err == nil {
+			fmt.Printf("Expected %+v to be invalid\n", group)
+			t.FailNow()
+		}
+	}
+}
+
+func TestValidateHealthChecks(t *testing.T) {
+	valid := []*HealthCheck{
+		&HealthCheck{Protocol: "HTTP", Path: "/health", PortIndex: 0},
+		&HealthCheck{Protocol: "tcp", PortIndex: 1},
+		&HealthCheck{Protocol: "COMMAND", Command: "curl -f localhost:8080"},
+	}
+	if err := validateHealthChecks(valid, 2); err != nil {
+		fmt.Printf("Expected valid health checks, got: %s\n", err)
+		t.FailNow()
+	}
+	invalid := [][]*HealthCheck{
+		{&HealthCheck{Protocol: "HTTP"}},
+		{&HealthCheck{Protocol: "UDP"}},
+		{&HealthCheck{Protocol: "COMMAND"}},
+		{&HealthCheck{Protocol: "TCP", PortIndex: 2}},
+		{&HealthCheck{Protocol: "TCP", IntervalSeconds: -1}},
+	}
+	for _, checks := range invalid {
+		if err := validateHealthChecks(checks, 2); err == nil {
+			fmt.Printf("Expected an error for %+v\n", *checks[0])
+			t.FailNow()
+		}
+	}
+}
+
+func TestValidateUpdateStrategy(t *testing.T) {
+	fraction := func(f float64) *float64 { return &f }
+	valid := []*UpdateStrategy{nil, &UpdateStrategy{MinimumHealthyCapacity: fraction(1), MaximumOverCapacity: fraction(0.2)}, &UpdateStrategy{},
+		&UpdateStrategy{MinimumHealthyCapacity: fraction(1)}, &UpdateStrategy{MinimumHealthyCapacity: fraction(0.5), MaximumOverCapacity: fraction(0)}}
+	for _, strategy := range valid {
+		if err := validateUpdateStrategy(strategy); err != nil {
+			fmt.Printf("Expected a valid strategy, got: %s\n", err)
+			t.FailNow()
+		}
+	}
+	invalid := []*UpdateStrategy{
+		&UpdateStrategy{MinimumHealthyCapacity: fraction(1.5)},
+		&UpdateStrategy{MaximumOverCapacity: fraction(-0.1)},
+		&UpdateStrategy{MinimumHealthyCapacity: fraction(1), MaximumOverCapacity: fraction(0)},
+		&UpdateStrategy{MaximumOverCapacity: fraction(0)}, //the default minimum healthy capacity is 1.0
+	}
+	for _, strategy := range invalid {
+		if err := validateUpdateStrategy(strategy); err == nil {
+			fmt.Printf("Expected an error for %+v\n", *strategy)
+			t.FailNow()
+		}
+	}
+}
+
+func TestValidateHost(t *testing.T) {
+	for _, host := range []string{"", "shop.example.org", "Shop-1.example.org", "localhost"} {
+		if err := validateHost(host, 1); err != nil {
+			t.Errorf("Expected %q to be valid, got: %s", host, err)
+		}
+	}
+	for _, host := range []string{"https://shop.example.org", "shop.example.org:443", "shop..org", "-shop.org", "shop_1.org"} {
+		if err := validateHost(host, 1); err == nil {
+			t.Errorf("Expected an error for %q", host)
+		}
+	}
+	if err := validateHost("shop.example.org", 0); err == nil {
+		t.Error("Expected an error for a host without ports")
+	}
+}
+
+func TestEventHubWatch(t *testing.T) {
+	ch, err := hub.watch("watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hub.unwatch(ch)
+	se.Backend.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "other", Replicas: 1}})
+	se.Backend.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "watched", Replicas: 1}})
+	select {
+	case event := <-ch:
+		if normalizeAppName(event.App) != "watched" || event.Type != EventStatusUpdate {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+}
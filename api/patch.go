@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	. "github.com/zalando/chimp/types"
+	"github.com/zalando/chimp/validators"
+)
+
+//deployPatch updates an app with a JSON merge patch (RFC 7386) applied to its current definition,
+//so that p.e. only the image or the environment can be changed without sending the full definition.
+func deployPatch(ginCtx *gin.Context) {
+	name := ginCtx.Params.ByName("name")
+	patch, err := ioutil.ReadAll(ginCtx.Request.Body)
+	if err != nil {
+		glog.Errorf("Could not read the patch of %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	artifact, err := se.Backend.GetApp(&ArtifactRequest{Action: INFO, Name: name, Caller: buildCaller(ginCtx)})
+	if err != nil {
+		glog.Errorf("Could not get artifact from backend for PATCH request with name %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	caller := buildCaller(ginCtx)
+	if err = checkOwner(caller, name, artifact); err != nil {
+		glog.Errorf("Could not patch deploy %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	maskSecrets(artifact) //the references are resolved again, so that the secrets are up to date
+	deploy, err := patchDeployRequest(deployRequestOf(name, artifact), patch)
+	if err != nil {
+		glog.Errorf("Could not patch deploy %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	//the owner is set like on PUT, an admin patching the app of another team leaves it to that team
+	team, uid := buildTeamLabel(ginCtx)
+	if deploy.Labels == nil {
+		deploy.Labels = make(map[string]string, 2)
+	}
+	if !caller.Admin || deploy.Labels["team"] == "" {
+		deploy.Labels["team"] = team
+	}
+	deploy.Labels["user"] = uid
+	if valid, _ := validators.New().Validate(*deploy); !valid {
+		glog.Errorf("Invalid request, validation not passed.")
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request."})
+		ginCtx.Error(errors.New("Invalid request"))
+		return
+	}
+	ginCtx.Set("data", *deploy)
+	base, err := buildBaseRequest(deploy)
+	if err != nil {
+		glog.Errorf("Could not patch deploy %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	base.Caller = caller
+	if err = resolveSecrets(base, caller.Team); err != nil {
+		glog.Errorf("Could not patch deploy %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(secretErrorStatus(err), gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	beRes, err := se.Backend.UpdateDeployment(&UpdateRequest{BaseRequest: *base})
+	if err != nil {
+		glog.Errorf("Could not patch deploy %s, caused by: %s", name, err.Error())
+		ginCtx.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		ginCtx.Error(err)
+		return
+	}
+	glog.Infof("Deployment %s patched", name)
+	ginCtx.JSON(http.StatusOK, DeploymentResult{Name: name, DeploymentID: beRes})
+}
+
+//deployRequestOf builds the deploy request matching the current state of an app
+func deployRequestOf(name string, artifact *Artifact) *DeployRequest {
+	deploy := &DeployRequest{
+		Name:           name,
+		Replicas:       artifact.RequestedReplicas,
+		Ports:          artifact.Ports,
+		ImageURL:       artifact.ImageURL,
+		CPULimit:       Quantity(strconv.FormatFloat(artifact.CPUS, 'f', -1, 64)),
+		MemoryLimit:    Quantity(strconv.FormatFloat(artifact.Memory, 'f', -1, 64)), //mebibytes, like a number without suffix
+		DiskLimit:      Quantity(strconv.FormatFloat(artifact.Disk, 'f', -1, 64)),
+		Volumes:        artifact.Volumes,
+		HealthChecks:   artifact.HealthChecks,
+		UpdateStrategy: artifact.UpdateStrategy,
+		Dependencies:   artifact.Dependencies,
+		Constraints:    artifact.Constraints,
+		Host:           artifact.Host,
+	}
+	if artifact.Labels != nil {
+		deploy.Labels = *artifact.Labels
+	}
+	if artifact.Env != nil {
+		deploy.Env = *artifact.Env
+	}
+	return deploy
+}
+
+//patchDeployRequest applies a JSON merge patch to a deploy request. The name of the app cannot be changed.
+//The fields of the patch can be written in any case, like ImageURL or imageURL, as in the other requests.
+func patchDeployRequest(current *DeployRequest, patch []byte) (*DeployRequest, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return nil, fmt.Errorf("the patch is not valid JSON: %s", err)
+	}
+	patchObject, ok := patchDoc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the patch must be a JSON object")
+	}
+	if err := normalizeFields(patchObject, reflect.TypeOf(*current)); err != nil {
+		return nil, err
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var currentDoc interface{}
+	if err = json.Unmarshal(currentJSON, &currentDoc); err != nil {
+		return nil, err
+	}
+	patchedJSON, err := json.Marshal(mergePatch(currentDoc, patchDoc))
+	if err != nil {
+		return nil, err
+	}
+	var patched DeployRequest
+	if err = json.Unmarshal(patchedJSON, &patched); err != nil {
+		return nil, fmt.Errorf("the patched deployment is not valid: %s", err)
+	}
+	if patched.Name != current.Name {
+		return nil, fmt.Errorf("the name of deployment %s cannot be changed", current.Name)
+	}
+	return &patched, nil
+}
+
+//normalizeFields renames the fields of a patch of the given struct type to their JSON names, matching them without case
+//like encoding/json does, so that they replace the current values. The objects of nested structs are renamed too,
+//the keys of maps, like the environment, are kept as they are. Unknown fields are an error.
+func normalizeFields(patch map[string]interface{}, structType reflect.Type) error {
+	names := make(map[string]reflect.StructField, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[strings.ToLower(name)] = field
+	}
+	for key, value := range patch {
+		field, ok := names[strings.ToLower(key)]
+		if !ok {
+			return fmt.Errorf("unknown field %s", key)
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if key != name {
+			if _, duplicated := patch[name]; duplicated {
+				return fmt.Errorf("field %s is given more than once", name)
+			}
+			delete(patch, key)
+			patch[name] = value
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if object, ok := value.(map[string]interface{}); ok && fieldType.Kind() == reflect.Struct {
+			if err := normalizeFields(object, fieldType); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+//mergePatch merges a patch onto a JSON document as defined by RFC 7386: objects are merged key by key,
+//null removes a key and any other value replaces the current one.
+func mergePatch(doc interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		docObject = make(map[string]interface{}, len(patchObject))
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(docObject, key)
+		} else {
+			docObject[key] = mergePatch(docObject[key], value)
+		}
+	}
+	return docObject
+}
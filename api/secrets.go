@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/zalando/chimp/conf"
+	"github.com/zalando/chimp/secrets"
+	. "github.com/zalando/chimp/types"
+)
+
+//secretsLabel is the label keeping the secret references of the env of an app, as JSON.
+//The references replace the resolved values whenever an app is returned.
+const secretsLabel = "chimp-secrets"
+
+//resolveSecrets replaces the secret references in the env of a request with the values of the secrets,
+//which must belong to the team of the caller when authentication is enabled. The references are kept in a label.
+func resolveSecrets(base *BaseRequest, team string) error {
+	references := make(map[string]string)
+	for key, value := range base.Env {
+		if secrets.IsReference(value) {
+			references[key] = value
+		}
+	}
+	if base.Labels != nil {
+		delete(base.Labels, secretsLabel)
+	}
+	if len(references) == 0 {
+		return nil
+	}
+	checkTeam := conf.New().Oauth2Enabled
+	env := make(map[string]string, len(base.Env))
+	for key, value := range base.Env {
+		if reference, ok := references[key]; ok {
+			secret, err := secrets.Resolve(se.Secrets, reference, team, checkTeam)
+			if err != nil {
+				return err
+			}
+			value = secret
+		}
+		env[key] = value
+	}
+	label, err := json.Marshal(references)
+	if err != nil {
+		return err
+	}
+	if base.Labels == nil {
+		base.Labels = make(map[string]string, 1)
+	}
+	base.Labels[secretsLabel] = string(label)
+	base.Env = env
+	return nil
+}
+
+//secretErrorStatus returns the HTTP status for an error resolving the secrets
+func secretErrorStatus(err error) int {
+	if _, ok := err.(*secrets.AccessError); ok {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+//maskSecrets replaces the values of the secrets in the env of an app with their references
+func maskSecrets(artifact *Artifact) {
+	if artifact == nil || artifact.Labels == nil || artifact.Env == nil {
+		return
+	}
+	label, ok := (*artifact.Labels)[secretsLabel]
+	if !ok {
+		return
+	}
+	var references map[string]string
+	if err := json.Unmarshal([]byte(label), &references); err != nil {
+		glog.Errorf("Could not read the secret references of %s, caused by: %s", artifact.Name, err)
+		references = nil
+	}
+	env := make(map[string]string, len(*artifact.Env))
+	for key, value := range *artifact.Env {
+		if reference, ok := references[key]; ok {
+			value = reference
+		} else if references == nil {
+			value = "<hidden>" //the secrets are not known, every value is hidden
+		}
+		env[key] = value
+	}
+	artifact.Env = &env
+}
+
+//maskEnv hides the values of the env of a request, so that it can be logged
+func maskEnv(deploy DeployRequest) DeployRequest {
+	env := make(map[string]string, len(deploy.Env))
+	for key, value := range deploy.Env {
+		if !secrets.IsReference(value) {
+			value = "<hidden>"
+		}
+		env[key] = value
+	}
+	deploy.Env = env
+	return deploy
+}
@@ -9,12 +9,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
-	"github.com/zalando/chimp/conf"
 	"github.com/zalando-techmonkeys/gin-glog"
 	"github.com/zalando-techmonkeys/gin-gomonitor"
 	"github.com/zalando-techmonkeys/gin-gomonitor/aspects"
 	"github.com/zalando-techmonkeys/gin-oauth2"
 	"github.com/zalando-techmonkeys/gin-oauth2/zalando"
+	"github.com/zalando/chimp/conf"
 	"gopkg.in/mcuadros/go-monitor.v1/aspects"
 )
 
@@ -92,21 +92,48 @@ func (svc *Service) Run(cfg ServerSettings) error {
 	//non authenticated routes
 	router.GET("/", rootHandler)
 	router.GET("/health", healthHandler)
+	router.GET("/ready", readyHandler)
 	//authenticated routes
 	if config.Configuration.Oauth2Enabled {
 		private.GET("/deployments", deployList)
 		private.GET("/deployments/:name", deployInfo)
 		private.POST("/deployments", deployCreate)
 		private.PUT("/deployments/:name", deployUpsert)
+		private.PATCH("/deployments/:name", deployPatch)
 		private.DELETE("/deployments/:name", deployDelete)
 		private.PATCH("/deployments/:name/replicas/:num", deployReplicasModify)
+		private.DELETE("/deployments/:name/replicas", deployKill)
+		private.DELETE("/deployments/:name/replicas/:replicaID", deployKill)
+		private.GET("/deployments/:name/versions", deployVersions)
+		private.POST("/deployments/:name/rollback", deployRollback)
+		private.GET("/deployments/:name/rollout", deployRollout)
+		private.DELETE("/deployments/:name/rollout", deployCancel)
+		private.GET("/deployments/:name/events", deployEvents)
+		private.GET("/groups/:name", groupInfo)
+		private.POST("/groups", groupCreate)
+		private.PUT("/groups/:name", groupUpsert)
+		private.DELETE("/groups/:name", groupDelete)
+		private.GET("/groups/:name/rollout", groupRollout)
 	} else {
 		router.GET("/deployments", deployList)
 		router.GET("/deployments/:name", deployInfo)
 		router.POST("/deployments", deployCreate)
 		router.PUT("/deployments/:name", deployUpsert)
+		router.PATCH("/deployments/:name", deployPatch)
 		router.DELETE("/deployments/:name", deployDelete)
 		router.PATCH("/deployments/:name/replicas/:num", deployReplicasModify)
+		router.DELETE("/deployments/:name/replicas", deployKill)
+		router.DELETE("/deployments/:name/replicas/:replicaID", deployKill)
+		router.GET("/deployments/:name/versions", deployVersions)
+		router.POST("/deployments/:name/rollback", deployRollback)
+		router.GET("/deployments/:name/rollout", deployRollout)
+		router.DELETE("/deployments/:name/rollout", deployCancel)
+		router.GET("/deployments/:name/events", deployEvents)
+		router.GET("/groups/:name", groupInfo)
+		router.POST("/groups", groupCreate)
+		router.PUT("/groups/:name", groupUpsert)
+		router.DELETE("/groups/:name", groupDelete)
+		router.GET("/groups/:name/rollout", groupRollout)
 	}
 
 	// TLS config
@@ -1,17 +1,67 @@
 package backend
 
-import . "github.com/zalando/chimp/types"
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/zalando/chimp/types"
+)
 
 //Backend is the interface with all the methods that any backend should implement to be run in chimp
 type Backend interface {
-	GetAppNames(filter map[string]string) ([]string, error)
+	Ping() error
+	Info() (*BackendInfo, error)
+	GetAppNames(caller Caller, filter map[string]string) ([]string, error)
 	GetApp(req *ArtifactRequest) (*Artifact, error)
 	Deploy(req *CreateRequest) (string, error)
 	Scale(scale *ScaleRequest) (string, error)
 	Delete(deleteReq *ArtifactRequest) (string, error)
 	UpdateDeployment(req *UpdateRequest) (string, error)
+	GetAppVersions(req *ArtifactRequest) ([]string, error)
+	Rollback(req *RollbackRequest) (string, error)
+	GetRollout(req *RolloutRequest) (*Rollout, error)
+	CancelRollout(req *CancelRequest) ([]*CancelledDeployment, error)
+	Events() (<-chan *Event, error)
+	Kill(req *KillRequest) ([]string, error)
+	DeployGroup(req *GroupRequest) (string, error)
+	UpdateGroup(req *GroupRequest) (string, error)
+	GetGroup(req *ArtifactRequest) (*GroupArtifact, error)
+	DeleteGroup(req *ArtifactRequest) (string, error)
 }
 
 type backendFactory func() Backend
 
 var New backendFactory
+
+//NewForType returns the backend of the given type: the simulation backend can be chosen at runtime,
+//any other type gets the backend chosen at build time
+func NewForType(backendType string) Backend {
+	if strings.EqualFold(backendType, SimulationType) {
+		return NewSimulationBackend()
+	}
+	return New()
+}
+
+//AppNotFoundError is returned by GetApp for an app which does not exist, unlike the errors of the cluster
+type AppNotFoundError struct {
+	Name string
+}
+
+func (e *AppNotFoundError) Error() string {
+	return fmt.Sprintf("application %s not found", e.Name)
+}
+
+//IsAppNotFound returns true if the error tells that an app does not exist
+func IsAppNotFound(err error) bool {
+	_, ok := err.(*AppNotFoundError)
+	return ok
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,1032 @@
+// +build kubernetes
+
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/zalando/chimp/conf"
+	"github.com/zalando/chimp/kubernetes"
+	"github.com/zalando/chimp/quantity"
+	. "github.com/zalando/chimp/types"
+)
+
+//KubernetesBackend runs every app as a deployment with the name of the app, and a service exposing its ports.
+//The pods of an app are selected by the label kubernetesAppLabel. An app with its own host, or any app with ports if
+//Ingress is set, is reachable at its host through an ingress; the host of an app is the one of EndpointPattern,
+//with the namespace for the apps outside of Namespace. A host is routed to one app only.
+//The apps of a team run in the namespace NamespaceTemplate with {team} replaced by the team, the apps of the
+//callers without team in Namespace. Without template all the apps run in Namespace.
+type KubernetesBackend struct {
+	Client            *kubernetes.Client
+	Namespace         string
+	NamespaceTemplate string
+	CreateNamespaces  bool //creates the namespace of a team on its first deploy
+	Ingress           bool
+	EndpointPattern   string
+}
+
+const (
+	kubernetesAppLabel      = "chimp-app"
+	kubernetesServiceSuffix = "-service"
+	kubernetesIngressSuffix = "-ingress"
+)
+
+func NewKubernetesBackend() Backend {
+	config := conf.New()
+	token := ""
+	if config.Kubernetes.TokenFile != "" {
+		data, err := ioutil.ReadFile(config.Kubernetes.TokenFile)
+		if err != nil {
+			glog.Fatalf("Failed to read the token for kubernetes, error: %s", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	return &KubernetesBackend{Client: kubernetes.NewClient(config.Endpoint, token), Namespace: kubernetes.NamespaceDefault,
+		NamespaceTemplate: config.Kubernetes.NamespaceTemplate, CreateNamespaces: config.Kubernetes.CreateNamespaces,
+		Ingress: config.Kubernetes.Ingress, EndpointPattern: config.EndpointPattern}
+}
+
+func init() {
+	New = NewKubernetesBackend
+}
+
+//errNotSupported is returned by the operations which have no equivalent in kubernetes yet
+func errNotSupported(operation string) error {
+	return fmt.Errorf("%s is not supported by the kubernetes backend", operation)
+}
+
+//namespace returns the namespace of the apps of a team
+func (kb *KubernetesBackend) namespace(team string) string {
+	if kb.NamespaceTemplate == "" || team == "" {
+		return kb.Namespace
+	}
+	return namespaceName(strings.Replace(kb.NamespaceTemplate, "{team}", team, -1))
+}
+
+//namespaceName turns a name into a valid namespace name: at most 63 lowercase letters, digits and dashes,
+//starting and ending with a letter or a digit
+func namespaceName(name string) string {
+	valid := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name))
+	if len(valid) > 63 {
+		valid = valid[:63]
+	}
+	return strings.Trim(valid, "-")
+}
+
+//appNamespace returns the namespace of an app of the caller. Admins can access the apps of every team:
+//the app is searched in all the namespaces, the one of the caller first.
+func (kb *KubernetesBackend) appNamespace(caller Caller, name string) (string, error) {
+	namespace := kb.namespace(caller.Team)
+	if !caller.Admin || kb.NamespaceTemplate == "" {
+		return namespace, nil
+	}
+	deployments, err := kb.Client.ListDeployments(kubernetes.NamespaceAll, kubernetesAppLabel+"="+name)
+	if err != nil {
+		glog.Errorf("Could not search the namespace of %s, error: %s", name, err)
+		return "", err
+	}
+	namespaces := make([]string, len(deployments.Items))
+	for i, deployment := range deployments.Items {
+		if deployment.Metadata.Namespace == namespace {
+			return namespace, nil
+		}
+		namespaces[i] = deployment.Metadata.Namespace
+	}
+	switch len(namespaces) {
+	case 0:
+		return namespace, nil //the app is not found in the namespace of the caller
+	case 1:
+		return namespaces[0], nil
+	}
+	return "", fmt.Errorf("application %s exists in several namespaces: %s", name, strings.Join(namespaces, ", "))
+}
+
+//ensureNamespace checks that the namespace of a team exists before deploying in it, and creates it if allowed
+func (kb *KubernetesBackend) ensureNamespace(namespace string, team string) error {
+	if namespace == kb.Namespace {
+		return nil
+	}
+	_, err := kb.Client.GetNamespace(namespace)
+	if err == nil || !kubernetes.IsNotFound(err) {
+		return err
+	}
+	if !kb.CreateNamespaces {
+		return fmt.Errorf("namespace %s of team %s does not exist", namespace, team)
+	}
+	glog.Infof("Creating namespace %s of team %s", namespace, team)
+	_, err = kb.Client.CreateNamespace(&kubernetes.Namespace{Metadata: kubernetes.ObjectMeta{Name: namespace,
+		Labels: map[string]string{"team": team}}})
+	if err != nil && !kubernetes.IsAlreadyExists(err) { //created in the meantime by another deploy
+		glog.Errorf("Could not create namespace %s, error: %s", namespace, err)
+		return err
+	}
+	return nil
+}
+
+// Ping checks that the API server is reachable
+func (kb *KubernetesBackend) Ping() error {
+	_, err := kb.Client.ServerVersion()
+	return err
+}
+
+// Info returns the version of the API server
+func (kb *KubernetesBackend) Info() (*BackendInfo, error) {
+	endpoint := &EndpointStatus{URL: kb.Client.URL}
+	info := &BackendInfo{Type: "kubernetes", Endpoints: []*EndpointStatus{endpoint}}
+	version, err := kb.Client.ServerVersion()
+	if err != nil {
+		glog.Errorf("Could not get kubernetes version, error: %s", err)
+		return info, err
+	}
+	endpoint.Reachable = true
+	info.Version = version.GitVersion
+	return info, nil
+}
+
+// GetAppNames returns the names of the apps in the namespace of the caller matching all the labels of the filter.
+// The apps of all the namespaces are listed for admins not filtering by team.
+func (kb *KubernetesBackend) GetAppNames(caller Caller, filter map[string]string) ([]string, error) {
+	selectors := []string{kubernetesAppLabel}
+	for label, value := range filter {
+		if label == "uid" || (label == "team" && value == "") {
+			continue
+		}
+		selectors = append(selectors, fmt.Sprintf("%s=%s", label, value))
+	}
+	sort.Strings(selectors)
+	namespace := kb.namespace(caller.Team)
+	if caller.Admin && filter["team"] == "" && kb.NamespaceTemplate != "" {
+		namespace = kubernetes.NamespaceAll
+	}
+	deployments, err := kb.Client.ListDeployments(namespace, strings.Join(selectors, ","))
+	if err != nil {
+		glog.Errorf("Could not get deployments, error %s", err)
+		return nil, err
+	}
+	names := make([]string, len(deployments.Items))
+	for i, deployment := range deployments.Items {
+		names[i] = deployment.Metadata.Name
+	}
+	return names, nil
+}
+
+// GetApp returns an app with the state of its pods
+func (kb *KubernetesBackend) GetApp(req *ArtifactRequest) (*Artifact, error) {
+	namespace, err := kb.appNamespace(req.Caller, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := kb.Client.GetDeployment(namespace, req.Name)
+	if kubernetes.IsNotFound(err) {
+		return nil, &AppNotFoundError{Name: req.Name}
+	}
+	if err != nil {
+		glog.Errorf("Could not get deployment %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	pods, err := kb.Client.ListPods(namespace, kubernetesAppLabel+"="+req.Name)
+	if err != nil {
+		glog.Errorf("Could not get the pods of %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	var container kubernetes.Container
+	if len(deployment.Spec.Template.Spec.Containers) > 0 {
+		container = deployment.Spec.Template.Spec.Containers[0]
+	}
+	ports := readContainerPorts(container.Ports)
+	if service, err := kb.Client.GetService(namespace, req.Name+kubernetesServiceSuffix); err == nil {
+		readServicePorts(ports, service.Spec.Ports)
+	}
+	var host, endpoint string
+	if ingress, err := kb.Client.GetIngress(namespace, req.Name+kubernetesIngressSuffix); err == nil && len(ingress.Spec.Rules) > 0 {
+		endpoint = kb.endpointURL(req.Name, ingress.Spec.Rules[0].Host)
+		if !kb.Ingress || ingress.Spec.Rules[0].Host != kb.patternHost(kb.hostName(namespace, req.Name)) {
+			host = ingress.Spec.Rules[0].Host //set by the app
+		}
+	}
+
+	requested := 0
+	if deployment.Spec.Replicas != nil {
+		requested = *deployment.Spec.Replicas
+	}
+	status := "RUNNING"
+	var message string
+	replicas := make([]*Replica, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		replica, ready, reason := readPod(&pod)
+		if !ready {
+			status = "DEPLOYING/WAITING"
+			if message == "" {
+				message = reason
+			}
+		}
+		replicas = append(replicas, replica)
+	}
+	if len(replicas) != requested {
+		status = "DEPLOYING/WAITING"
+	}
+
+	env := make(map[string]string, len(container.Env))
+	for _, variable := range container.Env {
+		env[variable.Name] = variable.Value
+	}
+	labels := make(map[string]string, len(deployment.Metadata.Labels))
+	for key, value := range deployment.Metadata.Labels {
+		if key != kubernetesAppLabel {
+			labels[key] = value
+		}
+	}
+	//the quantities are the ones set by chimp, or normalized by kubernetes, so they can be parsed
+	cpus, _ := quantity.ParseCPU(container.Resources.Limits[kubernetes.ResourceCPU])
+	memory, _ := quantity.ParseMebibytes(container.Resources.Limits[kubernetes.ResourceMemory])
+	disk, _ := quantity.ParseMebibytes(container.Resources.Limits[kubernetes.ResourceEphemeralStorage])
+	return &Artifact{
+		Name:              deployment.Metadata.Name,
+		Message:           message,
+		Status:            status,
+		Labels:            &labels,
+		Env:               &env,
+		RunningReplicas:   replicas,
+		RequestedReplicas: requested,
+		CPUS:              cpus,
+		Memory:            memory,
+		Disk:              disk,
+		Endpoint:          endpoint,
+		Host:              host,
+		HealthChecks:      readProbe(container.LivenessProbe, container.Ports),
+		ImageURL:          container.Image,
+		Ports:             ports,
+		Volumes:           readVolumeMounts(container.VolumeMounts, deployment.Spec.Template.Spec.Volumes),
+		UpdateStrategy:    readRollingUpdate(deployment.Spec.Strategy.RollingUpdate),
+	}, nil
+}
+
+//readPod translates a pod into a replica, telling if it is ready and, if not, why
+func readPod(pod *kubernetes.Pod) (*Replica, bool, string) {
+	ready := pod.Status.Phase == kubernetes.PodRunning
+	reason := pod.Status.Message
+	containers := make([]*Container, 0, len(pod.Status.ContainerStatuses))
+	for _, status := range pod.Status.ContainerStatuses {
+		state, message := describeState(&status.State)
+		if !status.Ready {
+			ready = false
+			if reason == "" {
+				reason = message
+			}
+		}
+		containers = append(containers, &Container{ImageURL: status.Image, Status: state})
+	}
+	if len(containers) == 0 { //not scheduled yet
+		ready = false
+		for _, container := range pod.Spec.Containers {
+			containers = append(containers, &Container{ImageURL: container.Image, Status: "WAITING"})
+		}
+	}
+	var ports []*PortType
+	var endpoints []string
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			ports = append(ports, &PortType{Port: port.ContainerPort, Protocol: strings.ToLower(port.Protocol)})
+			if pod.Status.PodIP != "" {
+				endpoints = append(endpoints, fmt.Sprintf("http://%s:%d/", pod.Status.PodIP, port.ContainerPort))
+			}
+		}
+	}
+	status := strings.ToUpper(pod.Status.Phase)
+	if pod.Status.Phase == kubernetes.PodRunning && !ready {
+		status = "NOT READY"
+	}
+	return &Replica{ID: pod.Metadata.Name, Status: status, Endpoints: endpoints, Ports: ports, Containers: containers}, ready, reason
+}
+
+//describeState returns the state of a container, like RUNNING, and the reason if it is not running
+func describeState(state *kubernetes.ContainerState) (string, string) {
+	switch {
+	case state.Running != nil:
+		return "RUNNING", ""
+	case state.Terminated != nil:
+		return "TERMINATED", strings.TrimSpace(state.Terminated.Reason + " " + state.Terminated.Message)
+	case state.Waiting != nil:
+		return "WAITING", strings.TrimSpace(state.Waiting.Reason + " " + state.Waiting.Message)
+	default:
+		return "WAITING", ""
+	}
+}
+
+// Deploy creates the deployment, the service and the ingress of a new app. If the service or the ingress
+// cannot be created, the app is deleted again.
+func (kb *KubernetesBackend) Deploy(cr *CreateRequest) (string, error) {
+	namespace := kb.namespace(cr.Caller.Team)
+	if err := kb.ensureNamespace(namespace, cr.Caller.Team); err != nil {
+		return "", err
+	}
+	if err := kb.checkHost(namespace, &cr.BaseRequest); err != nil {
+		return "", err
+	}
+	glog.Infof("Deploying a new application with name %s", cr.Name)
+	deployment, err := kb.Client.CreateDeployment(namespace, buildDeployment(&cr.BaseRequest))
+	if err != nil {
+		glog.Errorf("Could not create deployment %s, error %s", cr.Name, err)
+		return "", err
+	}
+	err = kb.syncService(namespace, &cr.BaseRequest)
+	if err == nil {
+		err = kb.syncIngress(namespace, &cr.BaseRequest)
+	}
+	if err != nil {
+		//the app is deployed completely or not at all
+		if deleteErr := kb.deleteApp(namespace, cr.Name); deleteErr != nil {
+			return "", fmt.Errorf("%s, application %s is partially deployed as it could not be deleted: %s", err, cr.Name, deleteErr)
+		}
+		return "", err
+	}
+	glog.Infof("Application was created, %s", cr.Name)
+	return deployment.Metadata.ResourceVersion, nil
+}
+
+//buildDeployment builds the deployment of an app. The labels of the app are set on the pods too, but the pods
+//are selected only by the name of the app, so that the labels can change.
+func buildDeployment(req *BaseRequest) *kubernetes.Deployment {
+	labels := make(map[string]string, len(req.Labels)+1)
+	for key, value := range req.Labels {
+		labels[key] = value
+	}
+	labels[kubernetesAppLabel] = req.Name
+	env := make([]kubernetes.EnvVar, 0, len(req.Env))
+	for name, value := range req.Env {
+		env = append(env, kubernetes.EnvVar{Name: name, Value: value})
+	}
+	sort.Sort(byEnvName(env))
+	volumes, mounts := buildVolumes(req.Volumes)
+	liveness, readiness := buildProbes(req.HealthChecks, req.Ports)
+	replicas := req.Replicas
+	return &kubernetes.Deployment{
+		Kind:       "Deployment",
+		APIVersion: "apps/v1",
+		Metadata:   kubernetes.ObjectMeta{Name: req.Name, Labels: labels},
+		Spec: kubernetes.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &kubernetes.LabelSelector{MatchLabels: map[string]string{kubernetesAppLabel: req.Name}},
+			Template: kubernetes.PodTemplateSpec{
+				Metadata: kubernetes.ObjectMeta{Labels: labels},
+				Spec: kubernetes.PodSpec{
+					Containers: []kubernetes.Container{{
+						Name:           req.Name,
+						Image:          req.ImageURL,
+						Ports:          buildContainerPorts(req.Ports),
+						Env:            env,
+						Resources:      buildResources(req),
+						VolumeMounts:   mounts,
+						LivenessProbe:  liveness,
+						ReadinessProbe: readiness,
+					}},
+					Volumes: volumes,
+				},
+			},
+			Strategy: kubernetes.DeploymentStrategy{Type: kubernetes.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: buildRollingUpdate(req.UpdateStrategy)},
+		},
+	}
+}
+
+//buildResources reserves for the container the resources of an app, which are its limits too.
+//Resources which are not set are left to the defaults of the namespace.
+func buildResources(req *BaseRequest) kubernetes.ResourceRequirements {
+	limits := make(map[string]string, 3)
+	if req.CPULimit > 0 {
+		limits[kubernetes.ResourceCPU] = strconv.FormatFloat(req.CPULimit, 'f', -1, 64)
+	}
+	if req.MemoryLimit > 0 {
+		limits[kubernetes.ResourceMemory] = strconv.FormatFloat(req.MemoryLimit, 'f', -1, 64) + "Mi"
+	}
+	if req.DiskLimit > 0 {
+		limits[kubernetes.ResourceEphemeralStorage] = strconv.FormatFloat(req.DiskLimit, 'f', -1, 64) + "Mi"
+	}
+	if len(limits) == 0 {
+		return kubernetes.ResourceRequirements{}
+	}
+	requests := make(map[string]string, len(limits))
+	for name, value := range limits {
+		requests[name] = value
+	}
+	return kubernetes.ResourceRequirements{Limits: limits, Requests: requests}
+}
+
+//buildVolumes returns the volumes of the pod and their mounts in the container. Volumes without a host path
+//are empty directories, which live as long as the pod.
+func buildVolumes(volumes []*Volume) ([]kubernetes.Volume, []kubernetes.VolumeMount) {
+	podVolumes := make([]kubernetes.Volume, 0, len(volumes))
+	mounts := make([]kubernetes.VolumeMount, 0, len(volumes))
+	for i, volume := range volumes {
+		name := volume.Name
+		if name == "" {
+			name = fmt.Sprintf("volume-%d", i)
+		}
+		podVolume := kubernetes.Volume{Name: name}
+		if volume.HostPath != "" {
+			podVolume.HostPath = &kubernetes.HostPathVolumeSource{Path: volume.HostPath}
+		} else {
+			podVolume.EmptyDir = &kubernetes.EmptyDirVolumeSource{}
+		}
+		podVolumes = append(podVolumes, podVolume)
+		mounts = append(mounts, kubernetes.VolumeMount{Name: name, MountPath: volume.ContainerPath, ReadOnly: strings.ToUpper(volume.Mode) == "RO"})
+	}
+	return podVolumes, mounts
+}
+
+func readVolumeMounts(mounts []kubernetes.VolumeMount, podVolumes []kubernetes.Volume) []*Volume {
+	volumes := make([]*Volume, 0, len(mounts))
+	for _, mount := range mounts {
+		volume := Volume{ContainerPath: mount.MountPath, Mode: "RW"}
+		if mount.ReadOnly {
+			volume.Mode = "RO"
+		}
+		for _, podVolume := range podVolumes {
+			if podVolume.Name == mount.Name && podVolume.HostPath != nil {
+				volume.HostPath = podVolume.HostPath.Path
+			}
+		}
+		volumes = append(volumes, &volume)
+	}
+	return volumes
+}
+
+//buildProbes translates the health check of an app into the probe restarting the containers which are not alive
+//and the one sending traffic only to the ready ones. The grace period delays only the first one: a container is
+//ready as soon as its check succeeds. Kubernetes takes one probe of each, so only the first check is used.
+func buildProbes(checks []*HealthCheck, ports []Port) (liveness *kubernetes.Probe, readiness *kubernetes.Probe) {
+	liveness = buildProbe(checks, ports)
+	if liveness != nil {
+		probe := *liveness
+		probe.InitialDelaySeconds = 0
+		readiness = &probe
+	}
+	return liveness, readiness
+}
+
+func buildProbe(checks []*HealthCheck, ports []Port) *kubernetes.Probe {
+	if len(checks) == 0 {
+		return nil
+	}
+	if len(checks) > 1 {
+		glog.Warningf("Only the first of %d health checks is used by kubernetes", len(checks))
+	}
+	check := checks[0]
+	probe := kubernetes.Probe{InitialDelaySeconds: check.GracePeriodSeconds, PeriodSeconds: check.IntervalSeconds,
+		FailureThreshold: check.MaxConsecutiveFailures}
+	port := 0
+	if check.PortIndex >= 0 && check.PortIndex < len(ports) {
+		port = ports[check.PortIndex].ContainerPort
+	}
+	switch strings.ToUpper(check.Protocol) {
+	case HealthCheckTCP:
+		probe.TCPSocket = &kubernetes.TCPSocketAction{Port: port}
+	case HealthCheckCommand:
+		probe.Exec = &kubernetes.ExecAction{Command: []string{"/bin/sh", "-c", check.Command}}
+	default:
+		probe.HTTPGet = &kubernetes.HTTPGetAction{Path: check.Path, Port: port}
+	}
+	return &probe
+}
+
+func readProbe(probe *kubernetes.Probe, ports []kubernetes.ContainerPort) []*HealthCheck {
+	if probe == nil {
+		return nil
+	}
+	check := HealthCheck{IntervalSeconds: probe.PeriodSeconds, GracePeriodSeconds: probe.InitialDelaySeconds,
+		MaxConsecutiveFailures: probe.FailureThreshold}
+	port := 0
+	switch {
+	case probe.TCPSocket != nil:
+		check.Protocol = HealthCheckTCP
+		port = probe.TCPSocket.Port
+	case probe.Exec != nil && len(probe.Exec.Command) > 0:
+		check.Protocol = HealthCheckCommand
+		check.Command = probe.Exec.Command[len(probe.Exec.Command)-1]
+	case probe.HTTPGet != nil:
+		check.Protocol = HealthCheckHTTP
+		check.Path = probe.HTTPGet.Path
+		port = probe.HTTPGet.Port
+	}
+	for i, containerPort := range ports {
+		if containerPort.ContainerPort == port {
+			check.PortIndex = i
+		}
+	}
+	return []*HealthCheck{&check}
+}
+
+//buildRollingUpdate translates the update strategy of an app into the limits of a rolling update, as percentages
+//of the replicas. If no strategy is given, nil is returned and kubernetes keeps its default; the same for each limit.
+func buildRollingUpdate(strategy *UpdateStrategy) *kubernetes.RollingUpdateDeployment {
+	if strategy == nil || (strategy.MinimumHealthyCapacity == nil && strategy.MaximumOverCapacity == nil) {
+		return nil
+	}
+	rollingUpdate := kubernetes.RollingUpdateDeployment{}
+	if strategy.MinimumHealthyCapacity != nil {
+		rollingUpdate.MaxUnavailable = percentage(1 - *strategy.MinimumHealthyCapacity)
+	}
+	if strategy.MaximumOverCapacity != nil {
+		rollingUpdate.MaxSurge = percentage(*strategy.MaximumOverCapacity)
+	}
+	//kubernetes rejects a rolling update which can neither stop nor start a pod, one more pod is started then
+	if isZeroPercent(rollingUpdate.MaxUnavailable) && (rollingUpdate.MaxSurge == nil || isZeroPercent(rollingUpdate.MaxSurge)) {
+		if rollingUpdate.MaxSurge != nil {
+			glog.Warningf("A rolling update needs a maximum over capacity greater than 0 with a minimum healthy capacity of 1, 1 pod is used")
+		}
+		rollingUpdate.MaxSurge = kubernetes.FromInt(1)
+	}
+	return &rollingUpdate
+}
+
+//isZeroPercent returns true if the value is the percentage "0%"
+func isZeroPercent(value *kubernetes.IntOrString) bool {
+	return value != nil && value.IsString && value.StrVal == "0%"
+}
+
+//percentage returns a fraction as a percentage like "25%"
+func percentage(fraction float64) *kubernetes.IntOrString {
+	return kubernetes.FromString(fmt.Sprintf("%d%%", int(math.Floor(fraction*100+0.5))))
+}
+
+//readPercentage returns the fraction of a percentage like "25%", or nil if it is not a percentage
+func readPercentage(value *kubernetes.IntOrString) *float64 {
+	if value == nil || !value.IsString {
+		return nil
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%"))
+	if err != nil {
+		return nil
+	}
+	fraction := float64(percent) / 100
+	return &fraction
+}
+
+func readRollingUpdate(rollingUpdate *kubernetes.RollingUpdateDeployment) *UpdateStrategy {
+	if rollingUpdate == nil {
+		return nil
+	}
+	strategy := UpdateStrategy{MaximumOverCapacity: readPercentage(rollingUpdate.MaxSurge)}
+	if unavailable := readPercentage(rollingUpdate.MaxUnavailable); unavailable != nil {
+		minimum := 1 - *unavailable
+		strategy.MinimumHealthyCapacity = &minimum
+	}
+	if strategy.MinimumHealthyCapacity == nil && strategy.MaximumOverCapacity == nil {
+		return nil
+	}
+	return &strategy
+}
+
+type byEnvName []kubernetes.EnvVar
+
+func (env byEnvName) Len() int           { return len(env) }
+func (env byEnvName) Swap(i, j int)      { env[i], env[j] = env[j], env[i] }
+func (env byEnvName) Less(i, j int) bool { return env[i].Name < env[j].Name }
+
+func buildContainerPorts(ports []Port) []kubernetes.ContainerPort {
+	containerPorts := make([]kubernetes.ContainerPort, 0, len(ports))
+	for _, port := range ports {
+		containerPorts = append(containerPorts, kubernetes.ContainerPort{Name: port.Name, ContainerPort: port.ContainerPort,
+			HostPort: port.HostPort, Protocol: strings.ToUpper(port.ProtocolOrDefault())})
+	}
+	return containerPorts
+}
+
+func readContainerPorts(containerPorts []kubernetes.ContainerPort) []Port {
+	ports := make([]Port, 0, len(containerPorts))
+	for _, port := range containerPorts {
+		ports = append(ports, Port{ContainerPort: port.ContainerPort, Protocol: strings.ToLower(port.Protocol), Name: port.Name,
+			HostPort: port.HostPort})
+	}
+	return ports
+}
+
+//readServicePorts sets the service ports of the ports of an app from its service
+func readServicePorts(ports []Port, servicePorts []kubernetes.ServicePort) {
+	for i := range ports {
+		for _, servicePort := range servicePorts {
+			if servicePort.TargetPort == ports[i].ContainerPort && strings.ToLower(servicePort.Protocol) == ports[i].ProtocolOrDefault() {
+				ports[i].ServicePort = servicePort.Port
+			}
+		}
+	}
+}
+
+//buildService builds the service exposing the ports of an app on every node
+func buildService(req *BaseRequest) *kubernetes.Service {
+	ports := make([]kubernetes.ServicePort, 0, len(req.Ports))
+	for i, port := range req.Ports {
+		servicePort := kubernetes.ServicePort{Name: port.Name, Protocol: strings.ToUpper(port.ProtocolOrDefault()),
+			Port: port.ServicePort, TargetPort: port.ContainerPort}
+		if servicePort.Port == 0 {
+			servicePort.Port = port.ContainerPort
+		}
+		if servicePort.Name == "" && len(req.Ports) > 1 { //kubernetes requires names for more ports
+			servicePort.Name = fmt.Sprintf("port-%d", i)
+		}
+		ports = append(ports, servicePort)
+	}
+	return &kubernetes.Service{
+		Kind:       "Service",
+		APIVersion: "v1",
+		Metadata:   kubernetes.ObjectMeta{Name: req.Name + kubernetesServiceSuffix, Labels: map[string]string{kubernetesAppLabel: req.Name}},
+		Spec:       kubernetes.ServiceSpec{Type: kubernetes.ServiceTypeNodePort, Selector: map[string]string{kubernetesAppLabel: req.Name}, Ports: ports},
+	}
+}
+
+//syncService creates, updates or deletes the service of an app, depending on its ports
+func (kb *KubernetesBackend) syncService(namespace string, req *BaseRequest) error {
+	name := req.Name + kubernetesServiceSuffix
+	current, err := kb.Client.GetService(namespace, name)
+	if err != nil && !kubernetes.IsNotFound(err) {
+		glog.Errorf("Could not get service %s, error: %s", name, err)
+		return err
+	}
+	exists := err == nil
+	switch {
+	case len(req.Ports) == 0 && exists:
+		err = kb.Client.DeleteService(namespace, name)
+	case len(req.Ports) == 0:
+		return nil
+	case exists:
+		service := buildService(req)
+		service.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+		service.Spec.ClusterIP = current.Spec.ClusterIP //it cannot change
+		_, err = kb.Client.UpdateService(namespace, service)
+	default:
+		_, err = kb.Client.CreateService(namespace, buildService(req))
+	}
+	if err != nil {
+		glog.Errorf("Could not update service %s, error: %s", name, err)
+	}
+	return err
+}
+
+//patternURL returns the URL of an app from the EndpointPattern, nil without pattern
+func (kb *KubernetesBackend) patternURL(name string) *url.URL {
+	if kb.EndpointPattern == "" {
+		return nil
+	}
+	endpoint := fmt.Sprintf(kb.EndpointPattern, name)
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		glog.Errorf("Invalid endpoint pattern %s, error: %s", kb.EndpointPattern, err)
+		return nil
+	}
+	return parsed
+}
+
+//hostName returns the name of an app in the host of the EndpointPattern. The names of the apps are unique only
+//in their namespace, so the apps outside of Namespace have their namespace in the host too, like shop-team-tm.
+func (kb *KubernetesBackend) hostName(namespace string, name string) string {
+	if namespace == kb.Namespace {
+		return name
+	}
+	return name + "-" + namespace
+}
+
+//patternHost returns the host of an app from the EndpointPattern, empty without pattern
+func (kb *KubernetesBackend) patternHost(name string) string {
+	if endpoint := kb.patternURL(name); endpoint != nil {
+		return endpoint.Hostname()
+	}
+	return ""
+}
+
+//endpointURL returns the URL of an app reachable at host, with the scheme of the EndpointPattern
+func (kb *KubernetesBackend) endpointURL(name string, host string) string {
+	scheme := "https"
+	if endpoint := kb.patternURL(name); endpoint != nil {
+		scheme = endpoint.Scheme
+	}
+	return scheme + "://" + host
+}
+
+//ingressPort returns the service port receiving the HTTP requests of an app, the first TCP one
+func ingressPort(req *BaseRequest) (int, bool) {
+	for _, port := range req.Ports {
+		if port.ProtocolOrDefault() == PortProtocolTCP {
+			if port.ServicePort != 0 {
+				return port.ServicePort, true
+			}
+			return port.ContainerPort, true
+		}
+	}
+	return 0, false
+}
+
+//buildIngress builds the ingress routing the requests for host to the service of an app
+func buildIngress(req *BaseRequest, host string, port int) *kubernetes.Ingress {
+	backend := kubernetes.IngressBackend{Service: &kubernetes.IngressServiceBackend{Name: req.Name + kubernetesServiceSuffix,
+		Port: kubernetes.ServiceBackendPort{Number: port}}}
+	path := kubernetes.HTTPIngressPath{Path: "/", PathType: kubernetes.PathTypePrefix, Backend: backend}
+	return &kubernetes.Ingress{
+		Kind:       "Ingress",
+		APIVersion: "networking.k8s.io/v1",
+		Metadata:   kubernetes.ObjectMeta{Name: req.Name + kubernetesIngressSuffix, Labels: map[string]string{kubernetesAppLabel: req.Name}},
+		Spec: kubernetes.IngressSpec{Rules: []kubernetes.IngressRule{{Host: host,
+			HTTP: &kubernetes.HTTPIngressRuleValue{Paths: []kubernetes.HTTPIngressPath{path}}}}},
+	}
+}
+
+//appHost returns the host an app is reachable at: its own one or, with Ingress, the one of the EndpointPattern
+func (kb *KubernetesBackend) appHost(namespace string, req *BaseRequest) string {
+	if req.Host == "" && kb.Ingress {
+		return kb.patternHost(kb.hostName(namespace, req.Name))
+	}
+	return req.Host
+}
+
+//checkHost returns an error if the host of an app is routed already by another ingress, in any namespace,
+//so that an app cannot take the requests of another one. It is checked before the app is deployed.
+func (kb *KubernetesBackend) checkHost(namespace string, req *BaseRequest) error {
+	host := kb.appHost(namespace, req)
+	if _, hasPort := ingressPort(req); host == "" || !hasPort {
+		return nil
+	}
+	ingresses, err := kb.Client.ListIngresses(kubernetes.NamespaceAll, "")
+	if err != nil {
+		glog.Errorf("Could not list the ingresses, error: %s", err)
+		return err
+	}
+	for _, ingress := range ingresses.Items {
+		if ingress.Metadata.Namespace == namespace && ingress.Metadata.Name == req.Name+kubernetesIngressSuffix {
+			continue
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if strings.EqualFold(rule.Host, host) {
+				return fmt.Errorf("host %s of application %s is already used by ingress %s in namespace %s", host, req.Name,
+					ingress.Metadata.Name, ingress.Metadata.Namespace)
+			}
+		}
+	}
+	return nil
+}
+
+//syncIngress creates, updates or deletes the ingress of an app, depending on its host and its ports
+func (kb *KubernetesBackend) syncIngress(namespace string, req *BaseRequest) error {
+	host := kb.appHost(namespace, req)
+	port, hasPort := ingressPort(req)
+	if req.Host != "" && !hasPort {
+		return fmt.Errorf("application %s has no TCP port to be reachable at %s", req.Name, req.Host)
+	}
+	name := req.Name + kubernetesIngressSuffix
+	current, err := kb.Client.GetIngress(namespace, name)
+	if err != nil && !kubernetes.IsNotFound(err) {
+		glog.Errorf("Could not get ingress %s, error: %s", name, err)
+		return err
+	}
+	exists := err == nil
+	wanted := host != "" && hasPort
+	switch {
+	case !wanted && exists:
+		err = kb.Client.DeleteIngress(namespace, name)
+	case !wanted:
+		return nil
+	case exists:
+		ingress := buildIngress(req, host, port)
+		ingress.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+		_, err = kb.Client.UpdateIngress(namespace, ingress)
+	default:
+		_, err = kb.Client.CreateIngress(namespace, buildIngress(req, host, port))
+	}
+	if err != nil {
+		glog.Errorf("Could not update ingress %s, error: %s", name, err)
+	}
+	return err
+}
+
+// Scale sets the number of replicas of an app
+func (kb *KubernetesBackend) Scale(scale *ScaleRequest) (string, error) {
+	namespace, err := kb.appNamespace(scale.Caller, scale.Name)
+	if err != nil {
+		return "", err
+	}
+	deployment, err := kb.Client.GetDeployment(namespace, scale.Name)
+	if err != nil {
+		glog.Errorf("Could not get deployment %s, error: %s", scale.Name, err)
+		return "", err
+	}
+	replicas := scale.Replicas
+	deployment.Spec.Replicas = &replicas
+	deployment, err = kb.Client.UpdateDeployment(namespace, deployment)
+	if err != nil {
+		glog.Errorf("Could not scale application %s, error: %s", scale.Name, err)
+		return "", err
+	}
+	glog.Infof("Successfully scaled application %s to %d replicas", scale.Name, replicas)
+	return deployment.Metadata.ResourceVersion, nil
+}
+
+// Delete deletes the deployment, with its pods, the service and the ingress of an app
+func (kb *KubernetesBackend) Delete(delReq *ArtifactRequest) (string, error) {
+	namespace, err := kb.appNamespace(delReq.Caller, delReq.Name)
+	if err != nil {
+		return "", err
+	}
+	if err = kb.deleteApp(namespace, delReq.Name); err != nil {
+		return "", err
+	}
+	glog.Infof("Successfully deleted application %s", delReq.Name)
+	return "", nil
+}
+
+//deleteApp deletes the deployment, the service and the ingress of an app
+func (kb *KubernetesBackend) deleteApp(namespace string, name string) error {
+	if err := kb.Client.DeleteDeployment(namespace, name); err != nil {
+		glog.Errorf("Could not delete application %s, error: %s", name, err)
+		return err
+	}
+	if err := kb.Client.DeleteService(namespace, name+kubernetesServiceSuffix); err != nil && !kubernetes.IsNotFound(err) {
+		glog.Errorf("Could not delete the service of application %s, error: %s", name, err)
+		return err
+	}
+	if err := kb.Client.DeleteIngress(namespace, name+kubernetesIngressSuffix); err != nil && !kubernetes.IsNotFound(err) {
+		glog.Errorf("Could not delete the ingress of application %s, error: %s", name, err)
+		return err
+	}
+	return nil
+}
+
+// UpdateDeployment replaces the deployment, the service and the ingress of an app. Kubernetes replaces the pods with a rolling
+// update, within the limits of the update strategy of the app.
+func (kb *KubernetesBackend) UpdateDeployment(req *UpdateRequest) (string, error) {
+	namespace, err := kb.appNamespace(req.Caller, req.Name)
+	if err != nil {
+		return "", err
+	}
+	if err = kb.checkHost(namespace, &req.BaseRequest); err != nil {
+		return "", err
+	}
+	glog.Infof("Updating a previously deployed application")
+	current, err := kb.Client.GetDeployment(namespace, req.Name)
+	if err != nil {
+		glog.Errorf("Could not get deployment %s, error: %s", req.Name, err)
+		return "", err
+	}
+	deployment := buildDeployment(&req.BaseRequest)
+	deployment.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	updated, err := kb.Client.UpdateDeployment(namespace, deployment)
+	if err != nil {
+		glog.Errorf("Could not update application %s, error: %s", req.Name, err)
+		return "", err
+	}
+	if err = kb.syncService(namespace, &req.BaseRequest); err != nil {
+		return "", err
+	}
+	if err = kb.syncIngress(namespace, &req.BaseRequest); err != nil {
+		return "", err
+	}
+	return updated.Metadata.ResourceVersion, nil
+}
+
+// GetAppVersions is not supported yet
+func (kb *KubernetesBackend) GetAppVersions(req *ArtifactRequest) ([]string, error) {
+	return nil, errNotSupported("listing the versions of an app")
+}
+
+// Rollback is not supported yet
+func (kb *KubernetesBackend) Rollback(req *RollbackRequest) (string, error) {
+	return "", errNotSupported("rollback")
+}
+
+// GetRollout tells if the rolling update of an app is completed, from the status of its deployment.
+// The deployment ID is ignored.
+func (kb *KubernetesBackend) GetRollout(req *RolloutRequest) (*Rollout, error) {
+	namespace, err := kb.appNamespace(req.Caller, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := kb.Client.GetDeployment(namespace, req.Name)
+	if err != nil {
+		glog.Errorf("Could not get deployment %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	rollout := Rollout{Name: deployment.Metadata.Name, Deployments: make([]*RolloutDeployment, 0, 1)}
+	requested := 0
+	if deployment.Spec.Replicas != nil {
+		requested = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	for _, condition := range status.Conditions {
+		if condition.Type == kubernetes.DeploymentProgressing && condition.Reason == kubernetes.ProgressDeadlineExceeded {
+			rollout.Status = RolloutFailed
+			rollout.Message = condition.Message
+			return &rollout, nil
+		}
+	}
+	if status.ObservedGeneration >= deployment.Metadata.Generation && status.UpdatedReplicas == requested &&
+		status.AvailableReplicas == requested && status.Replicas == requested {
+		rollout.Status = RolloutDone
+		return &rollout, nil
+	}
+	rollout.Status = RolloutInProgress
+	rollout.Deployments = append(rollout.Deployments, &RolloutDeployment{
+		ID:             deployment.Metadata.ResourceVersion,
+		Version:        strconv.FormatInt(deployment.Metadata.Generation, 10),
+		CurrentStep:    status.UpdatedReplicas,
+		TotalSteps:     requested,
+		CurrentActions: []string{fmt.Sprintf("%d of %d replicas updated, %d available", status.UpdatedReplicas, requested, status.AvailableReplicas)},
+	})
+	return &rollout, nil
+}
+
+// CancelRollout is not supported yet
+func (kb *KubernetesBackend) CancelRollout(req *CancelRequest) ([]*CancelledDeployment, error) {
+	return nil, errNotSupported("cancelling a rollout")
+}
+
+// Events is not supported yet
+func (kb *KubernetesBackend) Events() (<-chan *Event, error) {
+	return nil, errNotSupported("watching the events")
+}
+
+// Kill deletes one pod of an app or, without a replica ID, all of them. Kubernetes starts new pods in place
+// of the deleted ones, unless the app is scaled down.
+func (kb *KubernetesBackend) Kill(req *KillRequest) ([]string, error) {
+	namespace, err := kb.appNamespace(req.Caller, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := kb.Client.ListPods(namespace, kubernetesAppLabel+"="+req.Name)
+	if err != nil {
+		glog.Errorf("Could not get the pods of %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	targets := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		if req.ReplicaID == "" || pod.Metadata.Name == req.ReplicaID {
+			targets = append(targets, pod.Metadata.Name)
+		}
+	}
+	if req.ReplicaID != "" && len(targets) == 0 {
+		return nil, fmt.Errorf("replica %s does not belong to application %s", req.ReplicaID, req.Name)
+	}
+	//the replicas are lowered before deleting the pods, otherwise the replica set could replace them meanwhile
+	if req.Scale && len(targets) > 0 {
+		deployment, err := kb.Client.GetDeployment(namespace, req.Name)
+		if err != nil {
+			glog.Errorf("Could not get deployment %s, error: %s", req.Name, err)
+			return nil, err
+		}
+		replicas := 1 //the default of kubernetes
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		replicas -= len(targets)
+		if replicas < 0 {
+			replicas = 0
+		}
+		deployment.Spec.Replicas = &replicas
+		if _, err = kb.Client.UpdateDeployment(namespace, deployment); err != nil {
+			glog.Errorf("Could not scale application %s, error: %s", req.Name, err)
+			return nil, err
+		}
+	}
+	killed := make([]string, 0, len(targets))
+	for _, name := range targets {
+		//the replica set may have deleted the pod already while scaling down
+		if err = kb.Client.DeletePod(namespace, name); err != nil && !kubernetes.IsNotFound(err) {
+			glog.Errorf("Could not kill replica %s of application %s, error: %s", name, req.Name, err)
+			return killed, err
+		}
+		killed = append(killed, name)
+	}
+	return killed, nil
+}
+
+// DeployGroup is not supported yet
+func (kb *KubernetesBackend) DeployGroup(req *GroupRequest) (string, error) {
+	return "", errNotSupported("deploying a group")
+}
+
+// UpdateGroup is not supported yet
+func (kb *KubernetesBackend) UpdateGroup(req *GroupRequest) (string, error) {
+	return "", errNotSupported("updating a group")
+}
+
+// GetGroup is not supported yet
+func (kb *KubernetesBackend) GetGroup(req *ArtifactRequest) (*GroupArtifact, error) {
+	return nil, errNotSupported("getting a group")
+}
+
+// DeleteGroup is not supported yet
+func (kb *KubernetesBackend) DeleteGroup(req *ArtifactRequest) (string, error) {
+	return "", errNotSupported("deleting a group")
+}
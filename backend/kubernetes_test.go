@@ -0,0 +1,454 @@
+// +build kubernetes
+
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zalando/chimp/kubernetes"
+	. "github.com/zalando/chimp/types"
+)
+
+func newTestKubernetesBackend() (*KubernetesBackend, *kubernetes.FakeServer) {
+	fake := kubernetes.NewFakeServer()
+	return &KubernetesBackend{Client: kubernetes.NewClient(fake.URL, ""), Namespace: kubernetes.NamespaceDefault}, fake
+}
+
+//addPod adds a pod of an app to the fake API server, like the deployment would do
+func addPod(t *testing.T, kb *KubernetesBackend, app string, name string, ready bool) {
+	deployment, err := kb.Client.GetDeployment(kb.Namespace, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := kubernetes.Pod{Metadata: kubernetes.ObjectMeta{Name: name, Labels: deployment.Spec.Template.Metadata.Labels},
+		Spec: deployment.Spec.Template.Spec, Status: kubernetes.PodStatus{Phase: kubernetes.PodRunning, PodIP: "10.2.0.1"}}
+	status := kubernetes.ContainerStatus{Name: app, Ready: ready, Image: deployment.Spec.Template.Spec.Containers[0].Image}
+	if ready {
+		status.State.Running = &kubernetes.ContainerStateRunning{}
+	} else {
+		status.State.Waiting = &kubernetes.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+	}
+	pod.Status.ContainerStatuses = []kubernetes.ContainerStatus{status}
+	if _, err = kb.Client.CreatePod(kb.Namespace, &pod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKubernetesDeploy(t *testing.T) {
+	kb, fake := newTestKubernetesBackend()
+	defer fake.Close()
+	req := BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 2, Labels: map[string]string{"team": "tm"},
+		Env: map[string]string{"B": "2", "A": "1"}, Ports: []Port{{ContainerPort: 8080}, {ContainerPort: 53, Protocol: PortProtocolUDP, Name: "dns"}}}
+	if _, err := kb.Deploy(&CreateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kb.Deploy(&CreateRequest{BaseRequest: req}); !kubernetes.IsAlreadyExists(err) {
+		t.Fatalf("expected the app to exist already, got %v", err)
+	}
+	kb.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "cart", ImageURL: "pierone/cart:1.0", Labels: map[string]string{"team": "other"}}})
+
+	names, err := kb.GetAppNames(Caller{}, map[string]string{"team": "tm", "uid": "someone"})
+	if err != nil || len(names) != 1 || names[0] != "shop" {
+		t.Fatalf("expected only shop for team tm, got %v, error %v", names, err)
+	}
+	if names, _ = kb.GetAppNames(Caller{}, map[string]string{"team": ""}); len(names) != 2 {
+		t.Fatalf("expected every app without a team, got %v", names)
+	}
+	if fake.Object("/api/v1/namespaces/default/services/cart-service") != nil {
+		t.Fatal("an app without ports should have no service")
+	}
+
+	addPod(t, kb, "shop", "shop-1", true)
+	artifact, err := kb.GetApp(&ArtifactRequest{Name: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact.Status != "DEPLOYING/WAITING" || len(artifact.RunningReplicas) != 1 || artifact.RequestedReplicas != 2 {
+		t.Fatalf("expected one of two replicas, got %+v", artifact)
+	}
+	addPod(t, kb, "shop", "shop-2", false)
+	artifact, _ = kb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.Status != "DEPLOYING/WAITING" || artifact.Message != "CrashLoopBackOff" || artifact.RunningReplicas[1].Status != "NOT READY" {
+		t.Fatalf("expected a replica not ready, got %+v", artifact)
+	}
+	if (*artifact.Env)["A"] != "1" || (*artifact.Labels)["team"] != "tm" || len(*artifact.Labels) != 1 || artifact.ImageURL != "pierone/shop:1.0" {
+		t.Fatalf("unexpected settings %+v", artifact)
+	}
+	if len(artifact.Ports) != 2 || artifact.Ports[1] != (Port{ContainerPort: 53, Protocol: PortProtocolUDP, Name: "dns", ServicePort: 53}) {
+		t.Fatalf("unexpected ports %+v", artifact.Ports)
+	}
+	if endpoints := artifact.RunningReplicas[0].Endpoints; len(endpoints) != 2 || endpoints[0] != "http://10.2.0.1:8080/" {
+		t.Fatalf("unexpected endpoints %v", endpoints)
+	}
+}
+
+func TestKubernetesDeploymentSpec(t *testing.T) {
+	kb, fake := newTestKubernetesBackend()
+	defer fake.Close()
+	minimum, over := 0.75, 0.5
+	req := BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 2, CPULimit: 0.5, MemoryLimit: 512, DiskLimit: 1024,
+		Ports:          []Port{{ContainerPort: 8080}, {ContainerPort: 8081}},
+		Volumes:        []*Volume{{ContainerPath: "/data", HostPath: "/var/data", Mode: "RO"}, {ContainerPath: "/tmp", Mode: "RW"}},
+		HealthChecks:   []*HealthCheck{{Protocol: HealthCheckHTTP, Path: "/health", PortIndex: 1, IntervalSeconds: 10, GracePeriodSeconds: 30, MaxConsecutiveFailures: 3}},
+		UpdateStrategy: &UpdateStrategy{MinimumHealthyCapacity: &minimum, MaximumOverCapacity: &over}}
+	if _, err := kb.Deploy(&CreateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := kb.Client.GetDeployment(kb.Namespace, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Selector.MatchLabels[kubernetesAppLabel] != "shop" || len(deployment.Spec.Selector.MatchLabels) != 1 {
+		t.Fatalf("the pods should be selected by the name of the app, got %v", deployment.Spec.Selector.MatchLabels)
+	}
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if container.Resources.Requests["cpu"] != "0.5" || container.Resources.Limits["memory"] != "512Mi" ||
+		container.Resources.Limits["ephemeral-storage"] != "1024Mi" {
+		t.Fatalf("unexpected resources %+v", container.Resources)
+	}
+	if probe := container.LivenessProbe; probe == nil || probe.HTTPGet.Port != 8081 || probe.InitialDelaySeconds != 30 {
+		t.Fatalf("unexpected liveness probe %+v", probe)
+	}
+	if probe := container.ReadinessProbe; probe == nil || probe.HTTPGet.Port != 8081 || probe.InitialDelaySeconds != 0 || probe.PeriodSeconds != 10 {
+		t.Fatalf("the readiness probe should not wait for the grace period, got %+v", probe)
+	}
+	if volumes := deployment.Spec.Template.Spec.Volumes; len(volumes) != 2 || volumes[0].HostPath.Path != "/var/data" || volumes[1].EmptyDir == nil ||
+		!container.VolumeMounts[0].ReadOnly {
+		t.Fatalf("unexpected volumes %+v, mounts %+v", volumes, container.VolumeMounts)
+	}
+	if strategy := deployment.Spec.Strategy; strategy.RollingUpdate.MaxUnavailable.StrVal != "25%" || strategy.RollingUpdate.MaxSurge.StrVal != "50%" {
+		t.Fatalf("unexpected strategy %+v", strategy.RollingUpdate)
+	}
+
+	//the settings read back are the ones deployed
+	artifact, err := kb.GetApp(&ArtifactRequest{Name: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact.CPUS != 0.5 || artifact.Memory != 512 || artifact.Disk != 1024 || *artifact.HealthChecks[0] != *req.HealthChecks[0] ||
+		*artifact.Volumes[0] != *req.Volumes[0] || *artifact.Volumes[1] != *req.Volumes[1] ||
+		*artifact.UpdateStrategy.MinimumHealthyCapacity != minimum || *artifact.UpdateStrategy.MaximumOverCapacity != over {
+		t.Fatalf("unexpected artifact %+v", artifact)
+	}
+
+	//the update is rolled out by kubernetes, the pods are not deleted
+	addPod(t, kb, "shop", "shop-1", true)
+	req.ImageURL = "pierone/shop:2.0"
+	if _, err = kb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	if pods, _ := kb.Client.ListPods(kb.Namespace, ""); len(pods.Items) != 1 {
+		t.Fatalf("expected the pods to be kept, got %+v", pods.Items)
+	}
+	rollout, err := kb.GetRollout(&RolloutRequest{Name: "shop"})
+	if err != nil || rollout.Status != RolloutInProgress || len(rollout.Deployments) != 1 {
+		t.Fatalf("expected a rollout in progress, got %+v, error %v", rollout, err)
+	}
+	deployment, _ = kb.Client.GetDeployment(kb.Namespace, "shop")
+	deployment.Status = kubernetes.DeploymentStatus{ObservedGeneration: deployment.Metadata.Generation, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+	kb.Client.UpdateDeployment(kb.Namespace, deployment)
+	if rollout, _ = kb.GetRollout(&RolloutRequest{Name: "shop"}); rollout.Status != RolloutDone {
+		t.Fatalf("expected the rollout to be done, got %+v", rollout)
+	}
+	deployment, _ = kb.Client.GetDeployment(kb.Namespace, "shop")
+	deployment.Status.Conditions = []kubernetes.DeploymentCondition{{Type: kubernetes.DeploymentProgressing, Status: "False",
+		Reason: kubernetes.ProgressDeadlineExceeded, Message: "deadline exceeded"}}
+	kb.Client.UpdateDeployment(kb.Namespace, deployment)
+	if rollout, _ = kb.GetRollout(&RolloutRequest{Name: "shop"}); rollout.Status != RolloutFailed || rollout.Message != "deadline exceeded" {
+		t.Fatalf("expected the rollout to fail, got %+v", rollout)
+	}
+}
+
+func TestBuildRollingUpdate(t *testing.T) {
+	fraction := func(f float64) *float64 { return &f }
+	for i, test := range []struct {
+		strategy                 *UpdateStrategy
+		maxUnavailable, maxSurge string
+	}{
+		{&UpdateStrategy{MinimumHealthyCapacity: fraction(0.75)}, "25%", ""},
+		{&UpdateStrategy{MaximumOverCapacity: fraction(0)}, "", "0%"},
+		{&UpdateStrategy{MinimumHealthyCapacity: fraction(1), MaximumOverCapacity: fraction(0.2)}, "0%", "20%"},
+		//kubernetes needs to be able to start a pod when none can be stopped
+		{&UpdateStrategy{MinimumHealthyCapacity: fraction(1)}, "0%", "1"},
+		{&UpdateStrategy{MinimumHealthyCapacity: fraction(1), MaximumOverCapacity: fraction(0)}, "0%", "1"},
+	} {
+		rollingUpdate := buildRollingUpdate(test.strategy)
+		value := func(v *kubernetes.IntOrString) string {
+			if v == nil {
+				return ""
+			}
+			data, _ := v.MarshalJSON()
+			return strings.Trim(string(data), `"`)
+		}
+		if value(rollingUpdate.MaxUnavailable) != test.maxUnavailable || value(rollingUpdate.MaxSurge) != test.maxSurge {
+			t.Errorf("strategy %d: expected %q unavailable and %q surge, got %+v", i, test.maxUnavailable, test.maxSurge, rollingUpdate)
+		}
+	}
+	if buildRollingUpdate(&UpdateStrategy{}) != nil {
+		t.Error("an empty strategy should be left to kubernetes")
+	}
+}
+
+func TestKubernetesDeployRollback(t *testing.T) {
+	kb, fake := newTestKubernetesBackend()
+	defer fake.Close()
+	//the service is created, the ingress is not as the host has no TCP port
+	req := BaseRequest{Name: "dns", ImageURL: "pierone/dns:1.0", Host: "dns.example.org", Ports: []Port{{ContainerPort: 53, Protocol: PortProtocolUDP}}}
+	if _, err := kb.Deploy(&CreateRequest{BaseRequest: req}); err == nil {
+		t.Fatal("expected the ingress to fail")
+	}
+	if fake.Object("/apis/apps/v1/namespaces/default/deployments/dns") != nil || fake.Object("/api/v1/namespaces/default/services/dns-service") != nil {
+		t.Fatal("expected the app to be deleted again")
+	}
+	if indexOf(fake.Requests, "POST /api/v1/namespaces/default/services") < 0 {
+		t.Fatalf("expected the service to be created first, got %v", fake.Requests)
+	}
+}
+
+//indexOf returns the position of a string in a slice, or -1
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestKubernetesScaleUpdateDelete(t *testing.T) {
+	kb, fake := newTestKubernetesBackend()
+	defer fake.Close()
+	req := BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 1, Ports: []Port{{ContainerPort: 8080}}}
+	if _, err := kb.Deploy(&CreateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kb.Scale(&ScaleRequest{Name: "shop", Replicas: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if artifact, _ := kb.GetApp(&ArtifactRequest{Name: "shop"}); artifact.RequestedReplicas != 3 {
+		t.Fatalf("expected 3 replicas, got %d", artifact.RequestedReplicas)
+	}
+	if _, err := kb.Scale(&ScaleRequest{Name: "missing", Replicas: 3}); !kubernetes.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	addPod(t, kb, "shop", "shop-1", true)
+	req.ImageURL = "pierone/shop:2.0"
+	req.Ports = nil
+	if _, err := kb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	artifact, _ := kb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.ImageURL != "pierone/shop:2.0" || artifact.RequestedReplicas != 1 {
+		t.Fatalf("expected the new image, got %+v", artifact)
+	}
+	if fake.Object("/api/v1/namespaces/default/services/shop-service") != nil {
+		t.Fatal("the service should be deleted with the ports")
+	}
+
+	if _, err := kb.Kill(&KillRequest{Name: "shop", ReplicaID: "other-1"}); err == nil {
+		t.Fatal("the replicas of other apps should not be killed")
+	}
+	//without replicas in the spec kubernetes runs one
+	deployment, _ := kb.Client.GetDeployment(kb.Namespace, "shop")
+	deployment.Spec.Replicas = nil
+	if _, err := kb.Client.UpdateDeployment(kb.Namespace, deployment); err != nil {
+		t.Fatal(err)
+	}
+	fake.Requests = nil
+	if killed, err := kb.Kill(&KillRequest{Name: "shop", ReplicaID: "shop-1", Scale: true}); err != nil || len(killed) != 1 {
+		t.Fatalf("expected shop-1 to be killed, got %v, error %v", killed, err)
+	}
+	if artifact, _ = kb.GetApp(&ArtifactRequest{Name: "shop"}); artifact.RequestedReplicas != 0 {
+		t.Fatalf("expected the app to be scaled down, got %d", artifact.RequestedReplicas)
+	}
+	if scaled, deleted := indexOf(fake.Requests, "PUT /apis/apps/v1/namespaces/default/deployments/shop"),
+		indexOf(fake.Requests, "DELETE /api/v1/namespaces/default/pods/shop-1"); scaled < 0 || deleted < scaled {
+		t.Fatalf("expected the app to be scaled down before killing the pod, got %v", fake.Requests)
+	}
+
+	if _, err := kb.Delete(&ArtifactRequest{Name: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kb.GetApp(&ArtifactRequest{Name: "shop"}); !IsAppNotFound(err) {
+		t.Fatalf("expected the app to be deleted, got %v", err)
+	}
+}
+
+func TestKubernetesNamespaces(t *testing.T) {
+	kb, fake := newTestKubernetesBackend()
+	defer fake.Close()
+	kb.NamespaceTemplate = "team-{team}"
+	tm, other, admin := Caller{Team: "tm"}, Caller{Team: "Other_Team"}, Caller{Team: "ops", Admin: true}
+
+	//without permission to create it the namespace of the team must exist
+	deploy := func(caller Caller) error {
+		_, err := kb.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 1,
+			Labels: map[string]string{"team": caller.Team}, Caller: caller}})
+		return err
+	}
+	if err := deploy(tm); err == nil {
+		t.Fatal("expected the deploy to fail without the namespace")
+	}
+	kb.CreateNamespaces = true
+	if err := deploy(tm); err != nil {
+		t.Fatal(err)
+	}
+	if err := deploy(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kb.Client.GetDeployment("team-tm", "shop"); err != nil {
+		t.Fatalf("expected shop in the namespace of tm, got %v", err)
+	}
+	if _, err := kb.Client.GetNamespace("team-other-team"); err != nil {
+		t.Fatalf("expected a valid namespace for Other_Team, got %v", err)
+	}
+
+	//the callers see only the apps of their namespace, unless they are admins
+	if names, _ := kb.GetAppNames(tm, map[string]string{}); len(names) != 1 {
+		t.Fatalf("expected only the app of tm, got %v", names)
+	}
+	if names, _ := kb.GetAppNames(Caller{Team: "nobody"}, map[string]string{}); len(names) != 0 {
+		t.Fatalf("expected no apps in a namespace without deployments, got %v", names)
+	}
+	if names, _ := kb.GetAppNames(admin, map[string]string{}); len(names) != 2 {
+		t.Fatalf("expected the admin to see all the apps, got %v", names)
+	}
+	if names, _ := kb.GetAppNames(admin, map[string]string{"team": "ops"}); len(names) != 0 {
+		t.Fatalf("expected the admin to see only its apps filtering by team, got %v", names)
+	}
+	if _, err := kb.GetApp(&ArtifactRequest{Name: "shop", Caller: Caller{Team: "nobody"}}); !IsAppNotFound(err) {
+		t.Fatalf("expected the app of another team not to be found, got %v", err)
+	}
+
+	//the app of an admin is not ambiguous, the one of other teams is
+	if _, err := kb.GetApp(&ArtifactRequest{Name: "shop", Caller: admin}); err == nil {
+		t.Fatal("expected an error for an app in several namespaces")
+	}
+	if _, err := kb.Delete(&ArtifactRequest{Name: "shop", Caller: tm}); err != nil {
+		t.Fatal(err)
+	}
+	artifact, err := kb.GetApp(&ArtifactRequest{Name: "shop", Caller: admin})
+	if err != nil || (*artifact.Labels)["team"] != "Other_Team" {
+		t.Fatalf("expected the admin to get the app of Other_Team, got %+v, error %v", artifact, err)
+	}
+	if _, err = kb.Delete(&ArtifactRequest{Name: "shop", Caller: admin}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = kb.Client.GetDeployment("team-other-team", "shop"); !kubernetes.IsNotFound(err) {
+		t.Fatalf("expected the admin to delete the app of Other_Team, got %v", err)
+	}
+}
+
+func TestKubernetesIngress(t *testing.T) {
+	kb, fake := newTestKubernetesBackend()
+	defer fake.Close()
+	kb.EndpointPattern = "http://%s.example.org"
+	const ingressPath = "/apis/networking.k8s.io/v1/namespaces/default/ingresses/shop-ingress"
+	req := BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 1,
+		Ports: []Port{{ContainerPort: 53, Protocol: PortProtocolUDP}, {ContainerPort: 8080, ServicePort: 80}}}
+
+	//without ingresses enabled only the apps with their own host get one
+	if _, err := kb.Deploy(&CreateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	if artifact, _ := kb.GetApp(&ArtifactRequest{Name: "shop"}); fake.Object(ingressPath) != nil || artifact.Endpoint != "" {
+		t.Fatalf("expected no ingress, got endpoint %s", artifact.Endpoint)
+	}
+	kb.Ingress = true
+	if _, err := kb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	ingress, err := kb.Client.GetIngress(kb.Namespace, "shop-ingress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := ingress.Spec.Rules[0]
+	if rule.Host != "shop.example.org" || rule.HTTP.Paths[0].Backend.Service.Name != "shop-service" || rule.HTTP.Paths[0].Backend.Service.Port.Number != 80 {
+		t.Fatalf("expected the host of the pattern and the first tcp port, got %+v", rule)
+	}
+	artifact, _ := kb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.Endpoint != "http://shop.example.org" || artifact.Host != "" {
+		t.Fatalf("unexpected endpoint %s, host %s", artifact.Endpoint, artifact.Host)
+	}
+
+	//the host of the app wins over the pattern
+	req.Host = "shop.example.com"
+	if _, err = kb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	artifact, _ = kb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.Endpoint != "http://shop.example.com" || artifact.Host != "shop.example.com" {
+		t.Fatalf("unexpected endpoint %s, host %s", artifact.Endpoint, artifact.Host)
+	}
+
+	//without a tcp port the app has no ingress
+	req.Host = ""
+	req.Ports = req.Ports[:1]
+	if _, err = kb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Object(ingressPath) != nil {
+		t.Fatal("expected the ingress to be deleted")
+	}
+	req.Host = "shop.example.com"
+	if _, err = kb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err == nil {
+		t.Fatal("expected an error for a host without tcp ports")
+	}
+
+	//delete removes the service and the ingress too
+	req.Ports = []Port{{ContainerPort: 8080}}
+	if _, err = kb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = kb.Delete(&ArtifactRequest{Name: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Object(ingressPath) != nil || fake.Object("/api/v1/namespaces/default/services/shop-service") != nil {
+		t.Fatal("expected the ingress and the service to be deleted")
+	}
+}
+
+func TestKubernetesIngressNamespaces(t *testing.T) {
+	kb, fake := newTestKubernetesBackend()
+	defer fake.Close()
+	kb.EndpointPattern = "https://%s.example.org"
+	kb.NamespaceTemplate = "team-{team}"
+	kb.CreateNamespaces = true
+	kb.Ingress = true
+	deploy := func(team string, host string) error {
+		_, err := kb.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 1,
+			Ports: []Port{{ContainerPort: 8080}}, Host: host, Caller: Caller{Team: team}}})
+		return err
+	}
+
+	//the apps with the same name in different namespaces have different hosts
+	for _, team := range []string{"", "tm"} {
+		if err := deploy(team, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for namespace, host := range map[string]string{"default": "shop.example.org", "team-tm": "shop-team-tm.example.org"} {
+		if ingress, err := kb.Client.GetIngress(namespace, "shop-ingress"); err != nil || ingress.Spec.Rules[0].Host != host {
+			t.Fatalf("expected host %s in namespace %s, got %+v, error %v", host, namespace, ingress, err)
+		}
+	}
+	artifact, err := kb.GetApp(&ArtifactRequest{Name: "shop", Caller: Caller{Team: "tm"}})
+	if err != nil || artifact.Endpoint != "https://shop-team-tm.example.org" || artifact.Host != "" {
+		t.Fatalf("expected the host of the pattern, got %+v, error %v", artifact, err)
+	}
+
+	//a host cannot be taken from the app of another namespace, it can be kept by the app using it
+	if err = deploy("other", "shop-team-tm.example.org"); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected the host of another namespace to be rejected, got %v", err)
+	}
+	if _, err = kb.Client.GetDeployment("team-other", "shop"); !kubernetes.IsNotFound(err) {
+		t.Fatalf("expected the app with a used host not to be deployed, got %v", err)
+	}
+	_, err = kb.UpdateDeployment(&UpdateRequest{BaseRequest: BaseRequest{Name: "shop", ImageURL: "pierone/shop:2.0", Replicas: 1,
+		Ports: []Port{{ContainerPort: 8080}}, Host: "SHOP-team-tm.example.org", Caller: Caller{Team: "tm"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/zalando/chimp/conf"
+	. "github.com/zalando/chimp/types"
+)
+
+//LogContext contains what is known about a replica to build the links to its logs
+type LogContext struct {
+	App           string
+	TaskID        string
+	Host          string
+	ContainerName string //empty if it could not be found
+}
+
+//LogLinkProvider builds the link to the logs of a replica in a log management system
+type LogLinkProvider interface {
+	Name() string
+	//Link returns the link to the logs of the replica, false if it cannot be built with the given context
+	Link(ctx *LogContext) (string, bool)
+}
+
+//templateLinkProvider builds links by replacing the placeholders of a URL template with the
+//query escaped values of the context: {app}, {taskID}, {host}, {shortHost} and {containerName}
+type templateLinkProvider struct {
+	name     string
+	template string
+}
+
+//NewLogLinkProviders returns a provider for each configured log link
+func NewLogLinkProviders(links []conf.LogLink) []LogLinkProvider {
+	providers := make([]LogLinkProvider, 0, len(links))
+	for _, link := range links {
+		providers = append(providers, &templateLinkProvider{name: link.Name, template: link.URLTemplate})
+	}
+	return providers
+}
+
+func (p *templateLinkProvider) Name() string {
+	return p.name
+}
+
+func (p *templateLinkProvider) Link(ctx *LogContext) (string, bool) {
+	if ctx.ContainerName == "" && strings.Contains(p.template, "{containerName}") {
+		return "", false
+	}
+	replacer := strings.NewReplacer(
+		"{app}", url.QueryEscape(strings.TrimPrefix(ctx.App, "/")),
+		"{taskID}", url.QueryEscape(ctx.TaskID),
+		"{host}", url.QueryEscape(ctx.Host),
+		"{shortHost}", url.QueryEscape(strings.Split(ctx.Host, ".")[0]),
+		"{containerName}", url.QueryEscape(ctx.ContainerName))
+	return replacer.Replace(p.template), true
+}
+
+//buildLogLinks returns the links to the logs of a replica of every provider able to build one
+func buildLogLinks(providers []LogLinkProvider, ctx *LogContext) []*LogLink {
+	links := make([]*LogLink, 0, len(providers))
+	for _, provider := range providers {
+		if link, ok := provider.Link(ctx); ok {
+			links = append(links, &LogLink{Name: provider.Name(), URL: link})
+		}
+	}
+	return links
+}
@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/zalando/chimp/conf"
+)
+
+func TestBuildLogLinks(t *testing.T) {
+	providers := NewLogLinkProviders([]conf.LogLink{
+		conf.LogLink{Name: "kibana", URLTemplate: "https://kibana.example.org/app/logs?query=app:{app}%20AND%20task:{taskID}"},
+		conf.LogLink{Name: "scalyr", URLTemplate: "https://www.scalyr.com/events?filter=$logfile%3D%27{containerName}%27%20$serverHost%3D%27{shortHost}%27"},
+	})
+	ctx := &LogContext{App: "/team/app", TaskID: "team_app.1", Host: "node1.example.org", ContainerName: "mesos-1"}
+	links := buildLogLinks(providers, ctx)
+	if len(links) != 2 {
+		t.Fatalf("expected 2 links, got %d", len(links))
+	}
+	if links[0].Name != "kibana" || links[0].URL != "https://kibana.example.org/app/logs?query=app:team%2Fapp%20AND%20task:team_app.1" {
+		t.Errorf("unexpected link %+v", links[0])
+	}
+	if links[1].URL != "https://www.scalyr.com/events?filter=$logfile%3D%27mesos-1%27%20$serverHost%3D%27node1%27" {
+		t.Errorf("unexpected link %+v", links[1])
+	}
+
+	ctx.ContainerName = ""
+	if links = buildLogLinks(providers, ctx); len(links) != 1 || links[0].Name != "kibana" {
+		t.Errorf("expected only the link without container name, got %+v", links)
+	}
+}
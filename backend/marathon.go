@@ -3,12 +3,17 @@
 package backend
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	marathon "github.com/gambol99/go-marathon"
 	"github.com/golang/glog"
@@ -18,12 +23,18 @@ import (
 
 //MarathonBackend is the wrapper for the marathon API
 type MarathonBackend struct {
-	Client marathon.Marathon
+	Client   marathon.Marathon
+	LogLinks []LogLinkProvider
+	agents   *agentStateCache
+	api      *marathonAPI
 }
 
 func NewMarathonBackend() Backend {
 	ma := &MarathonBackend{}
 	ma.Client = initMarathonClient()
+	ma.LogLinks = NewLogLinkProviders(conf.New().LogLinks)
+	ma.agents = newAgentStateCache()
+	ma.api = newMarathonAPI(conf.New())
 	return ma
 }
 
@@ -31,12 +42,16 @@ func init() {
 	New = NewMarathonBackend
 }
 
-// Constants
-// DOCKERCFG to access private docker repo to pull docker images
-// MARATHONURL to access mesos/marathon cluster
+//endpointPingTimeout is the maximum time to wait for a marathon endpoint to answer a ping
+const endpointPingTimeout = 2 * time.Second
+
+//marathonRequestTimeout is the maximum time to wait for marathon to answer a request
+const marathonRequestTimeout = 30 * time.Second
+
+//capacities used by marathon for an upgrade strategy without them
 const (
-	DOCKERCFG     string = "file:///root/.dockercfg"
-	DOCKERVERSION string = "1.9"
+	marathonMinimumHealthCapacity = 1.0
+	marathonMaximumOverCapacity   = 1.0
 )
 
 // getMarathonClient connects to mesos cluster
@@ -46,10 +61,22 @@ func initMarathonClient() marathon.Marathon {
 	config := marathon.NewDefaultConfig()
 	chimpConfig := conf.New()
 	config.URL = chimpConfig.Endpoint
+	config.HTTPClient = newMarathonHTTPClient(marathonRequestTimeout)
 	if chimpConfig.MarathonAuth.Enabled {
 		config.HTTPBasicAuthUser = chimpConfig.MarathonAuth.MarathonHttpUser
 		config.HTTPBasicPassword = chimpConfig.MarathonAuth.MarathonHttpPassword
 	}
+	if chimpConfig.MarathonEvents.Transport == "callback" {
+		config.EventsTransport = marathon.EventsTransportCallback
+		if chimpConfig.MarathonEvents.Interface != "" {
+			config.EventsInterface = chimpConfig.MarathonEvents.Interface
+		}
+		if chimpConfig.MarathonEvents.Port != 0 {
+			config.EventsPort = chimpConfig.MarathonEvents.Port
+		}
+	} else {
+		config.EventsTransport = marathon.EventsTransportSSE
+	}
 	client, err := marathon.NewClient(config)
 	if err != nil {
 		glog.Fatalf("Failed to create a client for marathon, error: %s", err)
@@ -57,18 +84,111 @@ func initMarathonClient() marathon.Marathon {
 	return client
 }
 
+//newMarathonHTTPClient returns the client used to call marathon. Connecting and waiting for an answer are limited
+//by the timeout, reading the body is not: the event stream uses the same client and stays open.
+func newMarathonHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		Dial:                  (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).Dial,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}}
+}
+
+// Ping checks that marathon is reachable and has a leader, which is needed to serve any request
+func (mb *MarathonBackend) Ping() error {
+	if _, err := mb.Client.Ping(); err != nil {
+		return err
+	}
+	leader, err := mb.Client.Leader()
+	if err != nil {
+		return err
+	}
+	if leader == "" {
+		return errors.New("marathon has no leader")
+	}
+	return nil
+}
+
+// Info returns the version and the leader of marathon and which of the configured endpoints are reachable
+func (mb *MarathonBackend) Info() (*BackendInfo, error) {
+	info := &BackendInfo{Type: "marathon", Endpoints: pingEndpoints(conf.New())}
+	marathonInfo, err := mb.Client.Info()
+	if err != nil {
+		glog.Errorf("Could not get marathon info, error: %s", err)
+		return info, err
+	}
+	info.Version = marathonInfo.Version
+	info.Leader = marathonInfo.Leader
+	return info, nil
+}
+
+//endpointURLs splits the marathon endpoint of the configuration, like "http://host1:8080,host2:8080", into the URLs of each host
+func endpointURLs(config *conf.Config) ([]string, error) {
+	marathonURL, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	hosts := strings.Split(marathonURL.Host, ",")
+	urls := make([]string, len(hosts))
+	for i, host := range hosts {
+		urls[i] = fmt.Sprintf("%s://%s%s", marathonURL.Scheme, host, strings.TrimSuffix(marathonURL.Path, "/"))
+	}
+	return urls, nil
+}
+
+//pingEndpoints pings all the marathon endpoints in the configuration, like "http://host1:8080,host2:8080", in parallel
+func pingEndpoints(config *conf.Config) []*EndpointStatus {
+	urls, err := endpointURLs(config)
+	if err != nil {
+		return []*EndpointStatus{&EndpointStatus{URL: config.Endpoint}}
+	}
+	endpoints := make([]*EndpointStatus, len(urls))
+	client := &http.Client{Timeout: endpointPingTimeout}
+	var wg sync.WaitGroup
+	for i, endpointURL := range urls {
+		endpoints[i] = &EndpointStatus{URL: endpointURL}
+		wg.Add(1)
+		go func(endpoint *EndpointStatus) {
+			defer wg.Done()
+			req, err := http.NewRequest("GET", endpoint.URL+"/ping", nil)
+			if err != nil {
+				return
+			}
+			if config.MarathonAuth.Enabled {
+				req.SetBasicAuth(config.MarathonAuth.MarathonHttpUser, config.MarathonAuth.MarathonHttpPassword)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				glog.Warningf("Marathon endpoint %s is not reachable, error: %s", endpoint.URL, err)
+				return
+			}
+			res.Body.Close()
+			endpoint.Reachable = res.StatusCode == http.StatusOK
+		}(endpoints[i])
+	}
+	wg.Wait()
+	return endpoints
+}
+
 // GetAppNames returns all currently listed applications from marathon
 // marathon.Applications is a struct with a lot of details
 // about all listed applications
-func (mb *MarathonBackend) GetAppNames(filter map[string]string) ([]string, error) {
+func (mb *MarathonBackend) GetAppNames(caller Caller, filter map[string]string) ([]string, error) {
 	marathonFilter := make(url.Values, 1)
 	var arr []string
 
-	if filter["team"] != "" {
-		arr = append(arr, fmt.Sprintf("team==%s", filter["team"]))
+	for label, value := range filter {
+		if label == "uid" || (label == "team" && value == "") {
+			continue
+		}
+		arr = append(arr, fmt.Sprintf("%s==%s", label, value))
 	}
+	sort.Strings(arr)
 
-	marathonFilter["label"] = arr
+	if len(arr) > 0 { //marathon takes all the selectors in one parameter
+		marathonFilter["label"] = []string{strings.Join(arr, ",")}
+	}
 	applications, err := mb.Client.Applications(marathonFilter)
 	if err != nil {
 		glog.Errorf("Could not get applications, error %s", err)
@@ -85,11 +205,13 @@ func (mb *MarathonBackend) GetAppNames(filter map[string]string) ([]string, erro
 // marathon.Application is a struct with a lot of details
 // about the application itself
 func (mb *MarathonBackend) GetApp(req *ArtifactRequest) (*Artifact, error) {
-	application, err := mb.Client.Application(req.Name)
+	//the application is read without the marathon client, which drops the names of the ports
+	named, err := mb.api.application(req.Name)
 	if err != nil {
 		glog.Errorf("Could not get application %s, error: %s", req.Name, err)
 		return nil, err
 	}
+	application := named.clientApplication()
 	var status = "RUNNING" //this is just our base case. we then check the status below
 	var message string
 	if !application.AllTaskRunning() {
@@ -105,46 +227,74 @@ func (mb *MarathonBackend) GetApp(req *ArtifactRequest) (*Artifact, error) {
 	}
 	endpoints := make([]string, 0, len(application.Tasks))
 
+	//the container names are looked up on the mesos agents all together
+	locations := make([]taskLocation, 0, len(application.Tasks))
+	for _, task := range application.Tasks {
+		locations = append(locations, taskLocation{Host: task.Host, TaskID: task.ID})
+	}
+	containerNames, lookupErrors := mb.agents.containerNames(locations)
+
 	//transforming the data coming from kubernetes into chimp structure
 	replicas := make([]*Replica, 0, len(application.Tasks))
-	for _, replica := range application.Tasks {
+	for i, replica := range application.Tasks {
 		//copying container data structure
 		containers := make([]*Container, 0, 1)
 		status := true
 		statString := "OK"
+		healthResults := make([]*HealthCheckResult, 0, len(replica.HealthCheckResults))
 		for _, hc := range replica.HealthCheckResults {
+			if hc == nil { //marathon returns null for checks without a result yet
+				healthResults = append(healthResults, nil)
+				continue
+			}
 			if hc.Alive == false {
 				status = false
 			}
+			healthResults = append(healthResults, &HealthCheckResult{Alive: hc.Alive, ConsecutiveFailures: hc.ConsecutiveFailures,
+				LastSuccess: hc.LastSuccess, LastFailure: hc.LastFailure})
 		}
 		if !status {
 			statString = "NOT ALIVE"
 		}
 
-		containerName, err := buildContainerName(replica.Host, replica.ID)
+		containerName := containerNames[i]
 		logInfo := map[string]string{}
-		if err == nil { //If the URL cannot be build I don't want to encounter any other problem
-			remoteURL := "https://www.scalyr.com/events?mode=log&filter=$logfile%3D%27%2Ffluentd%2F%2F" + containerName + "%27%20$serverHost%3D%27" + strings.Split(replica.Host, ".")[0] + "%27"
-			logInfo = map[string]string{"containerName": containerName, "remoteURL": remoteURL}
+		var warnings []string
+		if lookupErrors[i] == nil {
+			logInfo["containerName"] = containerName
+		} else { //If the name cannot be found only the links without it are built
+			glog.Warningf("Could not get the container of replica %s, error: %s", replica.ID, lookupErrors[i])
+			warnings = append(warnings, lookupErrors[i].Error())
+		}
+		logLinks := buildLogLinks(mb.LogLinks, &LogContext{App: application.ID, TaskID: replica.ID, Host: replica.Host, ContainerName: containerName})
+		if len(logLinks) > 0 { //kept for the clients reading the single link
+			logInfo["remoteURL"] = logLinks[0].URL
 		}
 
 		container := Container{
 			ImageURL: application.Container.Docker.Image,
 			Status:   statString,
 			LogInfo:  logInfo,
+			LogLinks: logLinks,
 		}
 		containers = append(containers, &container)
 
 		ports := make([]*PortType, 0, len(replica.Ports))
-		for _, port := range replica.Ports {
-			ports = append(ports, &PortType{Port: port, Protocol: ""})
+		for j, port := range replica.Ports {
+			ports = append(ports, &PortType{Port: port, Protocol: portProtocol(application, j)})
 		}
 		endpoints = append(endpoints, fmt.Sprintf("http://%s:%s/", replica.Host, intslice2str(replica.Ports, "")))
-		replica := Replica{Status: statString, Containers: containers, Endpoints: endpoints, Ports: ports} //HACK, this shouldn't be added only one time
+		replica := Replica{ID: replica.ID, Status: statString, Containers: containers, Endpoints: endpoints, Ports: ports, HealthChecks: healthResults,
+			Warnings: warnings} //HACK, this shouldn't be added only one time
 		endpoints = nil
 		replicas = append(replicas, &replica)
 	}
 
+	disk := 0.0
+	if application.Disk != nil {
+		disk = *application.Disk
+	}
+
 	var ep string
 	if strings.HasPrefix(application.ID, "/") {
 		ep = application.ID[1:len(application.ID)]
@@ -163,7 +313,15 @@ func (mb *MarathonBackend) GetApp(req *ArtifactRequest) (*Artifact, error) {
 		RequestedReplicas: *application.Instances,
 		CPUS:              application.CPUs,
 		Memory:            *application.Mem,
+		Disk:              disk,
 		Endpoint:          endpoint,
+		HealthChecks:      readHealthChecks(application.HealthChecks),
+		Dependencies:      application.Dependencies,
+		Constraints:       readConstraints(application.Constraints),
+		ImageURL:          application.Container.Docker.Image,
+		Ports:             readPortMappings(named.portMappings()),
+		Volumes:           readVolumes(application.Container.Volumes),
+		UpdateStrategy:    readUpgradeStrategy(application.UpgradeStrategy),
 	}
 
 	return &artifact, nil
@@ -173,60 +331,90 @@ func (mb *MarathonBackend) GetApp(req *ArtifactRequest) (*Artifact, error) {
 // takes CreateRequest from backend as argument
 func (mb *MarathonBackend) Deploy(cr *CreateRequest) (string, error) {
 	glog.Infof("Deploying a new application with name %s", cr.Name)
+	app := buildApplication(&cr.BaseRequest, cr.Labels["team"])
+
+	application, err := mb.api.createApplication(app)
+	if err != nil {
+		glog.Errorf("Could not create application %s, error %s", app.ID, err)
+		return "", err
+	}
+	glog.Infof("Application was created, %s", app.ID)
+	//marathon returns the deployment started for the new app in the list of deployments
+	for _, deployment := range application.Deployments {
+		if id, ok := deployment["id"]; ok {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+//buildApplication builds the marathon application of a deployment, the registry settings are chosen by team
+func buildApplication(cr *BaseRequest, team string) *marathonApplication {
 	app := marathon.NewDockerApplication()
 	id := cr.Name
 	ports := cr.Ports
-	cpu := float64(cr.CPULimit)
-	storage := 0.0 //TODO: setup limit for storage
-	memory := float64(cr.MemoryLimit)
+	cpu := cr.CPULimit
+	storage := cr.DiskLimit
+	memory := cr.MemoryLimit
 	labels := cr.Labels
 	imageurl := cr.ImageURL
 	env := cr.Env
 	replicas := cr.Replicas
 
+	registry := conf.New().RegistryFor(team, imageurl)
 	app.Name(id)
-	uris := strings.Fields(DOCKERCFG)
+	uris := strings.Fields(registry.DockerCfg)
 	app.Uris = &uris
 	app.CPU(cpu).Memory(memory).Storage(storage).Count(replicas)
 	app.Env = &env
-	portmappings := make([]marathon.PortMapping, 0, len(ports))
-	for _, port := range ports {
-		portmappings = append(portmappings, marathon.PortMapping{ContainerPort: port, HostPort: 0, Protocol: "tcp"}) //TODO: change to protocol params, we probably want to have UDP too.
-	}
-
-	app.Container.Docker.PortMappings = &portmappings
 	//fluentd implementation
 	if conf.New().FluentdEnabled {
 		app.Container.Docker.AddParameter("log-driver", "fluentd")
 		app.Container.Docker.AddParameter("log-opt", "\"fluentd-address=localhost:24224\"")
-		if DOCKERVERSION == "1.9" {
-			//this is unsupported if docker < 1.9
-			app.Container.Docker.AddParameter("log-opt", "\"tag={{.ImageName}}/{{.Name}}\"")
-		} else {
-			app.Container.Docker.AddParameter("log-opt", "\"fluentd-tag={{.Name}}\"")
-		}
-
+		app.Container.Docker.AddParameter("log-opt", fluentdTagOption(registry.DockerVersion))
 	}
 	app.Labels = &labels
-	forcepull := true
-	app.Container.Docker.Container(imageurl).ForcePullImage = &forcepull
+	app.Container.Docker.Container(imageurl).ForcePullImage = registry.ForcePull
 	volumes := make([]marathon.Volume, 0, len(cr.Volumes))
 	for _, volume := range cr.Volumes {
 		volumes = append(volumes, marathon.Volume{ContainerPath: volume.ContainerPath, HostPath: volume.HostPath, Mode: volume.Mode})
 	}
 
 	app.Container.Volumes = &volumes
+	app.HealthChecks = buildHealthChecks(cr.HealthChecks)
+	app.UpgradeStrategy = buildUpgradeStrategy(cr.UpdateStrategy)
+	app.Constraints = buildConstraints(cr.Constraints)
+	return newMarathonApplication(app, buildPortMappings(ports))
+}
 
-	//TODO must implement configurable health checks
-	application, err := mb.Client.CreateApplication(app)
-	glog.Info(application) //TODO do we want to get some more information? Container IDs? I guess they can be not stable
-	if err != nil {
-		glog.Errorf("Could not create application %s, error %s", app.ID, err)
-		return "", err
+//fluentdTagOption returns the log option tagging the logs sent to fluentd: the generic tag option exists
+//since docker 1.9, older versions only have fluentd-tag
+func fluentdTagOption(dockerVersion string) string {
+	if !dockerVersionAtLeast(dockerVersion, 1, 9) {
+		return "\"fluentd-tag={{.Name}}\""
 	}
-	glog.Infof("Application was created, %s", app.ID)
-	return app.ID, nil
+	return "\"tag={{.ImageName}}/{{.Name}}\""
+}
 
+//dockerVersionAtLeast compares a docker version like "1.9.1", "1.12" or "17.03.1-ce" with a major and minor version.
+//A version that cannot be parsed is taken as a recent one.
+func dockerVersionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		glog.Warningf("Could not parse docker version %s", version)
+		return true
+	}
+	versionMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		glog.Warningf("Could not parse docker version %s", version)
+		return true
+	}
+	versionMinor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		glog.Warningf("Could not parse docker version %s", version)
+		return true
+	}
+	return versionMajor > major || (versionMajor == major && versionMinor >= minor)
 }
 
 //Scale is used to scale an application.
@@ -260,42 +448,365 @@ func (mb *MarathonBackend) Delete(delReq *ArtifactRequest) (string, error) {
 // UpdateDeployment updates the current deployment. This means the deployment will be restarted
 func (mb *MarathonBackend) UpdateDeployment(req *UpdateRequest) (string, error) {
 	glog.Infof("Updating a previously deployed application")
-	app := marathon.NewDockerApplication()
-	id := req.Name
-	ports := req.Ports
-	cpu := float64(req.CPULimit)
-	storage := 0.0
-	memory := float64(req.MemoryLimit)
-	labels := req.Labels
-	imageurl := req.ImageURL
-	env := req.Env
-	replicas := req.Replicas
+	//the application is built like a new one, so that volumes and logging settings are kept
+	app := buildApplication(&req.BaseRequest, mb.teamOf(req.Name, req.Labels))
 
-	app.Name(id)
-	uris := strings.Fields(DOCKERCFG)
-	app.Uris = &uris
-	app.CPU(cpu)
-	app.Memory(memory)
-	app.Storage(storage)
-	app.Count(replicas)
-	app.Env = &env
-	portmappings := make([]marathon.PortMapping, 0, len(ports))
-	for _, port := range ports {
-		portmappings = append(portmappings, marathon.PortMapping{ContainerPort: port, HostPort: 0, Protocol: "tcp"}) //TODO: change to protocol params, we probably want to have UDP too.
+	appID, err := mb.api.updateApplication(app) //by default force update are true
+	if err != nil {
+		return "", err
 	}
+	return appID.DeploymentID, nil
 
-	app.Container.Docker.PortMappings = &portmappings
-	app.Labels = &labels
+}
 
-	forcepull := true
-	app.Container.Docker.Container(imageurl).ForcePullImage = &forcepull
+//teamOf returns the team of an app from the given labels or, if not there, from the labels of the deployed app
+func (mb *MarathonBackend) teamOf(name string, labels map[string]string) string {
+	if team, ok := labels["team"]; ok {
+		return team
+	}
+	application, err := mb.Client.Application(name)
+	if err != nil || application.Labels == nil {
+		return ""
+	}
+	return (*application.Labels)["team"]
+}
 
-	appID, err := mb.Client.UpdateApplication(app, true) //by default force update are true
+// GetAppVersions returns the versions of an application stored by marathon.
+// Marathon returns them ordered from the most recent one, which is the version currently running.
+func (mb *MarathonBackend) GetAppVersions(req *ArtifactRequest) ([]string, error) {
+	versions, err := mb.Client.ApplicationVersions(req.Name)
+	if err != nil {
+		glog.Errorf("Could not get versions for application %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	return versions.Versions, nil
+}
+
+// Rollback sets the application back to a previous version. If no version is given
+// the one preceding the current version is used.
+// NOTE marathon creates a new version for scaling operations too, so the previous version
+// could differ from the current one only in the number of instances.
+func (mb *MarathonBackend) Rollback(req *RollbackRequest) (string, error) {
+	version := req.Version
+	if version == "" {
+		versions, err := mb.GetAppVersions(&ArtifactRequest{Action: VERSIONS, Name: req.Name})
+		if err != nil {
+			return "", err
+		}
+		if len(versions) < 2 {
+			return "", fmt.Errorf("application %s has no previous version to roll back to", req.Name)
+		}
+		version = versions[1]
+	} else {
+		found, err := mb.Client.HasApplicationVersion(req.Name, version)
+		if err != nil {
+			glog.Errorf("Could not get versions for application %s, error: %s", req.Name, err)
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("application %s has no version %s", req.Name, version)
+		}
+	}
+	deployment, err := mb.Client.SetApplicationVersion(req.Name, &marathon.ApplicationVersion{Version: version})
 	if err != nil {
+		glog.Errorf("Could not roll back application %s to version %s, error: %s", req.Name, version, err)
 		return "", err
 	}
-	return appID.DeploymentID, nil
+	glog.Infof("Rolling back application %s to version %s, deployment: %s", req.Name, version, deployment.DeploymentID)
+	return deployment.DeploymentID, nil
+}
+
+//buildHealthChecks translates chimp health checks into marathon ones.
+//Zero values are not sent, so that marathon defaults are used.
+func buildHealthChecks(checks []*HealthCheck) *[]marathon.HealthCheck {
+	healthChecks := make([]marathon.HealthCheck, 0, len(checks))
+	for _, check := range checks {
+		hc := marathon.HealthCheck{
+			Protocol:           strings.ToUpper(check.Protocol),
+			IntervalSeconds:    check.IntervalSeconds,
+			GracePeriodSeconds: check.GracePeriodSeconds,
+		}.SetPortIndex(check.PortIndex)
+		switch hc.Protocol {
+		case HealthCheckHTTP:
+			hc = hc.SetPath(check.Path)
+		case HealthCheckCommand:
+			hc = hc.SetCommand(marathon.Command{Value: check.Command})
+			hc.PortIndex = nil
+		}
+		if check.MaxConsecutiveFailures > 0 {
+			hc = hc.SetMaxConsecutiveFailures(check.MaxConsecutiveFailures)
+		}
+		healthChecks = append(healthChecks, hc)
+	}
+	return &healthChecks
+}
+
+//buildUpgradeStrategy translates the chimp update strategy into the marathon one.
+//If no strategy is given, nil is returned and marathon keeps its default. Marathon always gets both
+//capacities, so the ones not given are set to the marathon defaults.
+func buildUpgradeStrategy(strategy *UpdateStrategy) *marathon.UpgradeStrategy {
+	if strategy == nil || (strategy.MinimumHealthyCapacity == nil && strategy.MaximumOverCapacity == nil) {
+		return nil
+	}
+	upgrade := marathon.UpgradeStrategy{
+		MinimumHealthCapacity: marathonMinimumHealthCapacity,
+		MaximumOverCapacity:   marathonMaximumOverCapacity,
+	}
+	if strategy.MinimumHealthyCapacity != nil {
+		upgrade.MinimumHealthCapacity = *strategy.MinimumHealthyCapacity
+	}
+	if strategy.MaximumOverCapacity != nil {
+		upgrade.MaximumOverCapacity = *strategy.MaximumOverCapacity
+	}
+	return &upgrade
+}
+
+//readUpgradeStrategy translates a marathon upgrade strategy into a chimp update strategy
+func readUpgradeStrategy(strategy *marathon.UpgradeStrategy) *UpdateStrategy {
+	if strategy == nil {
+		return nil
+	}
+	minimum, over := strategy.MinimumHealthCapacity, strategy.MaximumOverCapacity
+	return &UpdateStrategy{MinimumHealthyCapacity: &minimum, MaximumOverCapacity: &over}
+}
+
+//readVolumes translates marathon volumes into chimp ones
+func readVolumes(volumes *[]marathon.Volume) []*Volume {
+	if volumes == nil {
+		return nil
+	}
+	result := make([]*Volume, 0, len(*volumes))
+	for _, volume := range *volumes {
+		result = append(result, &Volume{ContainerPath: volume.ContainerPath, HostPath: volume.HostPath, Mode: volume.Mode})
+	}
+	return result
+}
+
+//readHealthChecks translates marathon health checks into chimp ones
+func readHealthChecks(healthChecks *[]marathon.HealthCheck) []*HealthCheck {
+	if healthChecks == nil {
+		return nil
+	}
+	checks := make([]*HealthCheck, 0, len(*healthChecks))
+	for _, hc := range *healthChecks {
+		check := HealthCheck{Protocol: hc.Protocol, IntervalSeconds: hc.IntervalSeconds, GracePeriodSeconds: hc.GracePeriodSeconds}
+		if hc.Path != nil {
+			check.Path = *hc.Path
+		}
+		if hc.Command != nil {
+			check.Command = hc.Command.Value
+		}
+		if hc.PortIndex != nil {
+			check.PortIndex = *hc.PortIndex
+		}
+		if hc.MaxConsecutiveFailures != nil {
+			check.MaxConsecutiveFailures = *hc.MaxConsecutiveFailures
+		}
+		checks = append(checks, &check)
+	}
+	return checks
+}
+
+//buildConstraints translates chimp constraints into marathon ones, ["field", "OPERATOR", "value"].
+//The list is never nil, so that an update removes the constraints not requested anymore.
+func buildConstraints(constraints []*Constraint) *[][]string {
+	result := make([][]string, 0, len(constraints))
+	for _, c := range constraints {
+		constraint := []string{c.Field, c.Operator}
+		if c.Value != "" {
+			constraint = append(constraint, c.Value)
+		}
+		result = append(result, constraint)
+	}
+	return &result
+}
+
+//readConstraints translates marathon constraints into chimp ones
+func readConstraints(constraints *[][]string) []*Constraint {
+	if constraints == nil {
+		return nil
+	}
+	result := make([]*Constraint, 0, len(*constraints))
+	for _, c := range *constraints {
+		if len(c) < 2 {
+			continue
+		}
+		constraint := Constraint{Field: c[0], Operator: c[1]}
+		if len(c) > 2 {
+			constraint.Value = c[2]
+		}
+		result = append(result, &constraint)
+	}
+	return result
+}
+
+// GetRollout returns the deployments in progress for an application.
+// Marathon never fails a deployment on its own, it keeps retrying: the rollout is failed only when
+// no deployment is in progress anymore (p.e. it was cancelled) but not all the tasks are running and healthy.
+func (mb *MarathonBackend) GetRollout(req *RolloutRequest) (*Rollout, error) {
+	application, err := mb.Client.Application(req.Name)
+	if err != nil {
+		glog.Errorf("Could not get application %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	deployments, err := mb.Client.Deployments()
+	if err != nil {
+		glog.Errorf("Could not get deployments, error: %s", err)
+		return nil, err
+	}
+	rollout := Rollout{Name: application.ID, Deployments: make([]*RolloutDeployment, 0, 1)}
+	for _, deployment := range deployments {
+		if !containsString(deployment.AffectedApps, application.ID) {
+			continue
+		}
+		if req.DeploymentID != "" && deployment.ID != req.DeploymentID {
+			continue
+		}
+		actions := make([]string, 0, len(deployment.CurrentActions))
+		for _, action := range deployment.CurrentActions {
+			actions = append(actions, fmt.Sprintf("%s %s", action.Action, action.App))
+		}
+		rollout.Deployments = append(rollout.Deployments, &RolloutDeployment{ID: deployment.ID, Version: deployment.Version,
+			CurrentStep: deployment.CurrentStep, TotalSteps: deployment.TotalSteps, CurrentActions: actions})
+	}
+	//only failures of the current version are related to the rollout
+	if failure := application.LastTaskFailure; failure != nil && failure.Version == application.Version {
+		rollout.Message = fmt.Sprintf("%s, %s AT %s", failure.State, failure.Message, failure.Timestamp)
+	}
+	switch {
+	case len(rollout.Deployments) > 0:
+		rollout.Status = RolloutInProgress
+	case application.AllTaskRunning() && application.TasksUnhealthy == 0:
+		rollout.Status = RolloutDone
+	default:
+		rollout.Status = RolloutFailed
+	}
+	return &rollout, nil
+}
+
+// CancelRollout cancels the deployments in progress for an application. Without force marathon starts
+// a new deployment rolling the application back, otherwise it is left as it is.
+// NOTE a deployment can affect other applications too, p.e. the ones of the same group: they are cancelled as well.
+func (mb *MarathonBackend) CancelRollout(req *CancelRequest) ([]*CancelledDeployment, error) {
+	application, err := mb.Client.Application(req.Name)
+	if err != nil {
+		glog.Errorf("Could not get application %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	deployments, err := mb.Client.Deployments()
+	if err != nil {
+		glog.Errorf("Could not get deployments, error: %s", err)
+		return nil, err
+	}
+	cancelled := make([]*CancelledDeployment, 0, 1)
+	for _, deployment := range deployments {
+		if !containsString(deployment.AffectedApps, application.ID) {
+			continue
+		}
+		var rollback *marathon.DeploymentID
+		if req.Force {
+			err = mb.api.forceCancelDeployment(deployment.ID)
+		} else {
+			rollback, err = mb.Client.DeleteDeployment(deployment.ID, false)
+		}
+		if err != nil {
+			glog.Errorf("Could not cancel deployment %s of application %s, error: %s", deployment.ID, req.Name, err)
+			return cancelled, err
+		}
+		glog.Infof("Cancelled deployment %s of application %s", deployment.ID, req.Name)
+		result := &CancelledDeployment{ID: deployment.ID, Version: deployment.Version}
+		if rollback != nil {
+			result.RollbackID = rollback.DeploymentID
+		}
+		cancelled = append(cancelled, result)
+	}
+	if len(cancelled) == 0 {
+		return nil, fmt.Errorf("application %s has no deployment in progress", req.Name)
+	}
+	return cancelled, nil
+}
+
+// Events subscribes to the marathon event bus and returns the events related to applications
+func (mb *MarathonBackend) Events() (<-chan *Event, error) {
+	marathonEvents := make(marathon.EventsChannel, 64)
+	filter := marathon.EventIDApplications | marathon.EventIDDeploymentStepSuccess | marathon.EventIDDeploymentStepFailed
+	if err := mb.Client.AddEventsListener(marathonEvents, filter); err != nil {
+		glog.Errorf("Could not subscribe to marathon events, error: %s", err)
+		return nil, err
+	}
+	events := make(chan *Event, 64)
+	go func() {
+		for marathonEvent := range marathonEvents {
+			if event := translateEvent(marathonEvent); event != nil {
+				events <- event
+			}
+		}
+	}()
+	return events, nil
+}
+
+//translateEvent translates a marathon event into a chimp one. Returns nil for events chimp does not handle.
+func translateEvent(marathonEvent *marathon.Event) *Event {
+	switch e := marathonEvent.Event.(type) {
+	case *marathon.EventStatusUpdate:
+		return &Event{Type: EventStatusUpdate, App: e.AppID, ReplicaID: e.TaskID, Host: e.Host, Status: e.TaskStatus, Timestamp: e.Timestamp}
+	case *marathon.EventHealthCheckChanged:
+		status := "NOT ALIVE"
+		if e.Alive {
+			status = "ALIVE"
+		}
+		return &Event{Type: EventHealthChanged, App: e.AppID, ReplicaID: e.TaskID, Status: status, Timestamp: e.Timestamp}
+	case *marathon.EventFailedHealthCheck:
+		return &Event{Type: EventHealthCheckFailed, App: e.AppID, Timestamp: e.Timestamp,
+			Message: fmt.Sprintf("%s health check %s failed", e.HealthCheck.Protocol, e.HealthCheck.Path)}
+	case *marathon.EventAppTerminated:
+		return &Event{Type: EventAppTerminated, App: e.AppID, Timestamp: e.Timestamp}
+	case *marathon.EventDeploymentStepSuccess:
+		if e.CurrentStep != nil {
+			return &Event{Type: EventDeploymentStep, App: e.CurrentStep.App, Status: e.CurrentStep.Action, Timestamp: e.Timestamp}
+		}
+	case *marathon.EventDeploymentStepFailure:
+		if e.CurrentStep != nil {
+			return &Event{Type: EventDeploymentStepFailed, App: e.CurrentStep.App, Status: e.CurrentStep.Action, Timestamp: e.Timestamp}
+		}
+	}
+	return nil
+}
+
+//buildPortMappings maps the ports of a request to the docker port mappings of marathon
+func buildPortMappings(ports []Port) []marathonPortMapping {
+	portmappings := make([]marathonPortMapping, 0, len(ports))
+	for _, port := range ports {
+		portmappings = append(portmappings, marathonPortMapping{ContainerPort: port.ContainerPort, HostPort: port.HostPort,
+			ServicePort: port.ServicePort, Protocol: port.ProtocolOrDefault(), Name: port.Name})
+	}
+	return portmappings
+}
+
+//readPortMappings translates the docker port mappings of marathon into chimp ports
+func readPortMappings(portmappings *[]marathonPortMapping) []Port {
+	if portmappings == nil {
+		return nil
+	}
+	ports := make([]Port, 0, len(*portmappings))
+	for _, mapping := range *portmappings {
+		ports = append(ports, Port{ContainerPort: mapping.ContainerPort, Protocol: mapping.Protocol, Name: mapping.Name,
+			HostPort: mapping.HostPort, ServicePort: mapping.ServicePort})
+	}
+	return ports
+}
 
+//portProtocol returns the protocol of the i-th port of an application, the ports of the tasks
+//are in the same order as the port mappings
+func portProtocol(application *marathon.Application, i int) string {
+	if application.Container == nil || application.Container.Docker == nil || application.Container.Docker.PortMappings == nil {
+		return PortProtocolTCP
+	}
+	mappings := *application.Container.Docker.PortMappings
+	if i >= len(mappings) || mappings[i].Protocol == "" {
+		return PortProtocolTCP
+	}
+	return mappings[i].Protocol
 }
 
 func intslice2str(ary []int, sep string) string {
@@ -306,60 +817,106 @@ func intslice2str(ary []int, sep string) string {
 	return str
 }
 
-//this is a definitely not an elegant way of composing the ContainerName, but this information is currently not
-//available anywhere else. This MUST be removed or refactored as soon as https://issues.apache.org/jira/browse/MESOS-3688
-//is completed and the same information exposed via marathon.
-//NOTE: this function ca be further improved as there are many hardcoded infos.
-func buildContainerName(host string, ID string) (string, error) {
-	containerName := ""
-	slaveID := ""
-	//call the mesos host (slave) to get the state.json
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s://%s:5051/state.json", "http", host), nil)
-	if err != nil {
-		return "", err
+// Kill kills one replica of an application or, without a replica ID, all of them.
+// Marathon starts new replicas in place of the killed ones, unless the application is scaled down.
+func (mb *MarathonBackend) Kill(req *KillRequest) ([]string, error) {
+	if req.ReplicaID == "" {
+		tasks, err := mb.Client.KillApplicationTasks(req.Name, &marathon.KillApplicationTasksOpts{Scale: req.Scale})
+		if err != nil {
+			glog.Errorf("Could not kill the replicas of application %s, error: %s", req.Name, err)
+			return nil, err
+		}
+		killed := make([]string, 0, len(tasks.Tasks))
+		for _, task := range tasks.Tasks {
+			killed = append(killed, task.ID)
+		}
+		return killed, nil
 	}
-	res, err := http.DefaultClient.Do(req)
-	if res != nil {
-		defer res.Body.Close()
+	//marathon derives the application from the task ID, so we check it to not kill the replicas of another app
+	if !strings.HasPrefix(req.ReplicaID, taskPrefix(req.Name)) {
+		return nil, fmt.Errorf("replica %s does not belong to application %s", req.ReplicaID, req.Name)
 	}
+	_, err := mb.Client.KillTask(req.ReplicaID, &marathon.KillTaskOpts{Scale: req.Scale})
+	if err != nil {
+		glog.Errorf("Could not kill replica %s of application %s, error: %s", req.ReplicaID, req.Name, err)
+		return nil, err
+	}
+	return []string{req.ReplicaID}, nil
+}
+
+//taskPrefix returns the prefix of the IDs of the tasks of an app: the app ID without the leading slash,
+//slashes replaced by underscores and followed by a dot.
+func taskPrefix(name string) string {
+	return strings.Replace(strings.TrimPrefix(name, "/"), "/", "_", -1) + "."
+}
+
+// DeployGroup deploys a new group of applications. Marathon starts the applications respecting
+// their dependencies and rolls back the whole group if it cannot be deployed.
+func (mb *MarathonBackend) DeployGroup(req *GroupRequest) (string, error) {
+	glog.Infof("Deploying a new group with name %s", req.Name)
+	group := buildGroup(req)
+	deployment, err := mb.api.createGroup(group)
 	if err != nil {
+		glog.Errorf("Could not create group %s, error %s", group.ID, err)
 		return "", err
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	glog.Infof("Group was created, %s", group.ID)
+	return deployment.DeploymentID, nil
+}
+
+// UpdateGroup updates all the applications of a group in a single deployment
+func (mb *MarathonBackend) UpdateGroup(req *GroupRequest) (string, error) {
+	glog.Infof("Updating group %s", req.Name)
+	group := buildGroup(req)
+	deployment, err := mb.api.updateGroup(group)
 	if err != nil {
+		glog.Errorf("Could not update group %s, error %s", group.ID, err)
 		return "", err
 	}
+	return deployment.DeploymentID, nil
+}
 
-	//parse the state.json to get from "frameworks->execturos->" the entry with id == ID
-	var mj interface{}
-	err = json.Unmarshal(body, &mj)
+// GetGroup returns the applications of a group
+func (mb *MarathonBackend) GetGroup(req *ArtifactRequest) (*GroupArtifact, error) {
+	group, err := mb.Client.Group(req.Name)
 	if err != nil {
+		glog.Errorf("Could not get group %s, error: %s", req.Name, err)
+		return nil, err
+	}
+	//the group resource does not contain the tasks, so every application is requested on its own
+	apps := make([]*Artifact, 0, len(group.Apps))
+	for _, app := range group.Apps {
+		artifact, err := mb.GetApp(&ArtifactRequest{Action: req.Action, Name: app.ID})
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, artifact)
+	}
+	return &GroupArtifact{Name: strings.TrimPrefix(group.ID, "/"), Apps: apps}, nil
+}
+
+// DeleteGroup deletes a group and all its applications
+func (mb *MarathonBackend) DeleteGroup(req *ArtifactRequest) (string, error) {
+	deployment, err := mb.Client.DeleteGroup(req.Name)
+	if err != nil {
+		glog.Errorf("Could not delete group %s, error: %s", req.Name, err)
 		return "", err
 	}
-	data := mj.(map[string]interface{})
-	frameworks := data["frameworks"]
-	for _, framework := range frameworks.([]interface{}) {
-		//check if we are really looking at marathon data as there could be many mesos frameworks
-		f := framework.(map[string]interface{})
-		if f["name"] == "marathon" {
-			executors := f["executors"].([]interface{})
-			//iterate on tasks
-			for _, executor := range executors {
-				exec := executor.(map[string]interface{})
-				if exec["id"].(string) == ID { //this is the map we need
-					//read field "container" from the entry
-					containerName = exec["container"].(string)
-					//getting slave ID
-					tasks := exec["tasks"].([]interface{})
-					if len(tasks) > 0 {
-						task := tasks[0].(map[string]interface{})
-						slaveID = task["slave_id"].(string)
-					}
-				}
+	glog.Infof("Successfully deleted group %s", req.Name)
+	return deployment.DeploymentID, nil
+}
 
-			}
+//buildGroup builds the marathon group for a group request. The IDs of the applications and of their
+//dependencies are made absolute, so that marathon does not have to resolve relative paths.
+func buildGroup(req *GroupRequest) *marathonGroup {
+	group := &marathonGroup{ID: "/" + strings.TrimPrefix(req.Name, "/"), Apps: make([]*marathonApplication, 0, len(req.Apps)), Dependencies: []string{}}
+	for _, appReq := range req.Apps {
+		app := buildApplication(appReq, appReq.Labels["team"])
+		app.Name(path.Join(group.ID, appReq.Name))
+		for _, dependency := range appReq.Dependencies {
+			app.DependsOn(path.Join(group.ID, dependency))
 		}
+		group.Apps = append(group.Apps, app)
 	}
-	//build and return the string
-	return fmt.Sprintf("mesos-%s.%s", slaveID, containerName), nil
+	return group
 }
@@ -0,0 +1,233 @@
+// +build marathon
+
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	marathon "github.com/gambol99/go-marathon"
+	"github.com/golang/glog"
+	"github.com/zalando/chimp/conf"
+)
+
+//marathonPortMapping is the docker port mapping of marathon, with the name of the port the marathon client does not have
+type marathonPortMapping struct {
+	ContainerPort int    `json:"containerPort,omitempty"`
+	HostPort      int    `json:"hostPort"`
+	ServicePort   int    `json:"servicePort,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+//marathonDocker is the docker container of marathon with named port mappings, the ones of the client are hidden
+type marathonDocker struct {
+	marathon.Docker
+	PortMappings *[]marathonPortMapping `json:"portMappings,omitempty"`
+}
+
+type marathonContainer struct {
+	Type    string             `json:"type,omitempty"`
+	Docker  *marathonDocker    `json:"docker,omitempty"`
+	Volumes *[]marathon.Volume `json:"volumes,omitempty"`
+}
+
+//marathonApplication is the marathon application sent and read by chimp, the container of the client is hidden
+type marathonApplication struct {
+	marathon.Application
+	Container *marathonContainer `json:"container,omitempty"`
+}
+
+//marathonGroup is a marathon group of applications sent by chimp
+type marathonGroup struct {
+	ID           string                 `json:"id"`
+	Apps         []*marathonApplication `json:"apps"`
+	Dependencies []string               `json:"dependencies"`
+}
+
+//newMarathonApplication moves the container of an application of the client into a chimp one with the given port mappings
+func newMarathonApplication(app *marathon.Application, portMappings []marathonPortMapping) *marathonApplication {
+	named := &marathonApplication{Application: *app}
+	named.Application.Container = nil
+	if app.Container != nil {
+		named.Container = &marathonContainer{Type: app.Container.Type, Volumes: app.Container.Volumes}
+		if app.Container.Docker != nil {
+			named.Container.Docker = &marathonDocker{Docker: *app.Container.Docker, PortMappings: &portMappings}
+			named.Container.Docker.Docker.PortMappings = nil
+		}
+	}
+	return named
+}
+
+//clientApplication returns the application as the one of the marathon client, without the names of the ports
+func (app *marathonApplication) clientApplication() *marathon.Application {
+	application := app.Application
+	if app.Container != nil {
+		application.Container = &marathon.Container{Type: app.Container.Type, Volumes: app.Container.Volumes}
+		if app.Container.Docker != nil {
+			docker := app.Container.Docker.Docker
+			docker.PortMappings = nil
+			if app.Container.Docker.PortMappings != nil {
+				mappings := make([]marathon.PortMapping, 0, len(*app.Container.Docker.PortMappings))
+				for _, mapping := range *app.Container.Docker.PortMappings {
+					mappings = append(mappings, marathon.PortMapping{ContainerPort: mapping.ContainerPort, HostPort: mapping.HostPort,
+						ServicePort: mapping.ServicePort, Protocol: mapping.Protocol})
+				}
+				docker.PortMappings = &mappings
+			}
+			application.Container.Docker = &docker
+		}
+	}
+	return &application
+}
+
+//portMappings returns the named port mappings of the application
+func (app *marathonApplication) portMappings() *[]marathonPortMapping {
+	if app.Container == nil || app.Container.Docker == nil {
+		return nil
+	}
+	return app.Container.Docker.PortMappings
+}
+
+//marathonAPI calls the REST API of marathon for the requests the marathon client cannot make, p.e. the ones with
+//named ports. The endpoints of the configuration are tried till one answers.
+type marathonAPI struct {
+	config *conf.Config
+	client *http.Client
+}
+
+func newMarathonAPI(config *conf.Config) *marathonAPI {
+	return &marathonAPI{config: config, client: newMarathonHTTPClient(marathonRequestTimeout)}
+}
+
+//call sends a request with the given body, encoded as JSON, and decodes the answer into the result if not nil
+func (api *marathonAPI) call(method, uri string, body, result interface{}) error {
+	urls, err := endpointURLs(api.config)
+	if err != nil {
+		return err
+	}
+	var content []byte
+	if body != nil {
+		if content, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for _, endpointURL := range urls {
+		var reader io.Reader
+		if content != nil {
+			reader = bytes.NewReader(content)
+		}
+		req, e := http.NewRequest(method, endpointURL+uri, reader)
+		if e != nil {
+			return e
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if api.config.MarathonAuth.Enabled {
+			req.SetBasicAuth(api.config.MarathonAuth.MarathonHttpUser, api.config.MarathonAuth.MarathonHttpPassword)
+		}
+		res, e := api.client.Do(req)
+		if e != nil {
+			glog.Warningf("Could not call marathon endpoint %s, error: %s", endpointURL, e)
+			err = e
+			continue
+		}
+		defer res.Body.Close()
+		if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+			var answer struct {
+				Message string `json:"message"`
+			}
+			answerBody, _ := ioutil.ReadAll(res.Body)
+			if json.Unmarshal(answerBody, &answer) != nil || answer.Message == "" {
+				answer.Message = strings.TrimSpace(string(answerBody))
+			}
+			return &marathonError{status: res.StatusCode,
+				message: fmt.Sprintf("marathon answered %s to %s %s: %s", res.Status, method, uri, answer.Message)}
+		}
+		if result == nil {
+			return nil
+		}
+		return json.NewDecoder(res.Body).Decode(result)
+	}
+	return err
+}
+
+//marathonError is an error answered by marathon, with the status of the answer
+type marathonError struct {
+	status  int
+	message string
+}
+
+func (e *marathonError) Error() string {
+	return e.message
+}
+
+//appURI returns the URI of an application, the ID can have a leading slash
+func appURI(id string) string {
+	return "/v2/apps/" + strings.TrimPrefix(id, "/")
+}
+
+//application returns an application with the names of its ports
+func (api *marathonAPI) application(name string) (*marathonApplication, error) {
+	var wrapper struct {
+		Application *marathonApplication `json:"app"`
+	}
+	if err := api.call("GET", appURI(name), nil, &wrapper); err != nil {
+		if answer, ok := err.(*marathonError); ok && answer.status == http.StatusNotFound {
+			return nil, &AppNotFoundError{Name: name}
+		}
+		return nil, err
+	}
+	if wrapper.Application == nil {
+		return nil, &AppNotFoundError{Name: name}
+	}
+	return wrapper.Application, nil
+}
+
+//createApplication creates an application and returns it with the deployment started
+func (api *marathonAPI) createApplication(app *marathonApplication) (*marathon.Application, error) {
+	var created marathon.Application
+	if err := api.call("POST", "/v2/apps", app, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+//updateApplication replaces an application, forcing the update if another deployment is in progress
+func (api *marathonAPI) updateApplication(app *marathonApplication) (*marathon.DeploymentID, error) {
+	var deployment marathon.DeploymentID
+	if err := api.call("PUT", appURI(app.ID)+"?force=true", app, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+//createGroup creates a group with its applications
+func (api *marathonAPI) createGroup(group *marathonGroup) (*marathon.DeploymentID, error) {
+	var deployment marathon.DeploymentID
+	if err := api.call("POST", "/v2/groups", group, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+//updateGroup replaces the applications of a group in a single deployment
+func (api *marathonAPI) updateGroup(group *marathonGroup) (*marathon.DeploymentID, error) {
+	var deployment marathon.DeploymentID
+	if err := api.call("PUT", "/v2/groups/"+strings.TrimPrefix(group.ID, "/"), group, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+//forceCancelDeployment cancels a deployment without the rollback deployment marathon starts otherwise, which
+//the marathon client does not support
+func (api *marathonAPI) forceCancelDeployment(id string) error {
+	return api.call("DELETE", "/v2/deployments/"+url.QueryEscape(id)+"?force=true", nil, nil)
+}
@@ -0,0 +1,147 @@
+// +build marathon
+
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	marathon "github.com/gambol99/go-marathon"
+	"github.com/zalando/chimp/conf"
+	. "github.com/zalando/chimp/types"
+)
+
+func TestBuildUpgradeStrategy(t *testing.T) {
+	minimum, over := 0.5, 0.0
+	for _, test := range []struct {
+		strategy *UpdateStrategy
+		expected *marathon.UpgradeStrategy
+	}{
+		{nil, nil},
+		{&UpdateStrategy{}, nil},
+		{&UpdateStrategy{MinimumHealthyCapacity: &minimum, MaximumOverCapacity: &over}, &marathon.UpgradeStrategy{MinimumHealthCapacity: 0.5, MaximumOverCapacity: 0}},
+		//the capacity not given keeps the marathon default
+		{&UpdateStrategy{MinimumHealthyCapacity: &minimum}, &marathon.UpgradeStrategy{MinimumHealthCapacity: 0.5, MaximumOverCapacity: 1}},
+		{&UpdateStrategy{MaximumOverCapacity: &over}, &marathon.UpgradeStrategy{MinimumHealthCapacity: 1, MaximumOverCapacity: 0}},
+	} {
+		upgrade := buildUpgradeStrategy(test.strategy)
+		if (upgrade == nil) != (test.expected == nil) || (upgrade != nil && *upgrade != *test.expected) {
+			t.Fatalf("unexpected upgrade strategy %+v for %+v", upgrade, test.strategy)
+		}
+	}
+}
+
+func TestMarathonAPI(t *testing.T) {
+	var requests []string
+	var sent map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		requests = append(requests, r.Method+" "+r.URL.String()+" "+user+":"+password)
+		switch {
+		case strings.Contains(r.URL.Path, "unknown"):
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"App '/unknown' does not exist"}`))
+		case strings.Contains(r.URL.Path, "broken"):
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"message":"leader unknown"}`))
+		case r.Method == "GET":
+			w.Write([]byte(`{"app":{"id":"/shop","container":{"type":"DOCKER","docker":{"image":"shop:1.0","network":"BRIDGE",
+"portMappings":[{"containerPort":8080,"hostPort":0,"protocol":"tcp","name":"http"},{"containerPort":53,"hostPort":53,"protocol":"udp"}]}}}}`))
+		case r.Method == "POST":
+			json.NewDecoder(r.Body).Decode(&sent)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"/shop","deployments":[{"id":"5ed4c0c5"}]}`))
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	//the first endpoint is not reachable, the next one is tried
+	api := newMarathonAPI(&conf.Config{Endpoint: "http://127.0.0.1:1," + strings.TrimPrefix(server.URL, "http://"),
+		MarathonAuth: conf.MarathonAuth{Enabled: true, MarathonHttpUser: "chimp", MarathonHttpPassword: "secret"}})
+
+	//the names of the ports are sent and read back
+	app := buildApplication(&BaseRequest{Name: "shop", ImageURL: "shop:1.0", Ports: []Port{{ContainerPort: 8080, Name: "http"}}}, "")
+	created, err := api.createApplication(app)
+	if err != nil || created.Deployments[0]["id"] != "5ed4c0c5" {
+		t.Fatalf("unexpected application %+v, error %v", created, err)
+	}
+	mappings := sent["container"].(map[string]interface{})["docker"].(map[string]interface{})["portMappings"].([]interface{})
+	if len(mappings) != 1 || mappings[0].(map[string]interface{})["name"] != "http" {
+		t.Fatalf("expected the named port to be sent, got %v", sent["container"])
+	}
+	named, err := api.application("/shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := readPortMappings(named.portMappings())
+	if len(ports) != 2 || ports[0] != (Port{ContainerPort: 8080, Protocol: "tcp", Name: "http"}) || ports[1].HostPort != 53 {
+		t.Fatalf("unexpected ports %+v", ports)
+	}
+	if application := named.clientApplication(); application.Container.Docker.Image != "shop:1.0" || portProtocol(application, 1) != "udp" {
+		t.Fatalf("unexpected client application %+v", application.Container.Docker)
+	}
+	if _, err = api.application("unknown"); !IsAppNotFound(err) {
+		t.Fatalf("expected the application not to be found, got %v", err)
+	}
+	if _, err = api.application("broken"); err == nil || IsAppNotFound(err) || !strings.Contains(err.Error(), "leader unknown") {
+		t.Fatalf("expected the error of marathon, got %v", err)
+	}
+
+	if err = api.forceCancelDeployment("5ed4c0c5"); err != nil {
+		t.Fatal(err)
+	}
+	if last := requests[len(requests)-1]; last != "DELETE /v2/deployments/5ed4c0c5?force=true chimp:secret" {
+		t.Fatalf("unexpected request %s", last)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	config := marathon.NewDefaultConfig()
+	config.URL = server.URL
+	config.HTTPClient = newMarathonHTTPClient(100 * time.Millisecond)
+	client, err := marathon.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinged := make(chan error, 1)
+	go func() { pinged <- (&MarathonBackend{Client: client}).Ping() }()
+	select {
+	case err = <-pinged:
+		if err == nil {
+			t.Fatal("expected an error from a marathon not answering")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the ping did not time out")
+	}
+}
+
+func TestDockerVersionAtLeast(t *testing.T) {
+	for version, expected := range map[string]bool{"1.8": false, "1.8.3": false, "1.9": true, "1.9.1": true, "1.10": true, "1.12.6": true,
+		"17.03.1-ce": true, "v1.9": true, "1.10-rc1": true, "0.9": false, "": true, "unknown": true} {
+		if dockerVersionAtLeast(version, 1, 9) != expected {
+			t.Fatalf("expected %s at least 1.9 to be %t", version, expected)
+		}
+	}
+	if !dockerVersionAtLeast("1.10.3", 1, 10) || dockerVersionAtLeast("1.9.1", 1, 10) {
+		t.Fatal("1.10.3 is at least 1.10, 1.9.1 is not")
+	}
+	if option := fluentdTagOption("1.12"); !strings.Contains(option, "tag={{.ImageName}}") || strings.Contains(option, "fluentd-tag") {
+		t.Fatalf("unexpected option %s for docker 1.12", option)
+	}
+	if option := fluentdTagOption("1.8.3"); !strings.Contains(option, "fluentd-tag") {
+		t.Fatalf("unexpected option %s for docker 1.8.3", option)
+	}
+}
@@ -1,4 +1,4 @@
-// +build integration marathon
+// +build integration,marathon
 
 package backend
 
@@ -14,7 +14,7 @@ var m *MarathonBackend
 
 func Test_GetAppNames(t *testing.T) {
 	m = New()
-	apps, err := m.GetAppNames(map[string]string{})
+	apps, err := m.GetAppNames(backend.Caller{}, map[string]string{})
 	if err != nil {
 		t.Errorf("%s", err.Error())
 		t.FailNow()
@@ -29,8 +29,8 @@ func Test_Deploy(t *testing.T) {
 	m = New()
 	var beReq *backend.CreateRequest = &backend.CreateRequest{BaseRequest: backend.BaseRequest{
 		Name:        "appname",
-		Ports:       []int{8080},
-		CPULimit:    2,
+		Ports:       []backend.Port{{ContainerPort: 8080}},
+		CPULimit:    2.5,
 		MemoryLimit: 2048,
 		ImageURL:    "pierone.stups.zalan.do/cat/cat-hello-aws:0.0.1",
 		Env:         map[string]string{"foo": "bar"},
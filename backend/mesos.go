@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//settings of the lookups of the mesos agents running the replicas
+const (
+	agentPort     = 5051
+	agentTimeout  = 3 * time.Second
+	agentStateTTL = 30 * time.Second
+	agentWorkers  = 8
+)
+
+//mesosAgentState is the part of the state.json of a mesos agent needed to find the containers of the tasks.
+//This is a definitely not an elegant way of getting the container name, but this information is currently not
+//available anywhere else. This MUST be removed or refactored as soon as https://issues.apache.org/jira/browse/MESOS-3688
+//is completed and the same information exposed via marathon.
+type mesosAgentState struct {
+	Frameworks []struct {
+		Name      string `json:"name"`
+		Executors []struct {
+			ID        string `json:"id"`
+			Container string `json:"container"`
+			Tasks     []struct {
+				SlaveID string `json:"slave_id"`
+			} `json:"tasks"`
+		} `json:"executors"`
+	} `json:"frameworks"`
+}
+
+//containerName returns the name of the docker container running the marathon task with the given ID
+func (s *mesosAgentState) containerName(taskID string) (string, bool) {
+	for _, framework := range s.Frameworks {
+		//there could be many mesos frameworks, we look only at marathon
+		if framework.Name != "marathon" {
+			continue
+		}
+		for _, executor := range framework.Executors {
+			if executor.ID != taskID {
+				continue
+			}
+			slaveID := ""
+			if len(executor.Tasks) > 0 {
+				slaveID = executor.Tasks[0].SlaveID
+			}
+			return fmt.Sprintf("mesos-%s.%s", slaveID, executor.Container), true
+		}
+	}
+	return "", false
+}
+
+//taskLocation identifies a task running on a mesos agent
+type taskLocation struct {
+	Host   string
+	TaskID string
+}
+
+//agentStateCache keeps the state of the mesos agents for a short time, so that the replicas of an app,
+//and the following requests, share a single lookup per agent. Failed lookups are cached too, so that an
+//unreachable agent does not slow down every request.
+type agentStateCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	workers int
+	entries map[string]*agentStateEntry
+	fetch   func(host string) (*mesosAgentState, error)
+}
+
+type agentStateEntry struct {
+	ready   chan struct{} //closed when the lookup is over
+	state   *mesosAgentState
+	err     error
+	fetched time.Time
+}
+
+func newAgentStateCache() *agentStateCache {
+	client := &http.Client{Timeout: agentTimeout}
+	return &agentStateCache{
+		ttl:     agentStateTTL,
+		workers: agentWorkers,
+		entries: make(map[string]*agentStateEntry),
+		fetch: func(host string) (*mesosAgentState, error) {
+			res, err := client.Get(fmt.Sprintf("http://%s:%d/state.json", host, agentPort))
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("mesos agent %s answered %s", host, res.Status)
+			}
+			var state mesosAgentState
+			if err = json.NewDecoder(res.Body).Decode(&state); err != nil {
+				return nil, err
+			}
+			return &state, nil
+		},
+	}
+}
+
+//get returns the state of an agent, from the cache if not expired. Concurrent calls for the same agent
+//wait for the same lookup.
+func (c *agentStateCache) get(host string) (*mesosAgentState, error) {
+	c.Lock()
+	entry, ok := c.entries[host]
+	if !ok || (isClosed(entry.ready) && time.Since(entry.fetched) > c.ttl) {
+		entry = &agentStateEntry{ready: make(chan struct{})}
+		c.entries[host] = entry
+		c.Unlock()
+		entry.state, entry.err = c.fetch(host)
+		entry.fetched = time.Now()
+		close(entry.ready)
+		return entry.state, entry.err
+	}
+	c.Unlock()
+	<-entry.ready
+	return entry.state, entry.err
+}
+
+//refresh drops the given state of an agent, if it was fetched before the given time, and returns the state fetched again.
+//Concurrent calls for the same stale state wait for a single lookup.
+func (c *agentStateCache) refresh(host string, stale *mesosAgentState, since time.Time) (*mesosAgentState, error) {
+	c.Lock()
+	if entry, ok := c.entries[host]; ok && isClosed(entry.ready) && entry.state == stale && entry.fetched.Before(since) {
+		delete(c.entries, host)
+	}
+	c.Unlock()
+	return c.get(host)
+}
+
+//containerNames looks up the container names of the given tasks with a bounded number of concurrent lookups.
+//The name of a task is empty, and its error set, when it could not be found. A task not found in a cached state,
+//like one just started, is looked up again in a new state of the agent.
+func (c *agentStateCache) containerNames(tasks []taskLocation) ([]string, []error) {
+	started := time.Now()
+	names := make([]string, len(tasks))
+	errs := make([]error, len(tasks))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < c.workers && w < len(tasks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				state, err := c.get(tasks[i].Host)
+				if err != nil {
+					errs[i] = fmt.Errorf("cannot reach mesos agent %s: %s", tasks[i].Host, err)
+					continue
+				}
+				name, found := state.containerName(tasks[i].TaskID)
+				if !found {
+					if state, err = c.refresh(tasks[i].Host, state, started); err == nil {
+						name, found = state.containerName(tasks[i].TaskID)
+					}
+				}
+				if !found {
+					errs[i] = fmt.Errorf("task not found on mesos agent %s", tasks[i].Host)
+					continue
+				}
+				names[i] = name
+			}
+		}()
+	}
+	for i := range tasks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return names, errs
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const agentStateJSON = `{"frameworks":[{"name":"chronos","executors":[]},
+{"name":"marathon","executors":[{"id":"app.1","container":"c1","tasks":[{"slave_id":"S1"}]},{"id":"app.2","container":"c2","tasks":[{"slave_id":"S1"}]}]}]}`
+
+func TestContainerNames(t *testing.T) {
+	var state mesosAgentState
+	if err := json.Unmarshal([]byte(agentStateJSON), &state); err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	fetches := make(map[string]int)
+	cache := newAgentStateCache()
+	cache.fetch = func(host string) (*mesosAgentState, error) {
+		lock.Lock()
+		fetches[host]++
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		if host == "down" {
+			return nil, errors.New("timeout")
+		}
+		return &state, nil
+	}
+
+	tasks := []taskLocation{{"up", "app.1"}, {"up", "app.2"}, {"down", "app.3"}, {"up", "app.4"}}
+	names, errs := cache.containerNames(tasks)
+	if names[0] != "mesos-S1.c1" || names[1] != "mesos-S1.c2" || errs[0] != nil || errs[1] != nil {
+		t.Errorf("unexpected names %v, errors %v", names, errs)
+	}
+	if errs[2] == nil || errs[3] == nil || names[2] != "" || names[3] != "" {
+		t.Errorf("expected errors for the unreachable agent and the unknown task, got %v", errs)
+	}
+	if fetches["up"] != 1 || fetches["down"] != 1 {
+		t.Errorf("expected one lookup per agent, got %v", fetches)
+	}
+
+	//the unknown task is looked up once more in a new state of the agent, it may have started meanwhile
+	cache.containerNames(tasks)
+	if fetches["up"] != 2 || fetches["down"] != 1 {
+		t.Errorf("expected the agent states to be cached and the unknown task looked up again, got %v", fetches)
+	}
+	//a task started after the state was cached is found in the new state
+	var started mesosAgentState
+	if err := json.Unmarshal([]byte(strings.Replace(agentStateJSON, `"id":"app.2","container":"c2"`, `"id":"app.4","container":"c4"`, 1)), &started); err != nil {
+		t.Fatal(err)
+	}
+	cache.fetch = func(host string) (*mesosAgentState, error) {
+		lock.Lock()
+		fetches[host]++
+		lock.Unlock()
+		return &started, nil
+	}
+	if names, errs = cache.containerNames(tasks[3:]); names[0] != "mesos-S1.c4" || errs[0] != nil || fetches["up"] != 3 {
+		t.Errorf("expected the task started after the cached state to be found, got %v, errors %v, lookups %v", names, errs, fetches)
+	}
+
+	cache.ttl = 0
+	cache.containerNames(tasks[:1])
+	if fetches["up"] != 4 {
+		t.Errorf("expected the expired agent state to be looked up again, got %v", fetches)
+	}
+}
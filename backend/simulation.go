@@ -0,0 +1,599 @@
+package backend
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zalando/chimp/conf"
+	. "github.com/zalando/chimp/types"
+)
+
+//SimulationType is the backend type selecting the simulation backend at runtime
+const SimulationType = "simulation"
+
+//States of the simulated replicas
+const (
+	replicaStaging = "STAGING"
+	replicaRunning = "RUNNING"
+	replicaFailing = "FAILING"
+)
+
+//SimulationBackend keeps the apps in memory and simulates their replicas, so that clients, tests and demos see the
+//behaviour of a backend without a cluster. A replica is staging, then running and, for a fraction of them, failing
+//after a while. The state is computed from the time the replica started; its changes are sent as events when an
+//app is read and, once someone subscribes to the events, every simulationTick.
+//Updates and rollbacks replace all the replicas at once; the versions of an app are kept like marathon does.
+type SimulationBackend struct {
+	sync.Mutex
+	stagingDelay time.Duration
+	failureDelay time.Duration
+	failureRate  float64
+	random       *rand.Rand
+	now          func() time.Time
+	apps         map[string]*simulatedApp
+	groups       map[string][]string
+	events       chan *Event //nil till someone subscribes
+	replicaCount int         //numbers the IDs of the replicas
+}
+
+//simulationTick is how often the changes of state of the replicas are sent to the subscriber of the events
+const simulationTick = time.Second
+
+//simulatedApp is an app with its versions, the most recent first, and its replicas. The replicas requested
+//are changed by scale and kill too, which do not make a new version.
+type simulatedApp struct {
+	versions  []*simulatedVersion
+	replicas  []*simulatedReplica
+	requested int
+}
+
+//simulatedVersion is a version of an app, identified by the time it was deployed
+type simulatedVersion struct {
+	id      string
+	at      time.Time
+	request BaseRequest
+}
+
+//simulatedReplica is a replica of a version of an app, fails tells if it is going to fail. Reported is the
+//last state sent as an event.
+type simulatedReplica struct {
+	id       string
+	version  *simulatedVersion
+	started  time.Time
+	fails    bool
+	reported string
+}
+
+//NewSimulationBackend returns a simulation backend with the Simulation settings of the configuration
+func NewSimulationBackend() Backend {
+	var settings conf.Simulation
+	if config := conf.New(); config != nil {
+		settings = config.Simulation
+	}
+	return newSimulationBackend(settings)
+}
+
+func newSimulationBackend(settings conf.Simulation) *SimulationBackend {
+	seed := settings.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &SimulationBackend{
+		stagingDelay: time.Duration(settings.StagingSeconds) * time.Second,
+		failureDelay: time.Duration(settings.FailureSeconds) * time.Second,
+		failureRate:  settings.FailureRate,
+		random:       rand.New(rand.NewSource(seed)),
+		now:          time.Now,
+		apps:         make(map[string]*simulatedApp),
+		groups:       make(map[string][]string),
+	}
+}
+
+//errAppNotFound is returned for the apps which do not exist
+func errAppNotFound(name string) error {
+	return &AppNotFoundError{Name: name}
+}
+
+//errAppExists is returned creating an app which exists already
+func errAppExists(name string) error {
+	return fmt.Errorf("application %s already exists", name)
+}
+
+//Ping always succeeds, the simulation runs in chimp-server
+func (sb *SimulationBackend) Ping() error {
+	return nil
+}
+
+//Info returns the description of the simulation backend, which has no endpoints
+func (sb *SimulationBackend) Info() (*BackendInfo, error) {
+	return &BackendInfo{Type: SimulationType, Version: SimulationType, Leader: "localhost", Endpoints: []*EndpointStatus{}}, nil
+}
+
+//state returns the state of a replica at the given time
+func (sb *SimulationBackend) state(replica *simulatedReplica, now time.Time) string {
+	running := replica.started.Add(sb.stagingDelay)
+	switch {
+	case now.Before(running):
+		return replicaStaging
+	case replica.fails && !now.Before(running.Add(sb.failureDelay)):
+		return replicaFailing
+	}
+	return replicaRunning
+}
+
+//app returns an app, the caller must hold the lock
+func (sb *SimulationBackend) app(name string) (*simulatedApp, error) {
+	app, exists := sb.apps[name]
+	if !exists {
+		return nil, errAppNotFound(name)
+	}
+	return app, nil
+}
+
+//emit sends an event about a replica to the subscriber, if any
+func (sb *SimulationBackend) emit(name string, replicaID string, status string) {
+	if sb.events == nil {
+		return
+	}
+	event := &Event{Type: EventStatusUpdate, App: "/" + name, ReplicaID: replicaID, Host: "localhost", Status: status,
+		Timestamp: sb.now().UTC().Format(time.RFC3339Nano)}
+	select {
+	case sb.events <- event:
+	default: //the subscriber is not reading the events
+	}
+}
+
+//reportStates sends an event for every replica of an app whose state changed since it was last reported,
+//the caller must hold the lock
+func (sb *SimulationBackend) reportStates(name string, app *simulatedApp, now time.Time) {
+	for _, replica := range app.replicas {
+		state := sb.state(replica, now)
+		if state == replica.reported {
+			continue
+		}
+		replica.reported = state
+		switch state {
+		case replicaRunning:
+			sb.emit(name, replica.id, "TASK_RUNNING")
+		case replicaFailing:
+			sb.emit(name, replica.id, "TASK_FAILED")
+		}
+	}
+}
+
+//watch reports the changes of state of the replicas of all the apps every interval, forever
+func (sb *SimulationBackend) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		sb.Lock()
+		now := sb.now()
+		for name, app := range sb.apps {
+			sb.reportStates(name, app, now)
+		}
+		sb.Unlock()
+	}
+}
+
+//startReplicas starts replicas of the current version of an app, deciding at random which ones are going to fail
+func (sb *SimulationBackend) startReplicas(name string, app *simulatedApp, count int) {
+	for i := 0; i < count; i++ {
+		sb.replicaCount++
+		replica := &simulatedReplica{id: fmt.Sprintf("%s.%d", name, sb.replicaCount), version: app.versions[0], started: sb.now(),
+			fails: sb.random.Float64() < sb.failureRate, reported: replicaStaging}
+		app.replicas = append(app.replicas, replica)
+		sb.emit(name, replica.id, "TASK_STAGING")
+	}
+}
+
+//stopReplicas stops the replicas of an app from the given index on
+func (sb *SimulationBackend) stopReplicas(name string, app *simulatedApp, from int) {
+	for _, replica := range app.replicas[from:] {
+		sb.emit(name, replica.id, "TASK_KILLED")
+	}
+	app.replicas = app.replicas[:from]
+}
+
+//deployVersion adds a new version to an app and replaces all its replicas with replicas of the new version
+func (sb *SimulationBackend) deployVersion(name string, app *simulatedApp, req BaseRequest) string {
+	return sb.deployVersionAt(name, app, req, versionTime(app, sb.now().UTC()))
+}
+
+//versionTime returns the time of the next version of an app deployed at the given time
+func versionTime(app *simulatedApp, at time.Time) time.Time {
+	if len(app.versions) > 0 && !at.After(app.versions[0].at) {
+		at = app.versions[0].at.Add(time.Nanosecond) //the versions are unique, even deploying twice at once
+	}
+	return at
+}
+
+//deployVersionAt is deployVersion with the time of the version, which is also its id
+func (sb *SimulationBackend) deployVersionAt(name string, app *simulatedApp, req BaseRequest, at time.Time) string {
+	req.Caller = Caller{}
+	version := &simulatedVersion{id: at.Format(time.RFC3339Nano), at: at, request: req}
+	app.versions = append([]*simulatedVersion{version}, app.versions...)
+	app.requested = req.Replicas
+	sb.stopReplicas(name, app, 0)
+	sb.startReplicas(name, app, req.Replicas)
+	return version.id
+}
+
+//GetAppNames returns the names of the apps matching all the labels of the filter
+func (sb *SimulationBackend) GetAppNames(caller Caller, filter map[string]string) ([]string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	names := make([]string, 0, len(sb.apps))
+	for name, app := range sb.apps {
+		labels := app.versions[0].request.Labels
+		matches := true
+		for label, value := range filter {
+			if label == "uid" || (label == "team" && value == "") {
+				continue
+			}
+			if labels[label] != value {
+				matches = false
+			}
+		}
+		if matches {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+//GetApp returns an app with the current state of its replicas
+func (sb *SimulationBackend) GetApp(req *ArtifactRequest) (*Artifact, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return sb.artifact(req.Name, app), nil
+}
+
+//artifact describes an app, the caller must hold the lock
+func (sb *SimulationBackend) artifact(name string, app *simulatedApp) *Artifact {
+	current := app.versions[0].request
+	now := sb.now()
+	sb.reportStates(name, app, now)
+	status := "RUNNING"
+	var message string
+	replicas := make([]*Replica, 0, len(app.replicas))
+	for _, replica := range app.replicas {
+		state := sb.state(replica, now)
+		if state != replicaRunning {
+			status = "DEPLOYING/WAITING"
+		}
+		if state == replicaFailing && message == "" {
+			message = fmt.Sprintf("replica %s is failing", replica.id)
+		}
+		endpoints := make([]string, 0, len(replica.version.request.Ports))
+		for _, port := range replica.version.request.Ports {
+			endpoints = append(endpoints, fmt.Sprintf("http://localhost:%d/", port.ContainerPort))
+		}
+		replicas = append(replicas, &Replica{ID: replica.id, Status: state, Endpoints: endpoints,
+			Containers: []*Container{{ImageURL: replica.version.request.ImageURL, Status: state}}})
+	}
+	if len(app.replicas) != app.requested {
+		status = "DEPLOYING/WAITING"
+	}
+	labels := make(map[string]string, len(current.Labels))
+	for key, value := range current.Labels {
+		labels[key] = value
+	}
+	env := make(map[string]string, len(current.Env))
+	for key, value := range current.Env {
+		env[key] = value
+	}
+	var endpoint string
+	if current.Host != "" {
+		endpoint = "https://" + current.Host
+	}
+	return &Artifact{
+		Name:              name,
+		Message:           message,
+		Status:            status,
+		Labels:            &labels,
+		Env:               &env,
+		RunningReplicas:   replicas,
+		RequestedReplicas: app.requested,
+		CPUS:              current.CPULimit,
+		Memory:            current.MemoryLimit,
+		Disk:              current.DiskLimit,
+		Endpoint:          endpoint,
+		HealthChecks:      current.HealthChecks,
+		Dependencies:      current.Dependencies,
+		Constraints:       current.Constraints,
+		Host:              current.Host,
+		ImageURL:          current.ImageURL,
+		Ports:             current.Ports,
+		Volumes:           current.Volumes,
+		UpdateStrategy:    current.UpdateStrategy,
+	}
+}
+
+//Deploy creates an app, which must not exist yet. Returns the new version.
+func (sb *SimulationBackend) Deploy(req *CreateRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	if _, exists := sb.apps[req.Name]; exists {
+		return "", errAppExists(req.Name)
+	}
+	app := &simulatedApp{}
+	sb.apps[req.Name] = app
+	return sb.deployVersion(req.Name, app, req.BaseRequest), nil
+}
+
+//UpdateDeployment deploys a new version of an app, replacing all its replicas. Returns the new version.
+func (sb *SimulationBackend) UpdateDeployment(req *UpdateRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return "", err
+	}
+	return sb.deployVersion(req.Name, app, req.BaseRequest), nil
+}
+
+//Scale starts or stops replicas of an app, the newest ones are stopped first
+func (sb *SimulationBackend) Scale(scale *ScaleRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(scale.Name)
+	if err != nil {
+		return "", err
+	}
+	if scale.Replicas < 0 {
+		return "", fmt.Errorf("cannot scale application %s to %d replicas", scale.Name, scale.Replicas)
+	}
+	app.requested = scale.Replicas
+	if running := len(app.replicas); scale.Replicas > running {
+		sb.startReplicas(scale.Name, app, scale.Replicas-running)
+	} else {
+		sb.stopReplicas(scale.Name, app, scale.Replicas)
+	}
+	return app.versions[0].id, nil
+}
+
+//Delete stops the replicas of an app and forgets it
+func (sb *SimulationBackend) Delete(req *ArtifactRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return "", err
+	}
+	sb.stopReplicas(req.Name, app, 0)
+	delete(sb.apps, req.Name)
+	return req.Name, nil
+}
+
+//GetAppVersions returns the versions of an app, the most recent first
+func (sb *SimulationBackend) GetAppVersions(req *ArtifactRequest) ([]string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, len(app.versions))
+	for i, version := range app.versions {
+		versions[i] = version.id
+	}
+	return versions, nil
+}
+
+//Rollback deploys again a previous version of an app, the one before the current one if none is given,
+//as a new version like marathon does
+func (sb *SimulationBackend) Rollback(req *RollbackRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return "", err
+	}
+	if req.Version == "" {
+		if len(app.versions) < 2 {
+			return "", fmt.Errorf("application %s has no previous version to roll back to", req.Name)
+		}
+		return sb.deployVersion(req.Name, app, app.versions[1].request), nil
+	}
+	for _, version := range app.versions {
+		if version.id == req.Version {
+			return sb.deployVersion(req.Name, app, version.request), nil
+		}
+	}
+	return "", fmt.Errorf("application %s has no version %s", req.Name, req.Version)
+}
+
+//GetRollout tells if the replicas of the current version of an app are all running. The rollout fails as soon as
+//a replica fails. A deployment ID other than the current version is a deployment completed already.
+func (sb *SimulationBackend) GetRollout(req *RolloutRequest) (*Rollout, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return sb.rollout(req.Name, app, req.DeploymentID), nil
+}
+
+//rollout describes the deployment of the current version of an app, the caller must hold the lock
+func (sb *SimulationBackend) rollout(name string, app *simulatedApp, deploymentID string) *Rollout {
+	rollout := &Rollout{Name: name, Status: RolloutDone, Deployments: make([]*RolloutDeployment, 0, 1)}
+	current := app.versions[0]
+	if deploymentID != "" && deploymentID != current.id {
+		return rollout
+	}
+	now := sb.now()
+	sb.reportStates(name, app, now)
+	running := 0
+	for _, replica := range app.replicas {
+		switch sb.state(replica, now) {
+		case replicaRunning:
+			running++
+		case replicaFailing:
+			if rollout.Status != RolloutFailed {
+				rollout.Status = RolloutFailed
+				rollout.Message = fmt.Sprintf("replica %s is failing", replica.id)
+			}
+		}
+	}
+	if rollout.Status == RolloutFailed || (running == app.requested && running == len(app.replicas)) {
+		return rollout
+	}
+	rollout.Status = RolloutInProgress
+	rollout.Deployments = append(rollout.Deployments, &RolloutDeployment{ID: current.id, Version: current.id,
+		CurrentStep: running, TotalSteps: app.requested,
+		CurrentActions: []string{fmt.Sprintf("%d of %d replicas running", running, app.requested)}})
+	return rollout
+}
+
+//CancelRollout cancels the deployment of the current version of an app, if it is not completed. Unless forced,
+//the previous version is deployed again.
+func (sb *SimulationBackend) CancelRollout(req *CancelRequest) ([]*CancelledDeployment, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if sb.rollout(req.Name, app, "").Status == RolloutDone {
+		return nil, fmt.Errorf("application %s has no deployment in progress", req.Name)
+	}
+	cancelled := &CancelledDeployment{ID: app.versions[0].id, Version: app.versions[0].id}
+	if !req.Force && len(app.versions) > 1 {
+		cancelled.RollbackID = sb.deployVersion(req.Name, app, app.versions[1].request)
+	}
+	return []*CancelledDeployment{cancelled}, nil
+}
+
+//Events returns the events of the simulation backend, one for every replica started, running, failing or stopped
+func (sb *SimulationBackend) Events() (<-chan *Event, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	if sb.events == nil {
+		sb.events = make(chan *Event, 64)
+		go sb.watch(simulationTick)
+	}
+	return sb.events, nil
+}
+
+//Kill stops one replica of an app or, without a replica ID, all of them. New replicas replace the killed ones,
+//unless the app is scaled down.
+func (sb *SimulationBackend) Kill(req *KillRequest) ([]string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	app, err := sb.app(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	killed := make([]string, 0, len(app.replicas))
+	kept := make([]*simulatedReplica, 0, len(app.replicas))
+	for _, replica := range app.replicas {
+		if req.ReplicaID != "" && replica.id != req.ReplicaID {
+			kept = append(kept, replica)
+			continue
+		}
+		sb.emit(req.Name, replica.id, "TASK_KILLED")
+		killed = append(killed, replica.id)
+	}
+	if req.ReplicaID != "" && len(killed) == 0 {
+		return nil, fmt.Errorf("replica %s does not belong to application %s", req.ReplicaID, req.Name)
+	}
+	app.replicas = kept
+	if req.Scale {
+		app.requested -= len(killed)
+		if app.requested < 0 {
+			app.requested = 0
+		}
+	} else {
+		sb.startReplicas(req.Name, app, len(killed))
+	}
+	return killed, nil
+}
+
+//DeployGroup deploys a new group of apps, which must not exist yet
+func (sb *SimulationBackend) DeployGroup(req *GroupRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	if _, exists := sb.groups[req.Name]; exists {
+		return "", fmt.Errorf("group %s already exists", req.Name)
+	}
+	return sb.updateGroup(req), nil
+}
+
+//UpdateGroup updates the apps of an existing group, named GROUP/APP: new apps are created and the ones
+//not in the group anymore are deleted. Returns the version of the group.
+func (sb *SimulationBackend) UpdateGroup(req *GroupRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	if _, exists := sb.groups[req.Name]; !exists {
+		return "", fmt.Errorf("group %s not found", req.Name)
+	}
+	return sb.updateGroup(req), nil
+}
+
+//updateGroup deploys the apps of a group, the caller must hold the lock. All the apps get the same version,
+//so that it is the id of the deployment of the group.
+func (sb *SimulationBackend) updateGroup(req *GroupRequest) string {
+	names := make([]string, 0, len(req.Apps))
+	at := sb.now().UTC()
+	for _, appReq := range req.Apps {
+		name := req.Name + "/" + appReq.Name
+		if app, exists := sb.apps[name]; exists {
+			at = versionTime(app, at)
+		}
+		names = append(names, name)
+	}
+	for i, appReq := range req.Apps {
+		app, exists := sb.apps[names[i]]
+		if !exists {
+			app = &simulatedApp{}
+			sb.apps[names[i]] = app
+		}
+		sb.deployVersionAt(names[i], app, *appReq, at)
+	}
+	for _, name := range sb.groups[req.Name] {
+		if !containsString(names, name) {
+			sb.stopReplicas(name, sb.apps[name], 0)
+			delete(sb.apps, name)
+		}
+	}
+	sb.groups[req.Name] = names
+	return at.Format(time.RFC3339Nano)
+}
+
+//GetGroup returns the apps of a group
+func (sb *SimulationBackend) GetGroup(req *ArtifactRequest) (*GroupArtifact, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	names, exists := sb.groups[req.Name]
+	if !exists {
+		return nil, fmt.Errorf("group %s not found", req.Name)
+	}
+	group := &GroupArtifact{Name: req.Name, Apps: make([]*Artifact, 0, len(names))}
+	for _, name := range names {
+		group.Apps = append(group.Apps, sb.artifact(name, sb.apps[name]))
+	}
+	return group, nil
+}
+
+//DeleteGroup deletes a group and its apps
+func (sb *SimulationBackend) DeleteGroup(req *ArtifactRequest) (string, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	names, exists := sb.groups[req.Name]
+	if !exists {
+		return "", fmt.Errorf("group %s not found", req.Name)
+	}
+	for _, name := range names {
+		sb.stopReplicas(name, sb.apps[name], 0)
+		delete(sb.apps, name)
+	}
+	delete(sb.groups, req.Name)
+	return req.Name, nil
+}
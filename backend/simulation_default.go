@@ -0,0 +1,8 @@
+// +build !marathon,!kubernetes
+
+package backend
+
+//without the tag of a backend, chimp-server and the tests run with the simulation backend
+func init() {
+	New = NewSimulationBackend
+}
@@ -0,0 +1,253 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/chimp/conf"
+	. "github.com/zalando/chimp/types"
+)
+
+//newTestSimulation returns a simulation backend with a clock moved forward by the returned function
+func newTestSimulation(settings conf.Simulation) (*SimulationBackend, func(time.Duration)) {
+	sb := newSimulationBackend(settings)
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	sb.now = func() time.Time { return now }
+	return sb, func(d time.Duration) {
+		sb.Lock()
+		defer sb.Unlock()
+		now = now.Add(d)
+	}
+}
+
+func replicaStates(t *testing.T, sb *SimulationBackend, name string) []string {
+	artifact, err := sb.GetApp(&ArtifactRequest{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make([]string, len(artifact.RunningReplicas))
+	for i, replica := range artifact.RunningReplicas {
+		states[i] = replica.Status
+	}
+	return states
+}
+
+func TestSimulationLifecycle(t *testing.T) {
+	sb, advance := newTestSimulation(conf.Simulation{StagingSeconds: 10})
+	req := BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 2, Labels: map[string]string{"team": "tm"},
+		Ports: []Port{{ContainerPort: 8080}}}
+	if _, err := sb.Deploy(&CreateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sb.Deploy(&CreateRequest{BaseRequest: req}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected the app to exist already, got %v", err)
+	}
+	if states := replicaStates(t, sb, "shop"); len(states) != 2 || states[0] != replicaStaging {
+		t.Fatalf("expected 2 staging replicas, got %v", states)
+	}
+	if rollout, _ := sb.GetRollout(&RolloutRequest{Name: "shop"}); rollout.Status != RolloutInProgress || rollout.Deployments[0].TotalSteps != 2 {
+		t.Fatalf("expected a rollout in progress, got %+v", rollout)
+	}
+	advance(10 * time.Second)
+	artifact, _ := sb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.Status != "RUNNING" || artifact.RunningReplicas[1].Status != replicaRunning || (*artifact.Labels)["team"] != "tm" {
+		t.Fatalf("expected the app to run, got %+v", artifact)
+	}
+	if rollout, _ := sb.GetRollout(&RolloutRequest{Name: "shop"}); rollout.Status != RolloutDone {
+		t.Fatalf("expected the rollout to be done, got %+v", rollout)
+	}
+
+	if names, _ := sb.GetAppNames(Caller{}, map[string]string{"team": "other"}); len(names) != 0 {
+		t.Fatalf("expected no apps of team other, got %v", names)
+	}
+	if names, _ := sb.GetAppNames(Caller{}, map[string]string{"team": "tm", "uid": "someone"}); len(names) != 1 || names[0] != "shop" {
+		t.Fatalf("expected shop, got %v", names)
+	}
+
+	//scaling up starts staging replicas, the running ones are kept
+	if _, err := sb.Scale(&ScaleRequest{Name: "shop", Replicas: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if states := replicaStates(t, sb, "shop"); len(states) != 3 || states[0] != replicaRunning || states[2] != replicaStaging {
+		t.Fatalf("expected a new staging replica, got %v", states)
+	}
+	if replicas := sb.apps["shop"].versions[0].request.Replicas; replicas != 2 {
+		t.Fatalf("scaling should not change the deployed version, got %d replicas", replicas)
+	}
+
+	//an update replaces all the replicas with the new version
+	req.ImageURL = "pierone/shop:2.0"
+	if _, err := sb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); err != nil {
+		t.Fatal(err)
+	}
+	artifact, _ = sb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.ImageURL != "pierone/shop:2.0" || artifact.RequestedReplicas != 2 || artifact.RunningReplicas[0].ID != "shop.4" {
+		t.Fatalf("expected the replicas of the new version, got %+v", artifact)
+	}
+	versions, _ := sb.GetAppVersions(&ArtifactRequest{Name: "shop"})
+	if len(versions) != 2 || versions[0] == versions[1] {
+		t.Fatalf("expected 2 distinct versions, got %v", versions)
+	}
+
+	//killing with scale reduces the replicas, without it they are replaced
+	if killed, err := sb.Kill(&KillRequest{Name: "shop", ReplicaID: "shop.4"}); err != nil || len(killed) != 1 {
+		t.Fatalf("unexpected killed %v, error %v", killed, err)
+	}
+	if _, err := sb.Kill(&KillRequest{Name: "shop", ReplicaID: "shop.4"}); err == nil {
+		t.Fatal("expected an error killing a replica twice")
+	}
+	if killed, _ := sb.Kill(&KillRequest{Name: "shop", ReplicaID: "shop.5", Scale: true}); len(killed) != 1 {
+		t.Fatalf("expected shop.5 to be killed, got %v", killed)
+	}
+	artifact, _ = sb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.RequestedReplicas != 1 || len(artifact.RunningReplicas) != 1 || artifact.RunningReplicas[0].ID != "shop.6" {
+		t.Fatalf("expected only the replacement of shop.4, got %+v", artifact.RunningReplicas)
+	}
+
+	if _, err := sb.Delete(&ArtifactRequest{Name: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		func() error { _, err := sb.GetApp(&ArtifactRequest{Name: "shop"}); return err }(),
+		func() error { _, err := sb.Delete(&ArtifactRequest{Name: "shop"}); return err }(),
+		func() error { _, err := sb.Scale(&ScaleRequest{Name: "shop", Replicas: 1}); return err }(),
+		func() error { _, err := sb.UpdateDeployment(&UpdateRequest{BaseRequest: req}); return err }(),
+	} {
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Fatalf("expected the app not to be found, got %v", err)
+		}
+	}
+}
+
+func TestSimulationFailures(t *testing.T) {
+	sb, advance := newTestSimulation(conf.Simulation{StagingSeconds: 5, FailureSeconds: 60, FailureRate: 1, Seed: 1})
+	req := BaseRequest{Name: "shop", ImageURL: "pierone/shop:1.0", Replicas: 1}
+	sb.Deploy(&CreateRequest{BaseRequest: req})
+	advance(5 * time.Second)
+	if states := replicaStates(t, sb, "shop"); states[0] != replicaRunning {
+		t.Fatalf("expected the replica to run before failing, got %v", states)
+	}
+	advance(time.Minute)
+	artifact, _ := sb.GetApp(&ArtifactRequest{Name: "shop"})
+	if artifact.RunningReplicas[0].Status != replicaFailing || artifact.Message == "" {
+		t.Fatalf("expected the replica to fail, got %+v", artifact)
+	}
+	if rollout, _ := sb.GetRollout(&RolloutRequest{Name: "shop"}); rollout.Status != RolloutFailed {
+		t.Fatalf("expected the rollout to fail, got %+v", rollout)
+	}
+
+	//cancelling the failed deployment of an update goes back to the previous version
+	req.ImageURL = "pierone/shop:2.0"
+	sb.UpdateDeployment(&UpdateRequest{BaseRequest: req})
+	cancelled, err := sb.CancelRollout(&CancelRequest{Name: "shop"})
+	if err != nil || len(cancelled) != 1 || cancelled[0].RollbackID == "" {
+		t.Fatalf("unexpected cancelled %+v, error %v", cancelled, err)
+	}
+	if artifact, _ = sb.GetApp(&ArtifactRequest{Name: "shop"}); artifact.ImageURL != "pierone/shop:1.0" {
+		t.Fatalf("expected the previous version, got %s", artifact.ImageURL)
+	}
+
+	//without failures the replicas keep running
+	sb.failureRate = 0
+	sb.Kill(&KillRequest{Name: "shop"})
+	advance(time.Hour)
+	if states := replicaStates(t, sb, "shop"); states[0] != replicaRunning {
+		t.Fatalf("expected the new replica to run, got %v", states)
+	}
+	if _, err = sb.CancelRollout(&CancelRequest{Name: "shop"}); err == nil {
+		t.Fatal("expected no deployment to cancel")
+	}
+}
+
+func TestSimulationEvents(t *testing.T) {
+	sb, advance := newTestSimulation(conf.Simulation{StagingSeconds: 5, FailureSeconds: 60, FailureRate: 1, Seed: 1})
+	events, err := sb.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "shop", Replicas: 1}})
+	//the changes of state are sent when the app is read, without waiting for the tick
+	advance(5 * time.Second)
+	sb.GetApp(&ArtifactRequest{Name: "shop"})
+	advance(time.Minute)
+	sb.GetRollout(&RolloutRequest{Name: "shop"})
+	sb.GetApp(&ArtifactRequest{Name: "shop"})
+	sb.Delete(&ArtifactRequest{Name: "shop"})
+	var statuses []string
+	for len(statuses) < 4 {
+		select {
+		case event := <-events:
+			if event.App != "/shop" || event.ReplicaID != "shop.1" {
+				t.Fatalf("unexpected event %+v", event)
+			}
+			statuses = append(statuses, event.Status)
+		case <-time.After(time.Second):
+			t.Fatalf("expected 4 events, got %v", statuses)
+		}
+	}
+	if strings.Join(statuses, ",") != "TASK_STAGING,TASK_RUNNING,TASK_FAILED,TASK_KILLED" {
+		t.Fatalf("unexpected events %v", statuses)
+	}
+}
+
+func TestSimulationGroups(t *testing.T) {
+	sb, _ := newTestSimulation(conf.Simulation{})
+	group := &GroupRequest{Name: "store", Apps: []*BaseRequest{{Name: "db", Replicas: 1}, {Name: "shop", Replicas: 2}}}
+	if _, err := sb.DeployGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sb.DeployGroup(group); err == nil {
+		t.Fatal("expected the group to exist already")
+	}
+	group.Apps = group.Apps[1:]
+	if _, err := sb.UpdateGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	artifact, err := sb.GetGroup(&ArtifactRequest{Name: "store"})
+	if err != nil || len(artifact.Apps) != 1 || artifact.Apps[0].Name != "store/shop" || len(artifact.Apps[0].RunningReplicas) != 2 {
+		t.Fatalf("unexpected group %+v, error %v", artifact, err)
+	}
+	if _, err = sb.GetApp(&ArtifactRequest{Name: "store/db"}); err == nil {
+		t.Fatal("expected the app removed from the group to be deleted")
+	}
+	if _, err = sb.DeleteGroup(&ArtifactRequest{Name: "store"}); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := sb.GetAppNames(Caller{}, nil); len(names) != 0 {
+		t.Fatalf("expected the apps of the group to be deleted, got %v", names)
+	}
+	if _, err = sb.UpdateGroup(group); err == nil {
+		t.Fatal("expected an update of a group not found to fail")
+	}
+}
+
+func TestSimulationGroupRollout(t *testing.T) {
+	sb, advance := newTestSimulation(conf.Simulation{StagingSeconds: 10})
+	group := &GroupRequest{Name: "store", Apps: []*BaseRequest{{Name: "shop", Replicas: 1}}}
+	if _, err := sb.DeployGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	//the app already deployed, even at the same time, and the new one get the version of the deployment of the group
+	group.Apps = append(group.Apps, &BaseRequest{Name: "db", Replicas: 1})
+	id, err := sb.UpdateGroup(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"store/shop", "store/db"} {
+		rollout, _ := sb.GetRollout(&RolloutRequest{Name: name, DeploymentID: id})
+		if rollout.Status != RolloutInProgress || rollout.Deployments[0].ID != id {
+			t.Fatalf("expected the deployment %s of %s in progress, got %+v", id, name, rollout)
+		}
+	}
+	advance(time.Minute)
+	if rollout, _ := sb.GetRollout(&RolloutRequest{Name: "store/db", DeploymentID: id}); rollout.Status != RolloutDone {
+		t.Fatalf("expected the deployment %s completed, got %+v", id, rollout)
+	}
+}
+
+func TestNewForType(t *testing.T) {
+	if _, ok := NewForType("Simulation").(*SimulationBackend); !ok {
+		t.Fatal("expected the simulation backend")
+	}
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/zalando/chimp/types"
+)
+
+//ManagedByLabel is the label of the apps deployed by apply, its value is the name of the definition set
+const ManagedByLabel = "chimp-managed-by"
+
+//ApplySummary lists what apply did on a cluster
+type ApplySummary struct {
+	Created   []string
+	Updated   []string
+	Unchanged []string
+	Pruned    []string
+	Failed    []string
+}
+
+//Apply brings every cluster to the state of the given definitions: missing apps are created, changed ones
+//are updated and identical ones left alone. The apps are labeled as managed by the definition set; with prune
+//the apps of the team managed by the set, but not defined anymore, are deleted.
+//Returns true if every app could be applied on every cluster.
+func (bc *Client) Apply(set string, cmdReqs []CmdClientRequest, prune bool) bool {
+	success := true
+	for _, clusterName := range bc.Clusters {
+		summary := bc.applyCluster(clusterName, set, cmdReqs, prune)
+		printApplySummary(clusterName, summary)
+		success = success && len(summary.Failed) == 0
+	}
+	return success
+}
+
+func (bc *Client) applyCluster(clusterName string, set string, cmdReqs []CmdClientRequest, prune bool) *ApplySummary {
+	summary := &ApplySummary{}
+	defined := make(map[string]bool, len(cmdReqs))
+	for i := range cmdReqs {
+		cmdReq := cmdReqs[i] //the labels are changed on a copy
+		labels := make(map[string]string, len(cmdReq.Labels)+1)
+		for k, v := range cmdReq.Labels {
+			labels[k] = v
+		}
+		labels[ManagedByLabel] = set
+		cmdReq.Labels = labels
+		defined[cmdReq.Name] = true
+
+		var diff DiffResult
+		dryRunURL := bc.buildDeploymentURL(cmdReq.Name, map[string]string{"dryRun": "true"}, clusterName)
+		if err := bc.call("PUT", dryRunURL, buildDeployBody(&cmdReq), &diff); err != nil {
+			fmt.Printf("Cannot compare %s: %s\n", cmdReq.Name, err)
+			summary.Failed = append(summary.Failed, cmdReq.Name)
+			continue
+		}
+		method, target, done := "PUT", bc.buildDeploymentURL(cmdReq.Name, nil, clusterName), &summary.Updated
+		if !diff.Exists {
+			method, target, done = "POST", bc.buildDeploymentURL("", nil, clusterName), &summary.Created
+		} else if len(diff.Changes) == 0 {
+			summary.Unchanged = append(summary.Unchanged, cmdReq.Name)
+			continue
+		}
+		var result DeploymentResult
+		if err := bc.call(method, target, buildDeployBody(&cmdReq), &result); err != nil {
+			fmt.Printf("Cannot apply %s: %s\n", cmdReq.Name, err)
+			summary.Failed = append(summary.Failed, cmdReq.Name)
+			continue
+		}
+		if bc.Wait && !bc.WaitRollout(result.Name, result.DeploymentID, clusterName) {
+			summary.Failed = append(summary.Failed, cmdReq.Name)
+			continue
+		}
+		*done = append(*done, cmdReq.Name)
+	}
+	if !prune {
+		return summary
+	}
+
+	//the list is limited to the apps of the team by the server
+	listURL := bc.buildDeploymentURL("", map[string]string{"label": fmt.Sprintf("%s=%s", ManagedByLabel, set)}, clusterName)
+	var managed ListDeployments
+	if err := bc.call("GET", listURL, nil, &managed); err != nil {
+		fmt.Printf("Cannot list the apps managed by %s: %s\n", set, err)
+		summary.Failed = append(summary.Failed, "prune")
+		return summary
+	}
+	for _, name := range managed.Deployments {
+		name = strings.TrimPrefix(name, "/")
+		if defined[name] {
+			continue
+		}
+		if err := bc.call("DELETE", bc.buildDeploymentURL(name, nil, clusterName), nil, nil); err != nil {
+			fmt.Printf("Cannot prune %s: %s\n", name, err)
+			summary.Failed = append(summary.Failed, name)
+			continue
+		}
+		summary.Pruned = append(summary.Pruned, name)
+	}
+	return summary
+}
+
+//call makes a request to chimp-server and, if result is not nil, reads the response into it.
+//Errors answered by the server are returned as errors.
+func (bc *Client) call(method string, url string, entity interface{}, result interface{}) error {
+	_, res, err := bc.makeRequest(method, url, entity)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case !checkStatusOK(res.StatusCode):
+		return fmt.Errorf("server error %s", res.Status)
+	case !checkAuthOK(res.StatusCode):
+		return errors.New("not authorized, please check the provided token")
+	case res.StatusCode >= 400:
+		e := Error{}
+		unmarshalResponse(res, &e)
+		return errors.New(e.Err)
+	}
+	if result == nil {
+		return nil
+	}
+	return unmarshalResponse(res, result)
+}
+
+func printApplySummary(clusterName string, summary *ApplySummary) {
+	fmt.Println(clusterName)
+	fmt.Printf("\tcreated: %s\n", strings.Join(summary.Created, ", "))
+	fmt.Printf("\tupdated: %s\n", strings.Join(summary.Updated, ", "))
+	fmt.Printf("\tunchanged: %s\n", strings.Join(summary.Unchanged, ", "))
+	fmt.Printf("\tpruned: %s\n", strings.Join(summary.Pruned, ", "))
+	if len(summary.Failed) > 0 {
+		fmt.Printf("\tfailed: %s\n", strings.Join(summary.Failed, ", "))
+	}
+}
@@ -2,7 +2,9 @@ package client
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -11,6 +13,8 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	printer "github.com/olekukonko/tablewriter"
 	konfig "github.com/zalando/chimp/conf/client"
@@ -24,8 +28,13 @@ type Client struct {
 	AccessToken string
 	Scheme      string
 	Clusters    []string
+	Wait        bool          //if true, create/update/scale wait for the rollout to complete
+	Timeout     time.Duration //maximum time to wait for a rollout
 }
 
+//rolloutPollInterval is the time between two checks of a rollout in progress
+var rolloutPollInterval = 2 * time.Second
+
 var homeDirectories = []string{"HOME", "USERPROFILES"}
 
 //RenewAccessToken is used to get a new Oauth2 access token
@@ -126,6 +135,20 @@ func (bc *Client) buildDeploymentURL(name string, params map[string]string, clus
 	return u.String()
 }
 
+//buildGroupURL builds the URL of a group, or of the groups resource if name is empty
+func (bc *Client) buildGroupURL(name string, cluster string) string {
+	u, _ := url.Parse(bc.buildDeploymentURL("", nil, cluster))
+	u.Path = path.Join("/groups", url.QueryEscape(name))
+	return u.String()
+}
+
+//buildDeploymentResourceURL builds the URL of a sub resource of a deployment, p.e. /deployments/NAME/versions
+func (bc *Client) buildDeploymentResourceURL(name string, resource string, params map[string]string, cluster string) string {
+	u, _ := url.Parse(bc.buildDeploymentURL(name, params, cluster))
+	u.Path = path.Join(u.Path, resource)
+	return u.String()
+}
+
 func (bc *Client) buildDeploymentReplicasURL(name string, replicas int, cluster string, force bool) string {
 	u := new(url.URL)
 	u.Scheme = bc.Scheme
@@ -250,14 +273,13 @@ func (bc *Client) ListDeploy(all bool) {
 }
 
 //CreateDeploy is used to deploy a new app. If an app with the same name is already deployed,
-//an error will be returned.
-func (bc *Client) CreateDeploy(cmdReq *CmdClientRequest) {
+//an error will be returned. Returns true if the app was deployed successfully on every cluster.
+func (bc *Client) CreateDeploy(cmdReq *CmdClientRequest) bool {
+	success := true
 	//for each datacenter, create the app
 	for _, clusterName := range bc.Clusters {
 		fmt.Println(clusterName)
-		deploy := map[string]interface{}{"Name": cmdReq.Name, "Ports": cmdReq.Ports, "Labels": cmdReq.Labels,
-			"ImageURL": cmdReq.ImageURL, "Env": cmdReq.Env, "Replicas": cmdReq.Replicas, "CPULimit": cmdReq.CPULimit,
-			"MemoryLimit": cmdReq.MemoryLimit, "Force": cmdReq.Force, "Volumes": cmdReq.Volumes}
+		deploy := buildDeployBody(cmdReq)
 		url := bc.buildDeploymentURL("", nil, clusterName)
 		_, res, err := bc.makeRequest("POST", url, deploy)
 		if res != nil {
@@ -265,6 +287,7 @@ func (bc *Client) CreateDeploy(cmdReq *CmdClientRequest) {
 		}
 		if err != nil {
 			fmt.Println(errorMessageBuilder("Deploy unsuccessful", err))
+			success = false
 			continue
 		}
 		if checkStatusOK(res.StatusCode) {
@@ -273,34 +296,149 @@ func (bc *Client) CreateDeploy(cmdReq *CmdClientRequest) {
 					e := Error{}
 					unmarshalResponse(res, &e)
 					fmt.Printf("Deploy unsuccessful: %s\n", e.Err)
+					success = false
 				} else {
 					fmt.Println("Application successfully deployed.")
+					success = bc.waitForResult(res, clusterName) && success
 				}
 			} else {
 				handleAuthNOK(res.StatusCode)
+				success = false
 			}
 		} else {
 			handleStatusNOK(res.StatusCode)
+			success = false
 		}
 
 	}
+	return success
+}
+
+//buildDeployBody builds the body of the request to deploy an app
+func buildDeployBody(cmdReq *CmdClientRequest) map[string]interface{} {
+	return map[string]interface{}{"Name": cmdReq.Name, "Ports": cmdReq.Ports, "Labels": cmdReq.Labels,
+		"ImageURL": cmdReq.ImageURL, "Env": cmdReq.Env, "Replicas": cmdReq.Replicas, "CPULimit": cmdReq.CPULimit,
+		"MemoryLimit": cmdReq.MemoryLimit, "DiskLimit": cmdReq.DiskLimit, "Force": cmdReq.Force, "Volumes": cmdReq.Volumes, "HealthChecks": cmdReq.HealthChecks,
+		"UpdateStrategy": cmdReq.UpdateStrategy, "Dependencies": cmdReq.Dependencies, "Constraints": cmdReq.Constraints,
+		"Host": cmdReq.Host}
+}
+
+//DeployGroup deploys all the apps of a definition atomically as a group. If update is set an existing group
+//is updated, otherwise the group must not exist yet. Returns true if the group was deployed successfully on every cluster.
+func (bc *Client) DeployGroup(name string, cmdReqs []CmdClientRequest, update bool) bool {
+	apps := make([]map[string]interface{}, 0, len(cmdReqs))
+	for i := range cmdReqs {
+		apps = append(apps, buildDeployBody(&cmdReqs[i]))
+	}
+	group := map[string]interface{}{"Name": name, "Apps": apps}
+	method, groupName, action := "POST", "", "deployed"
+	if update {
+		method, groupName, action = "PUT", name, "updated"
+	}
+	success := true
+	for _, clusterName := range bc.Clusters {
+		fmt.Println(clusterName)
+		url := bc.buildGroupURL(groupName, clusterName)
+		_, res, err := bc.makeRequest(method, url, group)
+		if res != nil {
+			defer res.Body.Close()
+		}
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Group deploy unsuccessful", err))
+			success = false
+			continue
+		}
+		if checkStatusOK(res.StatusCode) {
+			if checkAuthOK(res.StatusCode) {
+				if res.StatusCode >= 400 && res.StatusCode <= 499 {
+					e := Error{}
+					unmarshalResponse(res, &e)
+					fmt.Printf("Group deploy unsuccessful: %s\n", e.Err)
+					success = false
+				} else {
+					fmt.Printf("Group successfully %s.\n", action)
+					success = bc.waitForGroup(res, clusterName) && success
+				}
+			} else {
+				handleAuthNOK(res.StatusCode)
+				success = false
+			}
+		} else {
+			handleStatusNOK(res.StatusCode)
+			success = false
+		}
+	}
+	return success
+}
 
+//waitForGroup waits for the rollout of the apps of a group, if the client is set to wait.
+//Returns false only if the rollout did not complete.
+func (bc *Client) waitForGroup(res *http.Response, clusterName string) bool {
+	if !bc.Wait {
+		return true
+	}
+	var result DeploymentResult
+	if err := unmarshalResponse(res, &result); err != nil {
+		fmt.Printf("Cannot wait for rollout: %s\n", err.Error())
+		return false
+	}
+	return bc.WaitGroupRollout(result.Name, result.DeploymentID, clusterName)
 }
 
-//UpdateDeploy is used to update an already deployed app
-func (bc *Client) UpdateDeploy(cmdReq *CmdClientRequest) {
+//UpdateDeploy is used to update an already deployed app.
+//Returns true if the app was updated successfully on every cluster.
+func (bc *Client) UpdateDeploy(cmdReq *CmdClientRequest) bool {
+	success := true
 	for _, clusterName := range bc.Clusters {
 		fmt.Println(clusterName)
-		deploy := map[string]interface{}{"Name": cmdReq.Name, "Ports": cmdReq.Ports, "Labels": cmdReq.Labels,
-			"ImageURL": cmdReq.ImageURL, "Env": cmdReq.Env, "Replicas": cmdReq.Replicas, "CPULimit": cmdReq.CPULimit,
-			"MemoryLimit": cmdReq.MemoryLimit, "Force": cmdReq.Force}
 		url := bc.buildDeploymentURL(cmdReq.Name, nil, clusterName)
-		_, res, err := bc.makeRequest("PUT", url, deploy)
+		_, res, err := bc.makeRequest("PUT", url, buildDeployBody(cmdReq))
 		if res != nil {
 			defer res.Body.Close()
 		}
 		if err != nil {
 			fmt.Println(errorMessageBuilder("Deploy unsuccessful", err))
+			success = false
+			continue
+		}
+		if checkStatusOK(res.StatusCode) {
+			if checkAuthOK(res.StatusCode) {
+				if res.StatusCode >= 400 && res.StatusCode <= 499 {
+					e := Error{}
+					unmarshalResponse(res, &e)
+					fmt.Printf("Update unsuccessful: %s\n", e.Err)
+					success = false
+				} else {
+					fmt.Println("Application successfully updated.")
+					success = bc.waitForResult(res, clusterName) && success
+				}
+			} else {
+				handleAuthNOK(res.StatusCode)
+				success = false
+			}
+		} else {
+			handleStatusNOK(res.StatusCode)
+			success = false
+		}
+	}
+	return success
+}
+
+//Patch changes only some settings of an already deployed app, p.e. {"imageURL": "..."}. The patch is a JSON merge
+//patch: objects like env and labels are merged and a nil value removes a key.
+//Returns true if the app was updated successfully on every cluster.
+func (bc *Client) Patch(name string, patch map[string]interface{}) bool {
+	success := true
+	for _, clusterName := range bc.Clusters {
+		fmt.Println(clusterName)
+		url := bc.buildDeploymentURL(name, nil, clusterName)
+		_, res, err := bc.makeRequest("PATCH", url, patch)
+		if res != nil {
+			defer res.Body.Close()
+		}
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Update unsuccessful", err))
+			success = false
 			continue
 		}
 		if checkStatusOK(res.StatusCode) {
@@ -309,20 +447,102 @@ func (bc *Client) UpdateDeploy(cmdReq *CmdClientRequest) {
 					e := Error{}
 					unmarshalResponse(res, &e)
 					fmt.Printf("Update unsuccessful: %s\n", e.Err)
+					success = false
 				} else {
 					fmt.Println("Application successfully updated.")
+					success = bc.waitForResult(res, clusterName) && success
+				}
+			} else {
+				handleAuthNOK(res.StatusCode)
+				success = false
+			}
+		} else {
+			handleStatusNOK(res.StatusCode)
+			success = false
+		}
+	}
+	return success
+}
+
+//Diff shows, for every cluster, the changes that updating the app with the given request would make.
+//Returns true if the changes could be computed on every cluster.
+func (bc *Client) Diff(cmdReq *CmdClientRequest) bool {
+	success := true
+	color := terminal.IsTerminal(int(os.Stdout.Fd()))
+	for _, clusterName := range bc.Clusters {
+		fmt.Println(clusterName)
+		url := bc.buildDeploymentURL(cmdReq.Name, map[string]string{"dryRun": "true"}, clusterName)
+		_, res, err := bc.makeRequest("PUT", url, buildDeployBody(cmdReq))
+		if res != nil {
+			defer res.Body.Close()
+		}
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Diff unsuccessful", err))
+			success = false
+			continue
+		}
+		if checkStatusOK(res.StatusCode) {
+			if checkAuthOK(res.StatusCode) {
+				if res.StatusCode >= 400 && res.StatusCode <= 499 {
+					e := Error{}
+					unmarshalResponse(res, &e)
+					fmt.Printf("Diff unsuccessful: %s\n", e.Err)
+					success = false
+				} else {
+					result := DiffResult{}
+					unmarshalResponse(res, &result)
+					printDiff(os.Stdout, &result, color)
 				}
 			} else {
 				handleAuthNOK(res.StatusCode)
+				success = false
 			}
 		} else {
 			handleStatusNOK(res.StatusCode)
+			success = false
 		}
 	}
+	return success
 }
 
-//Scale is used to scale an existing application to the number of replicas specified
-func (bc *Client) Scale(name string, replicas int, force bool) {
+//colors of the changes printed by diff
+const (
+	colorAdded   = "\x1b[32m"
+	colorRemoved = "\x1b[31m"
+	colorChanged = "\x1b[33m"
+	colorReset   = "\x1b[0m"
+)
+
+//printDiff prints the changes of a dry run one per line: + for added, - for removed and ~ for changed settings
+func printDiff(out io.Writer, result *DiffResult, color bool) {
+	if !result.Exists {
+		fmt.Fprintf(out, "%s is not deployed yet, it would be created\n", result.Name)
+	}
+	if len(result.Changes) == 0 {
+		fmt.Fprintf(out, "%s: no changes\n", result.Name)
+		return
+	}
+	for _, change := range result.Changes {
+		var line, code string
+		switch change.Action {
+		case DiffAdded:
+			line, code = fmt.Sprintf("+ %s: %s", change.Field, change.Requested), colorAdded
+		case DiffRemoved:
+			line, code = fmt.Sprintf("- %s: %s", change.Field, change.Current), colorRemoved
+		default:
+			line, code = fmt.Sprintf("~ %s: %s -> %s", change.Field, change.Current, change.Requested), colorChanged
+		}
+		if color {
+			line = code + line + colorReset
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+//Scale is used to scale an existing application to the number of replicas specified.
+//Returns true if the app was scaled successfully on every cluster.
+func (bc *Client) Scale(name string, replicas int, force bool) bool {
+	success := true
 	for _, clusterName := range bc.Clusters {
 		fmt.Println(clusterName)
 		deploy := map[string]interface{}{"Name": name, "Replicas": replicas}
@@ -333,6 +553,7 @@ func (bc *Client) Scale(name string, replicas int, force bool) {
 		}
 		if err != nil {
 			fmt.Println(errorMessageBuilder("Cannot scale", err))
+			success = false
 			continue
 		}
 		if checkStatusOK(res.StatusCode) {
@@ -341,16 +562,365 @@ func (bc *Client) Scale(name string, replicas int, force bool) {
 					e := Error{}
 					unmarshalResponse(res, &e)
 					fmt.Printf("Scale unsuccessful: %s\n", e.Err)
+					success = false
 				} else {
 					fmt.Println("Application scaled.")
+					success = bc.waitForResult(res, clusterName) && success
 				}
 			} else {
 				handleAuthNOK(res.StatusCode)
+				success = false
 			}
 		} else {
 			handleStatusNOK(res.StatusCode)
+			success = false
+		}
+	}
+	return success
+}
+
+//waitForResult reads the deployment started by a request and, if the client is set to wait,
+//blocks till its rollout is over. Returns false only if the rollout did not complete.
+func (bc *Client) waitForResult(res *http.Response, clusterName string) bool {
+	if !bc.Wait {
+		return true
+	}
+	var result DeploymentResult
+	if err := unmarshalResponse(res, &result); err != nil {
+		fmt.Printf("Cannot wait for rollout: %s\n", err.Error())
+		return false
+	}
+	return bc.WaitRollout(result.Name, result.DeploymentID, clusterName)
+}
+
+//WaitRollout polls the rollout of a deployment till it is done, failed or the client timeout expires.
+//Returns true only if the rollout completed successfully.
+func (bc *Client) WaitRollout(name string, deploymentID string, clusterName string) bool {
+	var query map[string]string
+	if deploymentID != "" {
+		query = map[string]string{"deploymentID": deploymentID}
+	}
+	return bc.pollRollout(bc.buildDeploymentResourceURL(name, "rollout", query, clusterName))
+}
+
+//WaitGroupRollout polls the rollout of all the apps of a group, like WaitRollout does for a single deployment.
+func (bc *Client) WaitGroupRollout(name string, deploymentID string, clusterName string) bool {
+	u, _ := url.Parse(bc.buildGroupURL(name, clusterName))
+	u.Path = path.Join(u.Path, "rollout")
+	if deploymentID != "" {
+		u.RawQuery = url.Values{"deploymentID": []string{deploymentID}}.Encode()
+	}
+	return bc.pollRollout(u.String())
+}
+
+//pollRollout gets the rollout at the given URL till it is done, failed or the client timeout expires.
+func (bc *Client) pollRollout(url string) bool {
+	deadline := time.Now().Add(bc.Timeout)
+	lastProgress := ""
+	for {
+		rollout, err := bc.getRollout(url)
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Cannot get rollout", err))
+			return false
+		}
+		switch rollout.Status {
+		case RolloutDone:
+			fmt.Println("Rollout completed.")
+			return true
+		case RolloutFailed:
+			fmt.Printf("Rollout failed: %s\n", rollout.Message)
+			return false
+		}
+		if progress := describeRollout(rollout); progress != lastProgress {
+			fmt.Println(progress)
+			lastProgress = progress
 		}
+		if time.Now().After(deadline) {
+			fmt.Printf("Timed out after %s waiting for the rollout.\n", bc.Timeout)
+			return false
+		}
+		time.Sleep(rolloutPollInterval)
+	}
+}
+
+func (bc *Client) getRollout(url string) (*Rollout, error) {
+	_, res, err := bc.makeRequest("GET", url, nil)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		e := Error{}
+		unmarshalResponse(res, &e)
+		return nil, fmt.Errorf("%d %s", res.StatusCode, e.Err)
+	}
+	var rollout Rollout
+	err = unmarshalResponse(res, &rollout)
+	return &rollout, err
+}
+
+func describeRollout(rollout *Rollout) string {
+	lines := make([]string, 0, len(rollout.Deployments)+1)
+	for _, deployment := range rollout.Deployments {
+		lines = append(lines, fmt.Sprintf("Deployment %s: step %d/%d %s", deployment.ID, deployment.CurrentStep, deployment.TotalSteps,
+			strings.Join(deployment.CurrentActions, ", ")))
+	}
+	if rollout.Message != "" {
+		lines = append(lines, fmt.Sprintf("Last failure: %s", rollout.Message))
 	}
+	return strings.Join(lines, "\n")
+}
+
+//History is used to get the list of versions of a deployment
+func (bc *Client) History(name string) {
+	for _, clusterName := range bc.Clusters {
+		fmt.Println(clusterName)
+		url := bc.buildDeploymentResourceURL(name, "versions", nil, clusterName)
+		_, res, err := bc.makeRequest("GET", url, nil)
+		if res != nil {
+			defer res.Body.Close()
+		}
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Cannot get versions", err))
+			continue
+		}
+		if checkStatusOK(res.StatusCode) {
+			if checkAuthOK(res.StatusCode) {
+				if res.StatusCode >= 400 && res.StatusCode <= 499 {
+					e := Error{}
+					unmarshalResponse(res, &e)
+					fmt.Printf("Cannot get versions: %s\n", e.Err)
+				} else {
+					var lv ListVersions
+					unmarshalResponse(res, &lv)
+					fmt.Printf("Versions of %s, most recent first: \n", name)
+					for _, version := range lv.Versions {
+						fmt.Printf("\t%s\n", version)
+					}
+				}
+			} else {
+				handleAuthNOK(res.StatusCode)
+			}
+		} else {
+			handleStatusNOK(res.StatusCode)
+		}
+	}
+}
+
+//Rollback is used to set a deployment back to a previous version. If version is empty
+//the version before the current one is used.
+func (bc *Client) Rollback(name string, version string) {
+	for _, clusterName := range bc.Clusters {
+		fmt.Println(clusterName)
+		var query map[string]string
+		if version != "" {
+			query = map[string]string{"version": version}
+		}
+		url := bc.buildDeploymentResourceURL(name, "rollback", query, clusterName)
+		_, res, err := bc.makeRequest("POST", url, nil)
+		if res != nil {
+			defer res.Body.Close()
+		}
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Cannot roll back", err))
+			continue
+		}
+		if checkStatusOK(res.StatusCode) {
+			if checkAuthOK(res.StatusCode) {
+				if res.StatusCode >= 400 && res.StatusCode <= 499 {
+					e := Error{}
+					unmarshalResponse(res, &e)
+					fmt.Printf("Rollback unsuccessful: %s\n", e.Err)
+				} else {
+					fmt.Println("Rollback started.")
+				}
+			} else {
+				handleAuthNOK(res.StatusCode)
+			}
+		} else {
+			handleStatusNOK(res.StatusCode)
+		}
+	}
+}
+
+//Cancel cancels the deployments in progress of an app. Unless force is set, the app is rolled back
+//and, if the client is set to wait, the rollback is awaited. Returns false if the rollout could not be cancelled in a cluster.
+func (bc *Client) Cancel(name string, force bool) bool {
+	success := true
+	for _, clusterName := range bc.Clusters {
+		fmt.Println(clusterName)
+		query := map[string]string{"force": strconv.FormatBool(force)}
+		url := bc.buildDeploymentResourceURL(name, "rollout", query, clusterName)
+		_, res, err := bc.makeRequest("DELETE", url, nil)
+		if res != nil {
+			defer res.Body.Close()
+		}
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Cannot cancel rollout", err))
+			success = false
+			continue
+		}
+		if checkStatusOK(res.StatusCode) {
+			if checkAuthOK(res.StatusCode) {
+				if res.StatusCode >= 400 && res.StatusCode <= 499 {
+					e := Error{}
+					unmarshalResponse(res, &e)
+					fmt.Printf("Cannot cancel rollout: %s\n", e.Err)
+					success = false
+				} else {
+					result := CancelResult{}
+					unmarshalResponse(res, &result)
+					for _, deployment := range result.Deployments {
+						if deployment.RollbackID == "" {
+							fmt.Printf("Cancelled deployment %s of version %s without rollback\n", deployment.ID, deployment.Version)
+							continue
+						}
+						fmt.Printf("Cancelled deployment %s of version %s, rolling back with deployment %s\n", deployment.ID,
+							deployment.Version, deployment.RollbackID)
+						if bc.Wait {
+							success = bc.WaitRollout(name, deployment.RollbackID, clusterName) && success
+						}
+					}
+				}
+			} else {
+				handleAuthNOK(res.StatusCode)
+				success = false
+			}
+		} else {
+			handleStatusNOK(res.StatusCode)
+			success = false
+		}
+	}
+	return success
+}
+
+//Kill kills one replica of a deployment, or all of them if replicaID is empty. The killed replicas are replaced,
+//unless scale is set: then the deployment is scaled down. Returns false if the replicas could not be killed in a cluster.
+func (bc *Client) Kill(name string, replicaID string, scale bool) bool {
+	success := true
+	for _, clusterName := range bc.Clusters {
+		fmt.Println(clusterName)
+		query := map[string]string{"scale": strconv.FormatBool(scale)}
+		url := bc.buildDeploymentResourceURL(name, path.Join("replicas", replicaID), query, clusterName)
+		_, res, err := bc.makeRequest("DELETE", url, nil)
+		if res != nil {
+			defer res.Body.Close()
+		}
+		if err != nil {
+			fmt.Println(errorMessageBuilder("Cannot kill replicas", err))
+			success = false
+			continue
+		}
+		if checkStatusOK(res.StatusCode) {
+			if checkAuthOK(res.StatusCode) {
+				if res.StatusCode >= 400 && res.StatusCode <= 499 {
+					e := Error{}
+					unmarshalResponse(res, &e)
+					fmt.Printf("Cannot kill replicas: %s\n", e.Err)
+					success = false
+				} else {
+					result := KillResult{}
+					unmarshalResponse(res, &result)
+					for _, replica := range result.Replicas {
+						fmt.Printf("Killed replica %s\n", replica)
+					}
+				}
+			} else {
+				handleAuthNOK(res.StatusCode)
+				success = false
+			}
+		} else {
+			handleStatusNOK(res.StatusCode)
+			success = false
+		}
+	}
+	return success
+}
+
+//Watch prints the events of a deployment as they arrive, till the connection to every cluster is closed
+func (bc *Client) Watch(name string) {
+	var wg sync.WaitGroup
+	for _, clusterName := range bc.Clusters {
+		wg.Add(1)
+		go func(clusterName string) {
+			defer wg.Done()
+			url := bc.buildDeploymentResourceURL(name, "events", nil, clusterName)
+			_, res, err := bc.makeRequest("GET", url, nil)
+			if res != nil {
+				defer res.Body.Close()
+			}
+			if err != nil {
+				fmt.Printf("%s: %s\n", clusterName, errorMessageBuilder("Cannot watch deployment", err))
+				return
+			}
+			if !checkStatusOK(res.StatusCode) {
+				handleStatusNOK(res.StatusCode)
+				return
+			}
+			if !checkAuthOK(res.StatusCode) {
+				handleAuthNOK(res.StatusCode)
+				return
+			}
+			if res.StatusCode >= 400 && res.StatusCode <= 499 {
+				e := Error{}
+				unmarshalResponse(res, &e)
+				fmt.Printf("%s: Cannot watch deployment: %s\n", clusterName, e.Err)
+				return
+			}
+			fmt.Printf("%s: Watching %s\n", clusterName, name)
+			err = readEvents(res.Body, func(event *Event) {
+				fmt.Printf("%s: %s\n", clusterName, describeEvent(event))
+			})
+			if err != nil {
+				fmt.Printf("%s: %s\n", clusterName, errorMessageBuilder("Stopped watching", err))
+			}
+		}(clusterName)
+	}
+	wg.Wait()
+}
+
+//readEvents reads a stream of server-sent events, calling handle for each event
+func readEvents(r io.Reader, handle func(*Event)) error {
+	scanner := bufio.NewScanner(r)
+	var data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "" && data != "": //an empty line ends the event
+			var event Event
+			if err := json.Unmarshal([]byte(data), &event); err == nil {
+				handle(&event)
+			}
+			data = ""
+		}
+	}
+	return scanner.Err()
+}
+
+//describeEvent builds a human readable line for an event
+func describeEvent(event *Event) string {
+	var description string
+	switch event.Type {
+	case EventStatusUpdate:
+		description = fmt.Sprintf("replica %s on %s is %s", event.ReplicaID, event.Host, event.Status)
+	case EventHealthChanged:
+		description = fmt.Sprintf("replica %s is %s", event.ReplicaID, event.Status)
+	case EventHealthCheckFailed:
+		description = event.Message
+	case EventAppTerminated:
+		description = "application terminated"
+	case EventDeploymentStep:
+		description = fmt.Sprintf("deployment step %s completed", event.Status)
+	case EventDeploymentStepFailed:
+		description = fmt.Sprintf("deployment step %s FAILED", event.Status)
+	default:
+		description = fmt.Sprintf("%s %s %s", event.Type, event.Status, event.Message)
+	}
+	return fmt.Sprintf("[%s] %s", event.Timestamp, description)
 }
 
 func errorMessageBuilder(message string, err error) string {
@@ -363,24 +933,26 @@ func errorMessageBuilder(message string, err error) string {
 func printInfoTable(verbose bool, artifact Artifact) {
 	table := printer.NewWriter(os.Stdout)
 	//iterate table and print
-	table.SetHeader([]string{"Name", "Status", "Endpoints", "Num Replicas", "CPUs", "Memory", "Last Message"})
+	table.SetHeader([]string{"Name", "Status", "Endpoints", "Num Replicas", "CPUs", "Memory", "Disk", "Last Message"})
 	row := []string{}
 	var endpoints string
 	var ports string
 	for _, replica := range artifact.RunningReplicas {
 		endpoints = endpoints + fmt.Sprintf("%s\n", replica.Endpoints)
 		for _, port := range replica.Ports {
-			ports = ports + fmt.Sprintf("%d, ", port.Port)
+			ports = ports + fmt.Sprintf("%d/%s, ", port.Port, port.Protocol)
 		}
 	}
 	row = append(row, artifact.Name)
 	row = append(row, artifact.Status)
 	row = append(row, artifact.Endpoint)
 	row = append(row, fmt.Sprintf("%d/%d", len(artifact.RunningReplicas), artifact.RequestedReplicas))
-	cpus := strconv.FormatFloat(artifact.CPUS, 'f', 1, 64)
+	cpus := strconv.FormatFloat(artifact.CPUS, 'f', -1, 64)
 	memory := strconv.FormatFloat(artifact.Memory, 'f', 1, 64)
+	disk := strconv.FormatFloat(artifact.Disk, 'f', 1, 64)
 	row = append(row, cpus)
 	row = append(row, memory)
+	row = append(row, disk)
 	row = append(row, artifact.Message)
 	table.Append(row)
 	table.Render()
@@ -389,18 +961,39 @@ func printInfoTable(verbose bool, artifact Artifact) {
 	if verbose {
 		containerTable := printer.NewWriter(os.Stdout)
 		containerTable.SetRowLine(true)
-		containerTable.SetHeader([]string{"Container Status", "Image", "Endpoint", "Logfile"})
+		containerTable.SetHeader([]string{"Replica", "Container Status", "Image", "Endpoint", "Logfile", "Health Checks"})
 		for _, replica := range artifact.RunningReplicas {
+			//replicas without IP or ports have no endpoint, like pods not scheduled yet
+			container, endpoint := firstContainer(replica), ""
+			if len(replica.Endpoints) > 0 {
+				endpoint = replica.Endpoints[0]
+			}
 			cRow := []string{}
-			cRow = append(cRow, replica.Containers[0].Status)
-			cRow = append(cRow, replica.Containers[0].ImageURL)
-			cRow = append(cRow, replica.Endpoints[0])
-			cRow = append(cRow, replica.Containers[0].LogInfo["containerName"])
+			cRow = append(cRow, replica.ID)
+			cRow = append(cRow, container.Status)
+			cRow = append(cRow, container.ImageURL)
+			cRow = append(cRow, endpoint)
+			cRow = append(cRow, container.LogInfo["containerName"])
+			cRow = append(cRow, describeHealthChecks(artifact.HealthChecks, replica.HealthChecks))
 			cRow = append(cRow)
 			containerTable.Append(cRow)
 		}
 		containerTable.Render()
 
+		for _, replica := range artifact.RunningReplicas {
+			for _, warning := range replica.Warnings {
+				fmt.Printf("Warning for replica %s: %s\n", replica.ID, warning)
+			}
+			container := firstContainer(replica)
+			if len(container.LogLinks) == 0 {
+				continue
+			}
+			fmt.Printf("Logs of replica %s:\n", replica.ID)
+			for _, link := range container.LogLinks {
+				fmt.Printf("\t%s: %s\n", link.Name, link.URL)
+			}
+		}
+
 		settingsTable := printer.NewWriter(os.Stdout)
 		settingsTable.SetRowLine(true)
 		settingsTable.SetHeader([]string{"Env name", "value"})
@@ -422,6 +1015,51 @@ func printInfoTable(verbose bool, artifact Artifact) {
 			labelsTable.Append(sRow)
 		}
 		labelsTable.Render()
+
+		if len(artifact.Constraints) > 0 {
+			constraintsTable := printer.NewWriter(os.Stdout)
+			constraintsTable.SetRowLine(true)
+			constraintsTable.SetHeader([]string{"Constraint field", "operator", "value"})
+			for _, c := range artifact.Constraints {
+				constraintsTable.Append([]string{c.Field, c.Operator, c.Value})
+			}
+			constraintsTable.Render()
+		}
+	}
+
+}
+
+//firstContainer returns the first container of a replica, or an empty one if the backend reports none
+func firstContainer(replica *Replica) *Container {
+	if len(replica.Containers) == 0 || replica.Containers[0] == nil {
+		return &Container{}
 	}
+	return replica.Containers[0]
+}
 
+//describeHealthChecks builds a human readable description of the health check results of a replica,
+//one line per health check of the app.
+func describeHealthChecks(checks []*HealthCheck, results []*HealthCheckResult) string {
+	lines := make([]string, 0, len(checks))
+	for i, check := range checks {
+		target := check.Protocol
+		switch check.Protocol {
+		case HealthCheckHTTP:
+			target = fmt.Sprintf("%s %s (port %d)", check.Protocol, check.Path, check.PortIndex)
+		case HealthCheckTCP:
+			target = fmt.Sprintf("%s (port %d)", check.Protocol, check.PortIndex)
+		case HealthCheckCommand:
+			target = fmt.Sprintf("%s %s", check.Protocol, check.Command)
+		}
+		result := "UNKNOWN"
+		if i < len(results) && results[i] != nil {
+			if results[i].Alive {
+				result = "ALIVE"
+			} else {
+				result = fmt.Sprintf("NOT ALIVE, %d failures, last at %s", results[i].ConsecutiveFailures, results[i].LastFailure)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", target, result))
+	}
+	return strings.Join(lines, "\n")
 }
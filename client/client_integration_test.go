@@ -40,10 +40,10 @@ func TestDeploy(t *testing.T) {
 		Name:        "randomname",
 		ImageURL:    "pierone.stups.zalan.do/cat/cat-hello-aws:0.0.1",
 		Replicas:    2,
-		Ports:       []int{8080},
+		Ports:       []Port{{ContainerPort: 8080}},
 		Labels:      map[string]string{"name": "auto-test"},
 		Env:         map[string]string{"name": "env-test"},
-		CPULimit:    0,
+		CPULimit:    "0.5",
 		MemoryLimit: "2048",
 		Force:       true,
 	}
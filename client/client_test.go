@@ -1 +1,251 @@
 package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/chimp/backend"
+	konfig "github.com/zalando/chimp/conf/client"
+	. "github.com/zalando/chimp/types"
+)
+
+//getTestClient returns a client pointing to the given test server as cluster "TEST"
+func getTestClient(t *testing.T, server *httptest.Server) *Client {
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	clusters := map[string]*konfig.Cluster{"TEST": &konfig.Cluster{IP: host, Port: p}}
+	return &Client{Config: &konfig.ClientConfig{Clusters: clusters}, Scheme: "http", Clusters: []string{"TEST"}, Timeout: time.Second}
+}
+
+func TestWaitRollout(t *testing.T) {
+	rolloutPollInterval = time.Millisecond
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/deployments/app/rollout" || r.URL.Query().Get("deploymentID") != "42" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		calls++
+		rollout := Rollout{Name: "app", Status: RolloutInProgress,
+			Deployments: []*RolloutDeployment{&RolloutDeployment{ID: "42", CurrentStep: calls, TotalSteps: 3}}}
+		if calls == 3 {
+			rollout.Status = RolloutDone
+		}
+		json.NewEncoder(w).Encode(rollout)
+	}))
+	defer server.Close()
+
+	if !getTestClient(t, server).WaitRollout("app", "42", "TEST") || calls != 3 {
+		t.Fatalf("expected the rollout to complete after 3 calls, got %d", calls)
+	}
+}
+
+func TestWaitRolloutFailed(t *testing.T) {
+	rolloutPollInterval = time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Rollout{Name: "app", Status: RolloutFailed, Message: "TASK_FAILED"})
+	}))
+	defer server.Close()
+
+	if getTestClient(t, server).WaitRollout("app", "", "TEST") {
+		t.Fatal("expected the rollout to fail")
+	}
+}
+
+func TestWaitRolloutTimeout(t *testing.T) {
+	rolloutPollInterval = time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Rollout{Name: "app", Status: RolloutInProgress})
+	}))
+	defer server.Close()
+
+	client := getTestClient(t, server)
+	client.Timeout = 10 * time.Millisecond
+	if client.WaitRollout("app", "", "TEST") {
+		t.Fatal("expected the rollout to time out")
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := "event:STATUS_UPDATE\ndata:{\"Type\":\"STATUS_UPDATE\",\"App\":\"/app\",\"ReplicaID\":\"app.1\",\"Status\":\"TASK_RUNNING\"}\n\n" +
+		"event:HEALTH_CHANGED\ndata:{\"Type\":\"HEALTH_CHANGED\",\"App\":\"/app\",\"ReplicaID\":\"app.1\",\"Status\":\"unhealthy\"}\n\n"
+	var events []*Event
+	err := readEvents(strings.NewReader(stream), func(event *Event) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Status != "TASK_RUNNING" || events[1].Type != EventHealthChanged {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestKill(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Query().Get("scale") != "true" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		paths = append(paths, r.URL.Path)
+		json.NewEncoder(w).Encode(KillResult{Name: "app", Replicas: []string{"app.1"}})
+	}))
+	defer server.Close()
+
+	client := getTestClient(t, server)
+	if !client.Kill("app", "app.1", true) || !client.Kill("app", "", true) {
+		t.Fatal("expected the kill to succeed")
+	}
+	if len(paths) != 2 || paths[0] != "/deployments/app/replicas/app.1" || paths[1] != "/deployments/app/replicas" {
+		t.Fatalf("unexpected paths %s", paths)
+	}
+}
+
+func TestDeployGroup(t *testing.T) {
+	var group GroupDeployRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/groups/shop":
+			json.NewDecoder(r.Body).Decode(&group)
+			json.NewEncoder(w).Encode(DeploymentResult{Name: "shop", DeploymentID: "42"})
+		case r.Method == "GET" && r.URL.Path == "/groups/shop/rollout" && r.URL.Query().Get("deploymentID") == "42":
+			json.NewEncoder(w).Encode(Rollout{Name: "shop", Status: RolloutDone})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client := getTestClient(t, server)
+	client.Wait = true
+	apps := []CmdClientRequest{{Name: "frontend", Dependencies: []string{"backend"}}, {Name: "backend"}}
+	if !client.DeployGroup("shop", apps, true) {
+		t.Fatal("expected the group to be deployed")
+	}
+	if group.Name != "shop" || len(group.Apps) != 2 || group.Apps[0].Dependencies[0] != "backend" {
+		t.Fatalf("unexpected group request %+v", group)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "DELETE" && r.URL.Path == "/deployments/app/rollout" && r.URL.Query().Get("force") == "false":
+			json.NewEncoder(w).Encode(CancelResult{Name: "app", Deployments: []*CancelledDeployment{{ID: "1", RollbackID: "2"}}})
+		case r.Method == "GET" && r.URL.Path == "/deployments/app/rollout" && r.URL.Query().Get("deploymentID") == "2":
+			json.NewEncoder(w).Encode(Rollout{Name: "app", Status: RolloutDone})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Error{Err: "application app has no deployment in progress"})
+		}
+	}))
+	defer server.Close()
+
+	client := getTestClient(t, server)
+	client.Wait = true
+	if !client.Cancel("app", false) {
+		t.Fatal("expected the rollout to be cancelled and rolled back")
+	}
+	if client.Cancel("app", true) {
+		t.Fatal("expected the cancel to fail")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/deployments/app" || r.URL.Query().Get("dryRun") != "true" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		json.NewEncoder(w).Encode(DiffResult{Name: "app", Exists: true})
+	}))
+	defer server.Close()
+
+	client := getTestClient(t, server)
+	if !client.Diff(&CmdClientRequest{Name: "app", ImageURL: "app:2"}) {
+		t.Fatal("expected the diff to succeed")
+	}
+}
+
+func TestPrintDiff(t *testing.T) {
+	var out bytes.Buffer
+	printDiff(&out, &DiffResult{Name: "app", Exists: true, Changes: []*FieldChange{
+		{Field: "env.NEW", Action: DiffAdded, Requested: `"new"`},
+		{Field: "env.OLD", Action: DiffRemoved, Current: `"old"`},
+		{Field: "imageURL", Action: DiffChanged, Current: `"app:1"`, Requested: `"app:2"`},
+	}}, false)
+	expected := "+ env.NEW: \"new\"\n- env.OLD: \"old\"\n~ imageURL: \"app:1\" -> \"app:2\"\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected diff:\n%s", out.String())
+	}
+	out.Reset()
+	printDiff(&out, &DiffResult{Name: "app", Changes: []*FieldChange{{Field: "imageURL", Action: DiffAdded, Requested: `"app:1"`}}}, true)
+	if !strings.Contains(out.String(), "not deployed yet") || !strings.Contains(out.String(), colorAdded+"+ imageURL") {
+		t.Fatalf("unexpected colored diff:\n%q", out.String())
+	}
+}
+
+func TestPrintInfoTable(t *testing.T) {
+	env, labels := map[string]string{}, map[string]string{"team": "cats"}
+	//a pod not scheduled yet has neither endpoints nor containers
+	printInfoTable(true, Artifact{Name: "pending", Env: &env, Labels: &labels,
+		RunningReplicas: []*Replica{{ID: "pending-1", Status: "Pending"}}})
+
+	//the simulated replicas of an app without ports have no endpoints either
+	simulation := backend.NewSimulationBackend()
+	simulation.Deploy(&CreateRequest{BaseRequest: BaseRequest{Name: "portless", ImageURL: "portless:1", Replicas: 1}})
+	artifact, err := simulation.GetApp(&ArtifactRequest{Name: "portless"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	printInfoTable(true, *artifact)
+}
+
+func TestApply(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		var body DeployRequest
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&body)
+		}
+		if (r.Method == "PUT" || r.Method == "POST") && body.Labels[ManagedByLabel] != "shop" {
+			t.Errorf("app %s is not labeled as managed by the set", body.Name)
+		}
+		switch {
+		case r.URL.Query().Get("dryRun") == "true":
+			switch body.Name {
+			case "new":
+				json.NewEncoder(w).Encode(DiffResult{Name: body.Name})
+			case "changed":
+				json.NewEncoder(w).Encode(DiffResult{Name: body.Name, Exists: true, Changes: []*FieldChange{{Field: "imageURL"}}})
+			default:
+				json.NewEncoder(w).Encode(DiffResult{Name: body.Name, Exists: true})
+			}
+		case r.Method == "GET" && r.URL.Query().Get("label") == ManagedByLabel+"=shop":
+			json.NewEncoder(w).Encode(ListDeployments{Deployments: []string{"/new", "/changed", "/same", "/old"}})
+		default:
+			json.NewEncoder(w).Encode(DeploymentResult{Name: body.Name, DeploymentID: "1"})
+		}
+	}))
+	defer server.Close()
+
+	client := getTestClient(t, server)
+	summary := client.applyCluster("TEST", "shop", []CmdClientRequest{{Name: "new"}, {Name: "changed"}, {Name: "same"}}, true)
+	if strings.Join(summary.Created, ",") != "new" || strings.Join(summary.Updated, ",") != "changed" ||
+		strings.Join(summary.Unchanged, ",") != "same" || strings.Join(summary.Pruned, ",") != "old" || len(summary.Failed) != 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	expected := "PUT /deployments/new,POST /deployments,PUT /deployments/changed,PUT /deployments/changed,PUT /deployments/same,GET /deployments,DELETE /deployments/old"
+	if strings.Join(requests, ",") != expected {
+		t.Fatalf("unexpected requests %s", strings.Join(requests, ","))
+	}
+}
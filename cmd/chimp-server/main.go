@@ -46,6 +46,7 @@ Example:
 	flag.StringVar(&serverConfig.TokenURL, "oauth-tokeninfourl", "", "OAuth2 Auth URL")
 	flag.StringVar(&serverConfig.TLSCertfilePath, "tls-cert", serverConfig.TLSCertfilePath, "TLS Certfile")
 	flag.StringVar(&serverConfig.TLSKeyfilePath, "tls-key", serverConfig.TLSKeyfilePath, "TLS Keyfile")
+	flag.StringVar(&serverConfig.BackendType, "backend", serverConfig.BackendType, "Backend type, \"simulation\" simulates the apps in memory")
 	flag.IntVar(&serverConfig.Port, "port", serverConfig.Port, "Listening TCP Port of the service.")
 	if serverConfig.Port == 0 {
 		serverConfig.Port = 8082 //default port when no option is provided
@@ -1,18 +1,25 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docopt/docopt-go"
-	"github.com/spf13/viper"
+	"github.com/mitchellh/mapstructure"
 	"github.com/vrischmann/envconfig"
 	"github.com/zalando/chimp/client"
 	konfig "github.com/zalando/chimp/conf/client"
+	"github.com/zalando/chimp/quantity"
 	. "github.com/zalando/chimp/types"
+	"gopkg.in/yaml.v2"
 )
 
 //Buildstamp and Githash are used to set information at build time regarding
@@ -41,25 +48,48 @@ func main() {
 	usage := fmt.Sprintf(`Usage:
   chimp -h | --help
   chimp --version
-  chimp create (<filename> | <name> <url> --port=<port> --memory=<memory> --cpu=<cpu-number> --replicas=<replicas>) [--cluster=<cluster>] [options]
-  chimp update (<filename> | <name> <url> --port=<port> --memory=<memory> --cpu=<cpu-number> --replicas=<replicas> ) [--cluster=<cluster>] [options]
+  chimp create (<filename> | <name> <url> --port=<port> --memory=<memory> --cpu=<cpu-number> --replicas=<replicas>) [--var=<k=v>...] [--cluster=<cluster>] [options]
+  chimp update (<filename> | <name> <url> --port=<port> --memory=<memory> --cpu=<cpu-number> --replicas=<replicas> ) [--var=<k=v>...] [--cluster=<cluster>] [options]
+  chimp diff (<filename>) [--var=<k=v>...] [--cluster=<cluster>] [options]
+  chimp apply (<path>) [--prune] [--set=<set>] [--var=<k=v>...] [--cluster=<cluster>] [options]
+  chimp render (<filename>) [--var=<k=v>...] [--cluster=<cluster>] [options]
   chimp scale (<name>) (<replicas>) [--cluster=<cluster>] [options]
   chimp delete (<name>) [--cluster=<cluster>] [options]
   chimp info (<name>) [--cluster=<cluster>] [options]
   chimp list [--all] [--cluster=<cluster>] [options]
+  chimp history (<name>) [--cluster=<cluster>] [options]
+  chimp rollback (<name>) [--to=<version>] [--cluster=<cluster>] [options]
+  chimp cancel (<name>) [--cluster=<cluster>] [options]
+  chimp kill (<name>) (<replica> | --all) [--scale] [--cluster=<cluster>] [options]
+  chimp watch (<name>) [--cluster=<cluster>] [options]
+  chimp set image (<name>) (<url>) [--cluster=<cluster>] [options]
+  chimp set env (<name>) (<env>...) [--cluster=<cluster>] [options]
   chimp login [<username>] [options]
 
 
 Options:
   --label=<k=v>  Labels of the deploy artifact, has to be a dict like k=v
   --env=<k=v>  Environment variables of the deploy artifact, has to be a dict like k=v
+  --var=<k=v>  Variable of the definition templates, used like {{.Vars.k}}. Can be repeated
+  --vars=<file>  YAML file with the variables of the definition templates, --var overrides them
+  --template  Render the definition files as Go templates before reading them
+  --disk=<disk>  Disk reserved for each replica, like 512Mi or 10Gi
+  --health-check=<k=v>  Health check of the deploy artifact, like "protocol=HTTP,path=/health,portIndex=0,interval=10,grace=30,maxFailures=3". Protocol can be HTTP, TCP or COMMAND (with command=<cmd>)
   --http-only  If not set we use https as default to query deploy requests
   --oauth2  OAuth2 enable
   --oauth2-token=<access_token>  OAuth2 AccessToken (no user, password required)
   --oauth2-authurl=<oauth2_authurl>  OAuth2 endpoint that issue AccessTokens
   --debug  Debug
   --verbose  Verbose logging
-  --force  Force deployment
+  --force  Force deployment. When cancelling, the app is not rolled back
+  --group=<group>  Deploy all the apps of the definition atomically as a group with the given name, overrides the group of the file
+  --all  With kill, kill all the replicas of the deployment. With list, list the apps of all the teams instead of only the ones of your team
+  --prune  Delete the apps of the team managed by the definition set that are not defined anymore
+  --set=<set>  Name of the definition set applied, defaults to the name of the file or directory
+  --scale  Scale the deployment down instead of replacing the killed replicas
+  --to=<version>  Version to roll back to, defaults to the one before the current version
+  --wait  Wait for create, update and scale to be rolled out. Exits with an error if the rollout fails
+  --timeout=<duration>  Maximum time to wait for the rollout, like 90s or 5m [default: 10m]
   --cluster=<cluster> The endpoint of the cluster. "all" means deployed on every cluster in the config.
 `)
 
@@ -86,12 +116,18 @@ Options:
 	var force = arguments["--force"].(bool)
 	if arguments["create"].(bool) {
 		cli.GetAccessToken(username)
-		cmdReq, err := buildRequest(arguments)
+		defs, err := buildClusterRequests(&cli, arguments)
 		if err != nil {
 			fmt.Println("Cannot parse, please provide valid options.")
 			os.Exit(1)
 		}
-		cli.CreateDeploy(&cmdReq.DeployRequest[0])
+		success := true
+		for _, cluster := range cli.Clusters {
+			success = deployDefinition(clusterClient(&cli, cluster), defs[cluster], false) && success
+		}
+		if !success {
+			os.Exit(1)
+		}
 	} else if arguments["delete"].(bool) {
 		cli.GetAccessToken(username)
 		cli.DeleteDeploy(name)
@@ -104,16 +140,122 @@ Options:
 		cli.ListDeploy(all)
 	} else if arguments["update"].(bool) {
 		cli.GetAccessToken(username)
-		cmdReq, err := buildRequest(arguments)
+		defs, err := buildClusterRequests(&cli, arguments)
+		if err != nil {
+			fmt.Println("Cannot parse, please provide valid options.")
+			os.Exit(1)
+		}
+		success := true
+		for _, cluster := range cli.Clusters {
+			success = deployDefinition(clusterClient(&cli, cluster), defs[cluster], true) && success
+		}
+		if !success {
+			os.Exit(1)
+		}
+	} else if arguments["diff"].(bool) {
+		cli.GetAccessToken(username)
+		defs, err := buildClusterRequests(&cli, arguments)
 		if err != nil {
 			fmt.Println("Cannot parse, please provide valid options.")
 			os.Exit(1)
 		}
-		cli.UpdateDeploy(&cmdReq.DeployRequest[0])
+		success := true
+		for _, cluster := range cli.Clusters {
+			def := defs[cluster]
+			if def.Group != "" {
+				fmt.Println("Diff is not supported for groups yet.")
+				os.Exit(1)
+			}
+			for i := range def.DeployRequest {
+				success = clusterClient(&cli, cluster).Diff(&def.DeployRequest[i]) && success
+			}
+		}
+		if !success {
+			os.Exit(1)
+		}
+	} else if arguments["apply"].(bool) {
+		cli.GetAccessToken(username)
+		path := GetStringFromArgs(arguments, "<path>", "")
+		set := GetStringFromArgs(arguments, "--set", strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+		clusterApps := make(map[string][]CmdClientRequest, len(cli.Clusters))
+		known := make([]string, 0, len(cli.Config.Clusters))
+		for cluster := range cli.Config.Clusters {
+			known = append(known, cluster)
+		}
+		for _, cluster := range cli.Clusters {
+			ctx, err := buildRenderContext(arguments, cluster)
+			if err == nil {
+				clusterApps[cluster], err = readDefinitions(path, ctx, known)
+			}
+			if err != nil {
+				fmt.Printf("Cannot read the definitions for cluster %s, caused by: %s\n", cluster, err)
+				os.Exit(1)
+			}
+		}
+		success := true
+		for _, cluster := range cli.Clusters {
+			success = clusterClient(&cli, cluster).Apply(set, clusterApps[cluster], arguments["--prune"].(bool)) && success
+		}
+		if !success {
+			os.Exit(1)
+		}
+	} else if arguments["render"].(bool) {
+		fileName := GetStringFromArgs(arguments, "<filename>", "")
+		for _, cluster := range cli.Clusters {
+			ctx, err := buildRenderContext(arguments, cluster)
+			var rendered string
+			if err == nil {
+				rendered, err = renderDefinition(fileName, ctx)
+			}
+			if err != nil {
+				fmt.Printf("Cannot render the definition for cluster %s, caused by: %s\n", cluster, err)
+				os.Exit(1)
+			}
+			fmt.Printf("# cluster: %s\n---\n%s", cluster, rendered)
+		}
 	} else if arguments["scale"].(bool) {
 		cli.GetAccessToken(username)
 		replicas := GetIntFromArgs(arguments, "<replicas>", 1)
-		cli.Scale(name, replicas, force)
+		if !cli.Scale(name, replicas, force) {
+			os.Exit(1)
+		}
+	} else if arguments["history"].(bool) {
+		cli.GetAccessToken(username)
+		cli.History(name)
+	} else if arguments["rollback"].(bool) {
+		cli.GetAccessToken(username)
+		version := GetStringFromArgs(arguments, "--to", "")
+		cli.Rollback(name, version)
+	} else if arguments["cancel"].(bool) {
+		cli.GetAccessToken(username)
+		if !cli.Cancel(name, force) {
+			os.Exit(1)
+		}
+	} else if arguments["kill"].(bool) {
+		cli.GetAccessToken(username)
+		replica := GetStringFromArgs(arguments, "<replica>", "")
+		if !cli.Kill(name, replica, arguments["--scale"].(bool)) {
+			os.Exit(1)
+		}
+	} else if arguments["watch"].(bool) {
+		cli.GetAccessToken(username)
+		cli.Watch(name)
+	} else if arguments["set"].(bool) {
+		cli.GetAccessToken(username)
+		patch := make(map[string]interface{}, 1)
+		if arguments["image"].(bool) {
+			patch["imageURL"] = GetStringFromArgs(arguments, "<url>", "")
+		} else {
+			env, err := ConvertEnvPatch(arguments["<env>"].([]string))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			patch["env"] = env
+		}
+		if !cli.Patch(name, patch) {
+			os.Exit(1)
+		}
 	} else if arguments["login"].(bool) {
 		cli.RenewAccessToken(strings.TrimSpace(username))
 	}
@@ -169,27 +311,57 @@ func createClient(arguments map[string]interface{}) client.Client {
 
 	accessToken := GetStringFromArgs(arguments, "--oauth2-token", "")
 
+	timeout, err := time.ParseDuration(GetStringFromArgs(arguments, "--timeout", "10m"))
+	if err != nil {
+		fmt.Printf("Timeout is invalid, caused by: %s\n", err)
+		os.Exit(-1)
+	}
+
 	return client.Client{
 		Clusters:    clusters,
 		Config:      configuration,
 		Scheme:      scheme,
 		AccessToken: accessToken,
+		Wait:        arguments["--wait"].(bool),
+		Timeout:     timeout,
+	}
+}
+
+//clusterClient returns a copy of the client working only on the given cluster
+func clusterClient(cli *client.Client, cluster string) *client.Client {
+	c := *cli
+	c.Clusters = []string{cluster}
+	return &c
+}
+
+//buildClusterRequests builds the definition for each cluster of the client, as definition files
+//are rendered for the cluster they are deployed to
+func buildClusterRequests(cli *client.Client, arguments map[string]interface{}) (map[string]*ChimpDefinition, error) {
+	defs := make(map[string]*ChimpDefinition, len(cli.Clusters))
+	for _, cluster := range cli.Clusters {
+		ctx, err := buildRenderContext(arguments, cluster)
+		if err != nil {
+			fmt.Printf("Invalid variables, caused by: %s\n", err)
+			return nil, err
+		}
+		if defs[cluster], err = buildRequest(arguments, ctx); err != nil {
+			return nil, err
+		}
 	}
+	return defs, nil
 }
 
-func buildRequest(arguments map[string]interface{}) (*ChimpDefinition, error) {
+func buildRequest(arguments map[string]interface{}, ctx *renderContext) (*ChimpDefinition, error) {
 	//reading configuration file
 	var c ChimpDefinition
 	fileName := GetStringFromArgs(arguments, "<filename>", "")
 	if fileName != "" {
-		viper := viper.New()
-		viper.SetConfigFile(fileName)
-		err := viper.ReadInConfig()
+		def, err := readDefinition(fileName, ctx)
 		if err != nil {
 			fmt.Printf("Can not read config, caused by: %s\n", err)
 			return nil, err
 		}
-		err = viper.Marshal(&c)
+		c = *def
 	} else {
 		labelStr := GetStringFromArgs(arguments, "--label", "")
 		name := GetStringFromArgs(arguments, "<name>", "")
@@ -199,21 +371,168 @@ func buildRequest(arguments map[string]interface{}) (*ChimpDefinition, error) {
 		replicas := GetIntFromArgs(arguments, "--replicas", 1)
 		imageURL := GetStringFromArgs(arguments, "<url>", "")
 		svcport := GetIntFromArgs(arguments, "--port", 8080)
-		cpuNumber := GetIntFromArgs(arguments, "--cpu", 0)            //unlimited or backend decided
+		cpuNumber := GetStringFromArgs(arguments, "--cpu", "")        //unlimited or backend decided
 		memoryLimit := GetStringFromArgs(arguments, "--memory", "0M") //unlimited or backend decided
+		diskLimit := GetStringFromArgs(arguments, "--disk", "")       //unlimited or backend decided
+		healthCheck, err := ConvertHealthCheck(GetStringFromArgs(arguments, "--health-check", ""))
+		if err != nil {
+			fmt.Printf("Invalid health check, caused by: %s\n", err)
+			return nil, err
+		}
 
-		ports := []int{svcport}
+		ports := []Port{{ContainerPort: svcport}}
 		c.DeployRequest = append(c.DeployRequest, CmdClientRequest{})
 		c.DeployRequest[0].Labels = labels
 		c.DeployRequest[0].Env = envVars
 		c.DeployRequest[0].Replicas = replicas
 		c.DeployRequest[0].ImageURL = imageURL
-		c.DeployRequest[0].CPULimit = cpuNumber
-		c.DeployRequest[0].MemoryLimit = memoryLimit
+		c.DeployRequest[0].CPULimit = Quantity(cpuNumber)
+		c.DeployRequest[0].MemoryLimit = Quantity(memoryLimit)
+		c.DeployRequest[0].DiskLimit = Quantity(diskLimit)
 		c.DeployRequest[0].Ports = ports
 		c.DeployRequest[0].Name = name
+		if healthCheck != nil {
+			c.DeployRequest[0].HealthChecks = []*HealthCheck{healthCheck}
+		}
+	}
+	c.Group = GetStringFromArgs(arguments, "--group", c.Group)
+	if len(c.DeployRequest) == 0 {
+		fmt.Println("The definition contains no deploy request.")
+		return nil, errors.New("no deploy request")
 	}
+	if err := validateResources(&c); err != nil {
+		fmt.Printf("Invalid resources, caused by: %s\n", err)
+		return nil, err
+	}
+
+	return &c, nil
 
+}
+
+//readDefinition renders a definition file, with its overlay for the cluster, and reads it
+func readDefinition(fileName string, ctx *renderContext) (*ChimpDefinition, error) {
+	var c ChimpDefinition
+	settings, err := renderSettings(fileName, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeDefinition(settings, &c); err != nil {
+		return nil, err
+	}
 	return &c, nil
+}
+
+//renderDefinition renders a definition file, with its overlay for the cluster, and returns the result as YAML
+func renderDefinition(fileName string, ctx *renderContext) (string, error) {
+	settings, err := renderSettings(fileName, ctx)
+	if err != nil {
+		return "", err
+	}
+	var c ChimpDefinition
+	if err = decodeDefinition(settings, &c); err != nil {
+		return "", err
+	}
+	if err = validateResources(&c); err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(settings)
+	return string(data), err
+}
+
+//readDefinitions reads the apps of a definition file or of all the yaml files of a directory, which make
+//a definition set. Overlays of the files for the given clusters are merged and not read on their own.
+//Groups are not supported and every app must be defined once.
+func readDefinitions(path string, ctx *renderContext, clusters []string) ([]CmdClientRequest, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, _ := filepath.Glob(filepath.Join(path, pattern))
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+	}
+	var apps []CmdClientRequest
+	names := make(map[string]string)
+	for _, file := range files {
+		if isOverlay(file, files, clusters) {
+			continue
+		}
+		def, err := readDefinition(file, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		if def.Group != "" {
+			return nil, fmt.Errorf("%s: groups cannot be applied", file)
+		}
+		for _, app := range def.DeployRequest {
+			if other, exists := names[app.Name]; exists {
+				return nil, fmt.Errorf("%s: app %s is already defined in %s", file, app.Name, other)
+			}
+			names[app.Name] = file
+			apps = append(apps, app)
+		}
+	}
+	if len(apps) == 0 {
+		return nil, fmt.Errorf("no apps defined in %s", path)
+	}
+	if err := validateResources(&ChimpDefinition{DeployRequest: apps}); err != nil {
+		return nil, err
+	}
+	return apps, nil
+}
+
+//validateResources checks the CPU, memory and disk quantities of every deploy request of a definition
+func validateResources(def *ChimpDefinition) error {
+	for _, req := range def.DeployRequest {
+		if _, err := quantity.ParseCPU(string(req.CPULimit)); err != nil {
+			return fmt.Errorf("app %s: %s", req.Name, err)
+		}
+		if _, err := quantity.ParseMebibytes(string(req.MemoryLimit)); err != nil {
+			return fmt.Errorf("app %s: memory limit: %s", req.Name, err)
+		}
+		if _, err := quantity.ParseMebibytes(string(req.DiskLimit)); err != nil {
+			return fmt.Errorf("app %s: disk limit: %s", req.Name, err)
+		}
+	}
+	return nil
+}
+
+//decodeDefinition decodes the settings read from a definition file. Ports can be given as plain numbers,
+//which are read as TCP container ports.
+func decodeDefinition(settings map[string]interface{}, def *ChimpDefinition) error {
+	portType := reflect.TypeOf(Port{})
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           def,
+		DecodeHook: func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+			if to != portType || from.Kind() == reflect.Map {
+				return data, nil
+			}
+			return map[string]interface{}{"ContainerPort": data}, nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(settings)
+}
 
+//deployDefinition creates, or updates, all the apps of a definition: one by one, or atomically if the definition has a group.
+//Returns false if any of them could not be deployed.
+func deployDefinition(cli *client.Client, def *ChimpDefinition, update bool) bool {
+	if def.Group != "" {
+		return cli.DeployGroup(def.Group, def.DeployRequest, update)
+	}
+	success := true
+	for i := range def.DeployRequest {
+		if update {
+			success = cli.UpdateDeploy(&def.DeployRequest[i]) && success
+		} else {
+			success = cli.CreateDeploy(&def.DeployRequest[i]) && success
+		}
+	}
+	return success
 }
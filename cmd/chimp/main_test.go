@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/zalando/chimp/types"
+)
+
+const definition = `---
+DeployRequest:
+  - name: demo
+    imageURL: YOUR_IMAGE
+    replicas: 3
+    ports:
+      - 8080
+      - containerPort: 53
+        protocol: udp
+        name: dns
+        hostPort: 53
+    MemoryLimit: 4000MB
+    healthChecks:
+        - protocol: HTTP
+          path: /health
+          gracePeriodSeconds: 30
+    updateStrategy:
+        minimumHealthyCapacity: 0.5
+        maximumOverCapacity: 0.2
+    constraints:
+        - field: hostname
+          operator: UNIQUE
+        - field: zone
+          operator: LIKE
+          value: eu-1a
+`
+
+//writeDefinition writes a definition file in a temporary directory which must be removed by the caller
+func writeDefinition(t *testing.T, content string) (string, string) {
+	dir, err := ioutil.TempDir("", "chimp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(dir, "definition.yaml")
+	if err = ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, fileName
+}
+
+func TestBuildRequestFromFile(t *testing.T) {
+	dir, fileName := writeDefinition(t, definition)
+	defer os.RemoveAll(dir)
+	c, err := buildRequest(map[string]interface{}{"<filename>": fileName}, &renderContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := c.DeployRequest[0]
+	if req.Name != "demo" || req.Replicas != 3 || len(req.Ports) != 2 || req.Ports[0] != (Port{ContainerPort: 8080}) {
+		t.Fatalf("unexpected request %+v", req)
+	}
+	if req.Ports[1] != (Port{ContainerPort: 53, Protocol: PortProtocolUDP, Name: "dns", HostPort: 53}) {
+		t.Fatalf("unexpected udp port %+v", req.Ports[1])
+	}
+	if len(req.HealthChecks) != 1 || req.HealthChecks[0].Path != "/health" || req.HealthChecks[0].GracePeriodSeconds != 30 {
+		t.Fatalf("unexpected health checks %+v", req.HealthChecks)
+	}
+	if req.UpdateStrategy == nil || *req.UpdateStrategy.MinimumHealthyCapacity != 0.5 || *req.UpdateStrategy.MaximumOverCapacity != 0.2 {
+		t.Fatalf("unexpected update strategy %+v", req.UpdateStrategy)
+	}
+	if len(req.Constraints) != 2 || *req.Constraints[1] != (Constraint{Field: "zone", Operator: ConstraintLike, Value: "eu-1a"}) {
+		t.Fatalf("unexpected constraints %+v", req.Constraints)
+	}
+}
+
+const groupDefinition = `---
+group: shop
+DeployRequest:
+  - name: frontend
+    imageURL: YOUR_FRONTEND_IMAGE
+    dependencies:
+      - backend
+  - name: backend
+    imageURL: YOUR_BACKEND_IMAGE
+`
+
+func TestBuildGroupRequestFromFile(t *testing.T) {
+	dir, fileName := writeDefinition(t, groupDefinition)
+	defer os.RemoveAll(dir)
+	c, err := buildRequest(map[string]interface{}{"<filename>": fileName}, &renderContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Group != "shop" || len(c.DeployRequest) != 2 {
+		t.Fatalf("unexpected definition %+v", c)
+	}
+	if deps := c.DeployRequest[0].Dependencies; len(deps) != 1 || deps[0] != "backend" {
+		t.Fatalf("unexpected dependencies %+v", deps)
+	}
+
+	c, err = buildRequest(map[string]interface{}{"<filename>": fileName, "--group": "other"}, &renderContext{})
+	if err != nil || c.Group != "other" {
+		t.Fatalf("expected the group to be overridden, got %+v, %v", c, err)
+	}
+}
+
+func TestReadDefinitions(t *testing.T) {
+	dir, _ := writeDefinition(t, definition)
+	defer os.RemoveAll(dir)
+	other := "---\nDeployRequest:\n  - name: other\n    imageURL: OTHER_IMAGE\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.yml"), []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a definition"), 0644)
+	apps, err := readDefinitions(dir, &renderContext{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 2 || apps[0].Name != "demo" || apps[1].Name != "other" {
+		t.Fatalf("unexpected apps %+v", apps)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "twice.yaml"), []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readDefinitions(dir, &renderContext{}, nil); err == nil {
+		t.Fatal("an app defined twice should be an error")
+	}
+	groupDir, groupFile := writeDefinition(t, groupDefinition)
+	defer os.RemoveAll(groupDir)
+	if _, err = readDefinitions(groupFile, &renderContext{}, nil); err == nil {
+		t.Fatal("groups should not be applied")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+//renderContext is what definition files are rendered with: the name of the cluster the definition
+//is deployed to and the variables given with --vars and --var, like {{.Cluster}} and {{.Vars.tag}}.
+//The files are rendered as templates only if template is set, with --template.
+type renderContext struct {
+	Cluster  string
+	Vars     map[string]interface{}
+	template bool
+}
+
+//buildRenderContext reads the variables of the command line for the given cluster. The ones given
+//with --var override the ones of the vars file. Variables without --template are an error, as they
+//would not be used.
+func buildRenderContext(arguments map[string]interface{}, cluster string) (*renderContext, error) {
+	templated, _ := arguments["--template"].(bool)
+	ctx := renderContext{Cluster: cluster, Vars: make(map[string]interface{}), template: templated}
+	if varsFile := GetStringFromArgs(arguments, "--vars", ""); varsFile != "" {
+		data, err := ioutil.ReadFile(varsFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.Unmarshal(data, &ctx.Vars); err != nil {
+			return nil, fmt.Errorf("%s: %s", varsFile, err)
+		}
+	}
+	var pairs []string
+	switch vars := arguments["--var"].(type) {
+	case string:
+		pairs = []string{vars}
+	case []string:
+		pairs = vars
+	}
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid variable %s, expected k=v", pair)
+		}
+		ctx.Vars[kv[0]] = kv[1]
+	}
+	if len(ctx.Vars) > 0 && !templated {
+		return nil, errors.New("variables are given, but the definitions are not rendered as templates without --template")
+	}
+	return &ctx, nil
+}
+
+//overlayFile returns the name of the overlay of a definition file for a cluster, p.e. app.live.yaml for app.yaml
+func overlayFile(fileName, cluster string) string {
+	ext := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, ext) + "." + cluster + ext
+}
+
+//isOverlay returns true if the file is the overlay of another definition file of the list for one of the
+//given clusters, named like <base>.<cluster>.yaml. Other dots in the names, like in v1.2.yaml, are not overlays.
+func isOverlay(fileName string, files []string, clusters []string) bool {
+	for _, cluster := range clusters {
+		suffix := "." + cluster + filepath.Ext(fileName)
+		if !strings.HasSuffix(fileName, suffix) {
+			continue
+		}
+		base := strings.TrimSuffix(fileName, suffix) + filepath.Ext(fileName)
+		for _, file := range files {
+			if file == base {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//renderSettings renders a definition file, merged with its overlay for the cluster if there is one,
+//and returns its settings
+func renderSettings(fileName string, ctx *renderContext) (map[string]interface{}, error) {
+	settings, err := renderFile(fileName, ctx)
+	if err != nil {
+		return nil, err
+	}
+	overlay := overlayFile(fileName, ctx.Cluster)
+	if _, err = os.Stat(overlay); err != nil {
+		return settings, nil
+	}
+	overlaySettings, err := renderFile(overlay, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mergeSettings(settings, overlaySettings), nil
+}
+
+//renderFile reads a definition file in the format given by the extension. With --template the file is
+//executed as a template first, otherwise it is read as it is.
+func renderFile(fileName string, ctx *renderContext) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	rendered := bytes.NewBuffer(data)
+	if ctx.template {
+		tmpl, err := template.New(filepath.Base(fileName)).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		rendered = &bytes.Buffer{}
+		if err = tmpl.Execute(rendered, ctx); err != nil {
+			return nil, err
+		}
+	}
+	viper := viper.New()
+	viper.SetConfigType(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	if err = viper.ReadConfig(rendered); err != nil {
+		return nil, err
+	}
+	return normalizeSettings(viper.AllSettings()).(map[string]interface{}), nil
+}
+
+//normalizeSettings turns the maps read from YAML, which have interface{} keys, into maps with string keys
+func normalizeSettings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeSettings(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = normalizeSettings(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeSettings(item)
+		}
+		return list
+	}
+	return value
+}
+
+//mergeSettings merges the settings of an overlay into the ones of the base file. Maps are merged key by key
+//and lists of named items, like the deploy requests, item by item matching the names; anything else
+//in the overlay replaces the value of the base. Keys are matched ignoring case, as when they are decoded.
+func mergeSettings(base, overlay map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		baseKey := findKey(merged, key)
+		if baseKey == "" {
+			merged[key] = value
+			continue
+		}
+		merged[baseKey] = mergeValues(merged[baseKey], value)
+	}
+	return merged
+}
+
+func mergeValues(base, overlay interface{}) interface{} {
+	switch o := overlay.(type) {
+	case map[string]interface{}:
+		if b, ok := base.(map[string]interface{}); ok {
+			return mergeSettings(b, o)
+		}
+	case []interface{}:
+		if b, ok := base.([]interface{}); ok && isNamedList(b) && isNamedList(o) {
+			merged := append([]interface{}{}, b...)
+			for _, item := range o {
+				name := itemName(item)
+				found := false
+				for i := range merged {
+					if itemName(merged[i]) == name {
+						merged[i] = mergeSettings(merged[i].(map[string]interface{}), item.(map[string]interface{}))
+						found = true
+						break
+					}
+				}
+				if !found {
+					merged = append(merged, item)
+				}
+			}
+			return merged
+		}
+	}
+	return overlay
+}
+
+//isNamedList returns true if every item of the list is a map with a name
+func isNamedList(list []interface{}) bool {
+	for _, item := range list {
+		if itemName(item) == "" {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+func itemName(item interface{}) string {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := m[findKey(m, "name")].(string)
+	return name
+}
+
+//findKey returns the key of the map equal to the given one ignoring case, or an empty string
+func findKey(m map[string]interface{}, key string) string {
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+	}
+	return ""
+}
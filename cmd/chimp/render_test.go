@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const templateDefinition = `---
+DeployRequest:
+  - name: shop
+    imageURL: pierone/shop:{{.Vars.tag}}
+    replicas: 1
+    env:
+      CLUSTER: {{.Cluster}}
+      LOG_LEVEL: info
+  - name: cart
+    imageURL: pierone/cart:{{.Vars.tag}}
+`
+
+const liveOverlay = `---
+DeployRequest:
+  - name: shop
+    replicas: 5
+    env:
+      LOG_LEVEL: warn
+`
+
+func TestBuildRenderContext(t *testing.T) {
+	dir, varsFile := writeDefinition(t, "tag: \"1.0\"\nregion: eu\n")
+	defer os.RemoveAll(dir)
+	ctx, err := buildRenderContext(map[string]interface{}{"--template": true, "--vars": varsFile, "--var": []string{"tag=2.0"}}, "live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Cluster != "live" || ctx.Vars["tag"] != "2.0" || ctx.Vars["region"] != "eu" || !ctx.template {
+		t.Fatalf("unexpected context %+v", ctx)
+	}
+	if _, err = buildRenderContext(map[string]interface{}{"--template": true, "--var": []string{"tag"}}, "live"); err == nil {
+		t.Fatal("a variable without value should be an error")
+	}
+	if _, err = buildRenderContext(map[string]interface{}{"--var": []string{"tag=2.0"}}, "live"); err == nil {
+		t.Fatal("variables without --template should be an error")
+	}
+}
+
+func TestReadTemplatedDefinition(t *testing.T) {
+	dir, fileName := writeDefinition(t, templateDefinition)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(overlayFile(fileName, "live"), []byte(liveOverlay), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{"tag": "1.0"}
+
+	staging, err := readDefinition(fileName, &renderContext{Cluster: "staging", Vars: vars, template: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop := staging.DeployRequest[0]
+	if shop.ImageURL != "pierone/shop:1.0" || shop.Replicas != 1 || shop.Env["CLUSTER"] != "staging" || shop.Env["LOG_LEVEL"] != "info" {
+		t.Fatalf("unexpected staging definition %+v", shop)
+	}
+
+	live, err := readDefinition(fileName, &renderContext{Cluster: "live", Vars: vars, template: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live.DeployRequest) != 2 || live.DeployRequest[1].ImageURL != "pierone/cart:1.0" {
+		t.Fatalf("the apps not in the overlay should be kept, got %+v", live.DeployRequest)
+	}
+	shop = live.DeployRequest[0]
+	if shop.ImageURL != "pierone/shop:1.0" || shop.Replicas != 5 || shop.Env["CLUSTER"] != "live" || shop.Env["LOG_LEVEL"] != "warn" {
+		t.Fatalf("unexpected live definition %+v", shop)
+	}
+
+	if _, err = readDefinition(fileName, &renderContext{Cluster: "live", template: true}); err == nil {
+		t.Fatal("a missing variable should be an error")
+	}
+
+	//the overlay is not a definition of the set
+	apps, err := readDefinitions(dir, &renderContext{Cluster: "live", Vars: vars, template: true}, []string{"live", "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 2 || apps[0].Replicas != 5 {
+		t.Fatalf("unexpected apps %+v", apps)
+	}
+}
+
+func TestRenderDefinition(t *testing.T) {
+	dir, fileName := writeDefinition(t, templateDefinition)
+	defer os.RemoveAll(dir)
+	rendered, err := renderDefinition(fileName, &renderContext{Cluster: "staging", Vars: map[string]interface{}{"tag": "1.0"}, template: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered, "imageURL: pierone/shop:1.0") || !strings.Contains(rendered, "CLUSTER: staging") {
+		t.Fatalf("unexpected rendered definition:\n%s", rendered)
+	}
+}
+
+func TestReadPlainDefinition(t *testing.T) {
+	dir, fileName := writeDefinition(t, "DeployRequest:\n  - name: shop\n    env:\n      GREETING: \"{{hello}}\"\n")
+	defer os.RemoveAll(dir)
+	def, err := readDefinition(fileName, &renderContext{Cluster: "live"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.DeployRequest[0].Env["GREETING"] != "{{hello}}" {
+		t.Fatalf("without --template the file should be read as it is, got %+v", def.DeployRequest[0].Env)
+	}
+	if _, err = readDefinition(fileName, &renderContext{Cluster: "live", template: true}); err == nil {
+		t.Fatal("the file should not be a valid template")
+	}
+}
+
+func TestIsOverlay(t *testing.T) {
+	files := []string{filepath.Join("defs", "shop.yaml"), filepath.Join("defs", "shop.live.yaml"), filepath.Join("defs", "v1.yaml"),
+		filepath.Join("defs", "v1.2.yaml"), filepath.Join("defs", "shop.test.yaml")}
+	for i, expected := range []bool{false, true, false, false, false} {
+		if isOverlay(files[i], files, []string{"live", "staging"}) != expected {
+			t.Errorf("isOverlay(%s) should be %t", files[i], expected)
+		}
+	}
+}
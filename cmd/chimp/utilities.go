@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+
+	. "github.com/zalando/chimp/types"
 )
 
 //GetStringFromArgs returns a string from the cli arguments.
@@ -73,3 +75,92 @@ func ConvertMaps(input string) map[string]string {
 	}
 	return labels
 }
+
+//ConvertHealthCheck creates a health check from a string of comma separated k=v pairs like
+//"protocol=HTTP,path=/health,portIndex=0,interval=10,grace=30,maxFailures=3".
+//Values can be double quoted to contain commas, like command="test -f /a,b".
+//It returns nil if the input is empty.
+func ConvertHealthCheck(input string) (*HealthCheck, error) {
+	if input == "" {
+		return nil, nil
+	}
+	options, err := splitOptions(input)
+	if err != nil {
+		return nil, err
+	}
+	hc := HealthCheck{Protocol: HealthCheckHTTP}
+	for k, v := range options {
+		var err error
+		switch k {
+		case "protocol":
+			hc.Protocol = strings.ToUpper(v)
+		case "path":
+			hc.Path = v
+		case "command":
+			hc.Command = v
+		case "portIndex":
+			hc.PortIndex, err = strconv.Atoi(v)
+		case "interval":
+			hc.IntervalSeconds, err = strconv.Atoi(v)
+		case "grace":
+			hc.GracePeriodSeconds, err = strconv.Atoi(v)
+		case "maxFailures":
+			hc.MaxConsecutiveFailures, err = strconv.Atoi(v)
+		default:
+			return nil, fmt.Errorf("unknown health check option %s", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("health check option %s must be a number: %s", k, v)
+		}
+	}
+	return &hc, nil
+}
+
+//splitOptions splits a string of comma separated k=v pairs, where a value can be double quoted
+func splitOptions(input string) (map[string]string, error) {
+	var pairs []string
+	start, quoted := 0, false
+	for i, c := range input {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			pairs = append(pairs, input[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %s", input)
+	}
+	pairs = append(pairs, input[start:])
+	options := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid option %s, expected k=v", pair)
+		}
+		if v := kv[1]; len(v) > 1 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+			kv[1] = v[1 : len(v)-1]
+		}
+		options[kv[0]] = kv[1]
+	}
+	return options, nil
+}
+
+//ConvertEnvPatch creates the patch of the environment of an app from a list of K=V pairs.
+//A name followed by a dash, like K-, removes the variable.
+func ConvertEnvPatch(input []string) (map[string]interface{}, error) {
+	env := make(map[string]interface{}, len(input))
+	for _, pair := range input {
+		if strings.HasSuffix(pair, "-") && !strings.Contains(pair, "=") {
+			env[strings.TrimSuffix(pair, "-")] = nil
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid environment variable %s, expected K=V or K-", pair)
+		}
+		env[kv[0]] = kv[1]
+	}
+	return env, nil
+}
@@ -71,3 +71,52 @@ func TestConvertMaps(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestConvertHealthCheck(t *testing.T) {
+	hc, err := ConvertHealthCheck("protocol=http,path=/health,interval=10,grace=30,maxFailures=3")
+	if err != nil {
+		t.FailNow()
+	}
+	if hc.Protocol != "HTTP" || hc.Path != "/health" || hc.IntervalSeconds != 10 || hc.GracePeriodSeconds != 30 || hc.MaxConsecutiveFailures != 3 {
+		t.FailNow()
+	}
+	hc, err = ConvertHealthCheck("")
+	if hc != nil || err != nil {
+		t.FailNow()
+	}
+	_, err = ConvertHealthCheck("protocol=TCP,interval=often")
+	if err == nil {
+		t.FailNow()
+	}
+	hc, err = ConvertHealthCheck("protocol=COMMAND, command=curl -f localhost, grace=5")
+	if err != nil || hc.Protocol != "COMMAND" || hc.Command != "curl -f localhost" || hc.GracePeriodSeconds != 5 {
+		t.Fatalf("unexpected health check %+v, error %v", hc, err)
+	}
+	hc, err = ConvertHealthCheck(`protocol=COMMAND,command="test -f /a,b"`)
+	if err != nil || hc.Command != "test -f /a,b" {
+		t.Fatalf("unexpected health check %+v, error %v", hc, err)
+	}
+	for _, invalid := range []string{`command="test`, "protocol=TCP,grace", "protocol=TCP,,grace=5"} {
+		if _, err = ConvertHealthCheck(invalid); err == nil {
+			t.Fatalf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestConvertEnvPatch(t *testing.T) {
+	env, err := ConvertEnvPatch([]string{"FOO=bar", "URL=http://host/?a=b", "OLD-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 3 || env["FOO"] != "bar" || env["URL"] != "http://host/?a=b" || env["OLD"] != nil {
+		t.Fatalf("unexpected env patch %v", env)
+	}
+	if _, ok := env["OLD"]; !ok {
+		t.Fatal("OLD should be removed with a null value")
+	}
+	for _, invalid := range []string{"FOO", "=bar"} {
+		if _, err := ConvertEnvPatch([]string{invalid}); err == nil {
+			t.Errorf("%s should be invalid", invalid)
+		}
+	}
+}
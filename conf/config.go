@@ -5,6 +5,7 @@ package conf
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -20,7 +21,7 @@ const (
 
 //Config is the current configuration for the server. It's mapped to a yaml file
 type Config struct {
-	BackendType       string //"marathon" or "kubernetes"
+	BackendType       string //"marathon" or "kubernetes", chosen at build time, or "simulation"
 	Endpoint          string //URL of the backend
 	FluentdEnabled    bool   //true if fluentd is enabled, will be ON for each container
 	DebugEnabled      bool
@@ -34,10 +35,17 @@ type Config struct {
 	Port              int
 	AuthorizedTeams   []AccessTuple
 	AuthorizedUsers   []AccessTuple
+	AdminTeams        []string //teams allowed to manage the apps of every team, in the backends scoping the apps by team
 	VersionBuildStamp string
 	VersionGitHash    string
 	MarathonAuth      MarathonAuth
-	EndpointPattern   string
+	MarathonEvents    MarathonEvents
+	EndpointPattern   string     //URL of the apps with the name of the app as %s, p.e. "https://%s.example.org"
+	Registries        []Registry //settings to pull images, the first entry without team and host is the default
+	LogLinks          []LogLink  //links to the logs of the replicas shown by info
+	Secrets           Secrets    //store of the secrets referenced in the env of the apps
+	Kubernetes        Kubernetes //used only by the kubernetes backend
+	Simulation        Simulation //used only by the simulation backend
 }
 
 //AccessTuple reprsent an entry for Auth
@@ -59,6 +67,129 @@ type MarathonAuth struct {
 	MarathonHttpPassword string
 }
 
+//MarathonEvents configures how chimp-server receives events from the marathon event bus.
+//With the "sse" transport (default) chimp-server connects to marathon's event stream, with "callback"
+//marathon calls chimp-server on the given interface and port.
+type MarathonEvents struct {
+	Transport string
+	Interface string
+	Port      int
+}
+
+//Kubernetes configures the access to the API server of the kubernetes backend, which is the Endpoint.
+//The bearer token is read from TokenFile, p.e. the token of the service account of chimp-server.
+//The apps of a team run in the namespace NamespaceTemplate, where {team} is replaced by the team; without
+//template, or without team when authentication is disabled, the apps run in the default namespace.
+//If CreateNamespaces is set the namespace of a team is created on its first deploy.
+//If Ingress is set the apps with ports are reachable at the host of the EndpointPattern through an ingress,
+//the apps setting their own host always are.
+type Kubernetes struct {
+	TokenFile         string
+	NamespaceTemplate string //p.e. "team-{team}"
+	CreateNamespaces  bool
+	Ingress           bool
+}
+
+//Simulation configures the simulation backend, which keeps the apps in memory. A replica is staging for StagingSeconds,
+//then it runs; a fraction FailureRate of the replicas fails after running for FailureSeconds. Seed makes the failures
+//reproducible, with 0 they are random.
+type Simulation struct {
+	StagingSeconds int
+	FailureSeconds int
+	FailureRate    float64 //between 0.0 and 1.0
+	Seed           int64
+}
+
+//Secrets configures the store resolving the secret://TEAM/NAME references in the env of the apps.
+//The "file" store reads the secret NAME of TEAM from the file Dir/TEAM/NAME. Without a store the references are rejected.
+type Secrets struct {
+	Store string //"file" or empty
+	Dir   string
+}
+
+//LogLink configures the link to the logs of a replica in a log management system. The URL template
+//can contain the placeholders {app}, {taskID}, {host}, {shortHost} (host without domain) and {containerName}.
+type LogLink struct {
+	Name        string //p.e. "kibana"
+	URLTemplate string
+}
+
+//Registry contains the settings used to pull the images of a team or of a registry host.
+//Settings which are not set are taken from the default registry.
+type Registry struct {
+	Team          string //if set, the settings are used for the apps of this team
+	Host          string //if set, the settings are used for the images of this registry host, p.e. "pierone.example.org"
+	DockerCfg     string //URI of the docker credentials fetched by the backend before starting the container
+	DockerVersion string //version of docker running the containers
+	ForcePull     *bool  //true if the image has to be pulled even if already present
+}
+
+//constants for the registry settings used if they are not configured
+const (
+	DefaultDockerCfg     = "file:///root/.dockercfg"
+	DefaultDockerVersion = "1.9"
+	DefaultForcePull     = true
+)
+
+//RegistryFor returns the settings to pull the image of an app of the given team.
+//An entry matching both team and registry host of the image wins over one matching only the team,
+//which wins over one matching only the host.
+func (c *Config) RegistryFor(team string, imageURL string) Registry {
+	forcePull := DefaultForcePull
+	registry := Registry{DockerCfg: DefaultDockerCfg, DockerVersion: DefaultDockerVersion, ForcePull: &forcePull}
+	host := RegistryHost(imageURL)
+	var best *Registry
+	bestScore := 0
+	defaultFound := false
+	for i := range c.Registries {
+		r := &c.Registries[i]
+		if (r.Team != "" && r.Team != team) || (r.Host != "" && r.Host != host) {
+			continue
+		}
+		score := 0
+		if r.Team != "" {
+			score += 2
+		}
+		if r.Host != "" {
+			score++
+		}
+		if score == 0 && !defaultFound {
+			registry.merge(r)
+			defaultFound = true
+		}
+		if score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	if best != nil {
+		registry.merge(best)
+	}
+	return registry
+}
+
+//merge overrides the settings of the registry with the ones set in other
+func (r *Registry) merge(other *Registry) {
+	if other.DockerCfg != "" {
+		r.DockerCfg = other.DockerCfg
+	}
+	if other.DockerVersion != "" {
+		r.DockerVersion = other.DockerVersion
+	}
+	if other.ForcePull != nil {
+		r.ForcePull = other.ForcePull
+	}
+}
+
+//RegistryHost returns the registry host of an image URL, like docker does: the first component
+//of the name is the host only if it contains a dot or a port, or is localhost.
+func RegistryHost(imageURL string) string {
+	parts := strings.SplitN(imageURL, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
+
 //shared state for configuration
 var conf *Config
 
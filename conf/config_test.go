@@ -0,0 +1,43 @@
+package conf
+
+import "testing"
+
+func TestRegistryFor(t *testing.T) {
+	noPull := false
+	config := Config{Registries: []Registry{
+		Registry{DockerCfg: "file:///etc/default.dockercfg"},
+		Registry{Host: "registry.example.org", DockerCfg: "file:///etc/example.dockercfg"},
+		Registry{Team: "cats", DockerVersion: "1.8", ForcePull: &noPull},
+		Registry{Team: "cats", Host: "registry.example.org", DockerCfg: "file:///etc/cats.dockercfg"},
+	}}
+	tests := []struct {
+		team, imageURL, dockerCfg, dockerVersion string
+		forcePull                                bool
+	}{
+		{"dogs", "nginx:1.9", "file:///etc/default.dockercfg", DefaultDockerVersion, DefaultForcePull},
+		{"dogs", "registry.example.org/dogs/app:1", "file:///etc/example.dockercfg", DefaultDockerVersion, DefaultForcePull},
+		{"cats", "localhost:5000/cats/app:1", "file:///etc/default.dockercfg", "1.8", false},
+		{"cats", "registry.example.org/cats/app:1", "file:///etc/cats.dockercfg", DefaultDockerVersion, DefaultForcePull},
+	}
+	for _, test := range tests {
+		registry := config.RegistryFor(test.team, test.imageURL)
+		if registry.DockerCfg != test.dockerCfg || registry.DockerVersion != test.dockerVersion || *registry.ForcePull != test.forcePull {
+			t.Errorf("unexpected registry for %s, %s: %+v", test.team, test.imageURL, registry)
+		}
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                            "docker.io",
+		"zalando/chimp:1.0":                "docker.io",
+		"localhost/chimp":                  "localhost",
+		"registry:5000/chimp":              "registry:5000",
+		"pierone.stups.zalan.do/cat/cat:1": "pierone.stups.zalan.do",
+	}
+	for imageURL, expected := range tests {
+		if host := RegistryHost(imageURL); host != expected {
+			t.Errorf("expected registry host %s for %s, got %s", expected, imageURL, host)
+		}
+	}
+}
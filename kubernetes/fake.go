@@ -0,0 +1,248 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//FakeServer is an in-process API server keeping the objects in memory, for the tests of the users of the client.
+//Objects of any resource can be created, read, listed with label selectors, replaced and deleted. Controllers
+//are not simulated, p.e. the pods of a deployment have to be created by the test.
+type FakeServer struct {
+	*httptest.Server
+	sync.Mutex
+	objects  map[string]map[string]interface{} //by path, like /api/v1/namespaces/NAMESPACE/pods/NAME
+	version  int
+	Requests []string //"METHOD PATH" of the requests received, without the query
+}
+
+//NewFakeServer starts a fake API server, which must be closed by the caller
+func NewFakeServer() *FakeServer {
+	fake := &FakeServer{objects: make(map[string]map[string]interface{})}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	return fake
+}
+
+//Object returns the object at the given path, or nil
+func (fake *FakeServer) Object(path string) map[string]interface{} {
+	fake.Lock()
+	defer fake.Unlock()
+	return fake.objects[path]
+}
+
+func (fake *FakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	fake.Lock()
+	defer fake.Unlock()
+	fake.Requests = append(fake.Requests, r.Method+" "+r.URL.Path)
+	if r.URL.Path == "/version" {
+		writeJSON(w, http.StatusOK, VersionInfo{Major: "1", Minor: "6", GitVersion: "v1.6.0-fake"})
+		return
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	collection := isCollection(path)
+	switch {
+	case r.Method == "GET" && collection:
+		fake.list(w, path, r.URL.Query().Get("labelSelector"))
+	case r.Method == "GET":
+		if object, ok := fake.objects[path]; ok {
+			writeJSON(w, http.StatusOK, object)
+		} else {
+			writeStatus(w, http.StatusNotFound, StatusReasonNotFound, fmt.Sprintf("%s not found", path))
+		}
+	case r.Method == "POST" && collection:
+		object, err := readObject(r)
+		if err != nil {
+			writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		name := objectName(object)
+		if name == "" {
+			writeStatus(w, http.StatusUnprocessableEntity, StatusReasonInvalid, "metadata.name is required")
+			return
+		}
+		if _, exists := fake.objects[path+"/"+name]; exists {
+			writeStatus(w, http.StatusConflict, StatusReasonAlreadyExists, fmt.Sprintf("%s already exists", name))
+			return
+		}
+		metadata := object["metadata"].(map[string]interface{})
+		metadata["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+		metadata["generation"] = 1
+		if namespace := namespaceOf(path); namespace != "" {
+			metadata["namespace"] = namespace
+		}
+		fake.store(path+"/"+name, object)
+		writeJSON(w, http.StatusCreated, object)
+	case r.Method == "PUT" && !collection:
+		current, exists := fake.objects[path]
+		if !exists {
+			writeStatus(w, http.StatusNotFound, StatusReasonNotFound, fmt.Sprintf("%s not found", path))
+			return
+		}
+		object, err := readObject(r)
+		if err != nil {
+			writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		currentMetadata := current["metadata"].(map[string]interface{})
+		metadata := object["metadata"].(map[string]interface{})
+		if version, ok := metadata["resourceVersion"]; ok && version != currentMetadata["resourceVersion"] {
+			writeStatus(w, http.StatusConflict, StatusReasonConflict, "the object has been modified")
+			return
+		}
+		metadata["creationTimestamp"] = currentMetadata["creationTimestamp"]
+		metadata["namespace"] = currentMetadata["namespace"]
+		//like the API server, only changes of the spec are a new generation
+		generation, _ := currentMetadata["generation"].(float64)
+		if !reflect.DeepEqual(object["spec"], current["spec"]) {
+			generation++
+		}
+		metadata["generation"] = generation
+		fake.store(path, object)
+		writeJSON(w, http.StatusOK, object)
+	case r.Method == "DELETE" && !collection:
+		if _, exists := fake.objects[path]; !exists {
+			writeStatus(w, http.StatusNotFound, StatusReasonNotFound, fmt.Sprintf("%s not found", path))
+			return
+		}
+		delete(fake.objects, path)
+		writeJSON(w, http.StatusOK, Status{Kind: "Status", Status: "Success", Code: http.StatusOK})
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not supported on "+path)
+	}
+}
+
+//store saves an object with a new resource version, the object is changed to be returned to the client
+func (fake *FakeServer) store(path string, object map[string]interface{}) {
+	fake.version++
+	object["metadata"].(map[string]interface{})["resourceVersion"] = strconv.Itoa(fake.version)
+	//the object is stored like it is read back by a client, with numbers as float64
+	data, _ := json.Marshal(object)
+	var stored map[string]interface{}
+	json.Unmarshal(data, &stored)
+	fake.objects[path] = stored
+}
+
+func (fake *FakeServer) list(w http.ResponseWriter, path string, selector string) {
+	paths := make([]string, 0)
+	for objectPath, object := range fake.objects {
+		parent := objectPath[:strings.LastIndex(objectPath, "/")]
+		//a collection without namespace has the objects of all the namespaces too
+		if (parent == path || withoutNamespace(parent) == path) && matchesSelector(object, selector) {
+			paths = append(paths, objectPath)
+		}
+	}
+	sort.Strings(paths)
+	items := make([]interface{}, len(paths))
+	for i, objectPath := range paths {
+		items[i] = fake.objects[objectPath]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"kind": "List", "apiVersion": "v1",
+		"metadata": ListMeta{ResourceVersion: strconv.Itoa(fake.version)}, "items": items})
+}
+
+//isCollection returns true for the paths of collections, like /api/v1/namespaces/NAMESPACE/pods or
+///apis/GROUP/VERSION/namespaces, which have an odd number of segments after the version
+func isCollection(path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	skip := 2 //api/VERSION
+	if segments[0] == "apis" {
+		skip = 3 //apis/GROUP/VERSION
+	}
+	return len(segments) > skip && (len(segments)-skip)%2 == 1
+}
+
+//namespaceOf returns the namespace of the objects of a collection path, if any
+func namespaceOf(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(segments)-2; i++ {
+		if segments[i] == "namespaces" {
+			return segments[i+1]
+		}
+	}
+	return ""
+}
+
+//withoutNamespace returns the path of a collection in a namespace as the one of the collection in all the namespaces,
+//like /api/v1/pods for /api/v1/namespaces/NAMESPACE/pods
+func withoutNamespace(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 0; i < len(segments)-2; i++ {
+		if segments[i] == "namespaces" {
+			return strings.Join(append(segments[:i:i], segments[i+2:]...), "/")
+		}
+	}
+	return path
+}
+
+func readObject(r *http.Request) (map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err = json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if _, ok := object["metadata"].(map[string]interface{}); !ok {
+		object["metadata"] = map[string]interface{}{}
+	}
+	return object, nil
+}
+
+func objectName(object map[string]interface{}) string {
+	name, _ := object["metadata"].(map[string]interface{})["name"].(string)
+	return name
+}
+
+//matchesSelector returns true if the labels of the object match all the requirements of the selector:
+//"key=value", "key==value", "key!=value", "key" (the label exists) and "!key" (it does not)
+func matchesSelector(object map[string]interface{}, selector string) bool {
+	labels := map[string]interface{}{}
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		if l, ok := metadata["labels"].(map[string]interface{}); ok {
+			labels = l
+		}
+	}
+	for _, requirement := range strings.Split(selector, ",") {
+		requirement = strings.TrimSpace(requirement)
+		if requirement == "" {
+			continue
+		}
+		if kv := strings.SplitN(requirement, "!=", 2); len(kv) == 2 {
+			if labels[kv[0]] == kv[1] {
+				return false
+			}
+			continue
+		}
+		if kv := strings.SplitN(strings.Replace(requirement, "==", "=", 1), "=", 2); len(kv) == 2 {
+			if labels[kv[0]] != kv[1] {
+				return false
+			}
+			continue
+		}
+		_, exists := labels[strings.TrimPrefix(requirement, "!")]
+		if exists == strings.HasPrefix(requirement, "!") {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason string, message string) {
+	writeJSON(w, code, Status{Kind: "Status", Status: "Failure", Message: message, Reason: reason, Code: code})
+}
@@ -1,228 +1,277 @@
-// +build ignore
-
+//Package kubernetes is a thin client of the Kubernetes REST API, covering the objects used by chimp
 package kubernetes
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"strconv"
-
-	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
-	k8s "github.com/GoogleCloudPlatform/kubernetes/pkg/client"
-	"github.com/GoogleCloudPlatform/kubernetes/pkg/fields"
-	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
-	"github.com/golang/glog"
-	"github.com/zalando/chimp/conf"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
-var SERVICE_SUFFIX = "-service"
+//Namespaces with a special meaning
+const (
+	NamespaceDefault = "default" //the namespace used when none is given
+	NamespaceAll     = ""        //lists the objects of all the namespaces
+)
 
-//global init for client
-var client = getKubernetesClient()
+//Client calls the API server at URL, authenticating with the bearer Token if set
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
 
-func getKubernetesClient() *k8s.Client {
-	client := k8s.NewOrDie(&k8s.Config{Host: conf.New().Endpoint, Version: "v1"}) //PANIC if config not correct
-	return client
+//NewClient returns a client of the API server at the given URL
+func NewClient(url string, token string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), Token: token, HTTPClient: &http.Client{Timeout: 30 * time.Second}}
 }
 
-//getKubernetesVersion returs the version of the API
-func getKubernetesVersion() string {
-	version, err := client.ServerVersion()
-	if err != nil {
-		glog.Error("Error getting kubernetes server version ", err)
-		return ""
-	}
-	return version.String()
+//StatusError is returned when the API server rejects a request
+type StatusError struct {
+	Status Status
 }
 
-//GetPods gets all the pods running in the cluster or info on one pod
-func GetListOfNames() ([]string, error) {
-	podsList, err := client.Pods(api.NamespaceDefault).List(labels.Everything(), fields.Everything())
-	if err != nil {
-		glog.Error("Unable to get list of pods. REASON: ", err)
-		return nil, err
+func (e *StatusError) Error() string {
+	if e.Status.Message != "" {
+		return e.Status.Message
 	}
-	pods := make([]string, 0, len(podsList.Items))
+	return fmt.Sprintf("kubernetes returned %d %s", e.Status.Code, e.Status.Reason)
+}
 
-	for _, pod := range podsList.Items {
-		pods = append(pods, pod.Name)
-	}
-	return pods, nil
+//IsNotFound returns true if the error is a missing object
+func IsNotFound(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && (statusErr.Status.Reason == StatusReasonNotFound || statusErr.Status.Code == http.StatusNotFound)
 }
 
-func DeployInfoKubernetes(req *KubernetesDeployInfoRequest) (*KubernetesDeployInfoResponse, error) {
-	rcs, err := client.ReplicationControllers(api.NamespaceDefault).Get(req.Name)
-	if err != nil {
-		glog.Error(err)
-		return nil, err
-	}
+//IsAlreadyExists returns true if the error is an object created twice
+func IsAlreadyExists(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.Status.Reason == StatusReasonAlreadyExists
+}
 
-	pods, err := client.Pods(api.NamespaceDefault).List(labels.Set(rcs.Labels).AsSelector(), fields.Everything())
-	if err != nil {
-		glog.Error(err)
-		return nil, err
+//SelectorFromSet returns the label selector matching all the given labels, like "app=shop,team=tm"
+func SelectorFromSet(labels map[string]string) string {
+	selectors := make([]string, 0, len(labels))
+	for key, value := range labels {
+		selectors = append(selectors, key+"="+value)
 	}
+	sort.Strings(selectors)
+	return strings.Join(selectors, ",")
+}
 
-	endpoints, err := client.Endpoints(api.NamespaceDefault).Get(req.Name + SERVICE_SUFFIX)
-	if err != nil {
-		glog.Error(err)
-		return nil, err
-	}
-	subset := api.EndpointSubset{}
-	eps := make([]string, 0, len(subset.Addresses))
-	ports := make([]*KubePort, 0, len(subset.Ports))
-	if len(endpoints.Subsets) > 0 {
-		subset = endpoints.Subsets[0]
-		for _, address := range subset.Addresses {
-			eps = append(eps, address.IP)
-		}
-		for _, port := range subset.Ports {
-			ports = append(ports, &KubePort{Port: port.Port, Protocol: string(port.Protocol)})
-		}
-	}
+//ServerVersion returns the version of the API server
+func (c *Client) ServerVersion() (*VersionInfo, error) {
+	var version VersionInfo
+	err := c.do("GET", "/version", nil, &version)
+	return &version, err
+}
 
-	podsInfo := make([]*KubernetesPodInfo, 0, len(pods.Items))
-	var deploymentReady bool = true
-	for _, item := range pods.Items {
-		//ips := []string{}
-		//ips = append(ips, item.Status.PodIP) //DOC we return PodIP for the endpoint
-		containers := make([]*ContainerInfo, 0, len(item.Status.ContainerStatuses))
-		var podReady bool = true
-		for _, container := range item.Status.ContainerStatuses {
-			if !container.Ready {
-				podReady = false
-			}
-			status, message := describeStatus(req.Name, container.State)
-			containerInfo := ContainerInfo{ImageURL: container.Image, Status: fmt.Sprintf("%s", status), Message: message}
-			containers = append(containers, &containerInfo) //TODO this must get the port from the POD.
-		}
+//GetNamespace returns a namespace
+func (c *Client) GetNamespace(name string) (*Namespace, error) {
+	var namespace Namespace
+	err := c.do("GET", objectPath(coreAPI, NamespaceAll, "namespaces", name), nil, &namespace)
+	return &namespace, err
+}
 
-		info := KubernetesPodInfo{
-			Status:     fmt.Sprintf("Ready: %s", strconv.FormatBool(podReady)),
-			Containers: containers,
-			Ports:      ports,
-			Endpoints:  eps,
-		}
-		if !podReady {
-			deploymentReady = false
-		}
+//CreateNamespace creates a namespace
+func (c *Client) CreateNamespace(namespace *Namespace) (*Namespace, error) {
+	var result Namespace
+	err := c.do("POST", objectPath(coreAPI, NamespaceAll, "namespaces", ""), namespace, &result)
+	return &result, err
+}
 
-		podsInfo = append(podsInfo, &info)
-	}
+//ListPods lists the pods of a namespace matching the label selector
+func (c *Client) ListPods(namespace string, selector string) (*PodList, error) {
+	var list PodList
+	err := c.do("GET", listPath(coreAPI, namespace, "pods", selector), nil, &list)
+	return &list, err
+}
 
-	//TODO how should kubernetes respond in case of a deployment that is over? Shall we still provide info?
+//CreatePod creates a pod
+func (c *Client) CreatePod(namespace string, pod *Pod) (*Pod, error) {
+	var result Pod
+	err := c.do("POST", objectPath(coreAPI, namespace, "pods", ""), pod, &result)
+	return &result, err
+}
 
-	response := KubernetesDeployInfoResponse{Name: req.Name,
-		Labels:    req.Labels,
-		Status:    fmt.Sprintf("Ready: %s", strconv.FormatBool(deploymentReady)),
-		Replicas:  podsInfo,
-		Instances: rcs.Status.Replicas}
-	return &response, nil
+//DeletePod deletes a pod, the controller of the pod replaces it
+func (c *Client) DeletePod(namespace string, name string) error {
+	return c.do("DELETE", objectPath(coreAPI, namespace, "pods", name), nil, nil)
 }
 
-//CreateService creates a kubernetes service.
-//This shouldn't be used directly by any other part of the application for now
-func createService(req *KubernetesDeployRequest, force bool) error {
-	//building ports datastructure cause kubernetes uses a pretty strange one
-	ports := make([]api.ServicePort, 0, len(req.Ports))
-	for _, port := range req.Ports {
-		ports = append(ports, api.ServicePort{Port: port})
-	}
-	glog.Info(ports)
-	serviceName := req.Name + SERVICE_SUFFIX
-	service := api.Service{ObjectMeta: api.ObjectMeta{Name: serviceName}, //CHECK: convention to name services
-		Spec: api.ServiceSpec{Selector: req.Labels, Ports: ports, Type: "NodePort"}}
-	_, err := client.Services(api.NamespaceDefault).Create(&service)
-	if err != nil {
-		glog.Error("Cannot create service")
-		return err
-	}
-	return nil
+//ListDeployments lists the deployments of a namespace, or of all of them with NamespaceAll, matching the label selector
+func (c *Client) ListDeployments(namespace string, selector string) (*DeploymentList, error) {
+	var list DeploymentList
+	err := c.do("GET", listPath(appsAPI, namespace, "deployments", selector), nil, &list)
+	return &list, err
 }
 
-//Deploy to deploy something on kubernetes. Creates a service, a replication controller and the given pods
-func Deploy(req *KubernetesDeployRequest, force bool) (*KubernetesDeployResponse, error) {
-	if force {
-		Delete(&KubernetesDeleteRequest{Name: req.Name})
-	}
+//GetDeployment returns a deployment
+func (c *Client) GetDeployment(namespace string, name string) (*Deployment, error) {
+	var deployment Deployment
+	err := c.do("GET", objectPath(appsAPI, namespace, "deployments", name), nil, &deployment)
+	return &deployment, err
+}
 
-	serviceErr := createService(req, force)
-	if serviceErr != nil {
-		glog.Error("Error creating the service.")
-		return nil, serviceErr //just returning the same error as above
-	}
+//CreateDeployment creates a deployment
+func (c *Client) CreateDeployment(namespace string, deployment *Deployment) (*Deployment, error) {
+	var result Deployment
+	err := c.do("POST", objectPath(appsAPI, namespace, "deployments", ""), deployment, &result)
+	return &result, err
+}
 
-	glog.Infof("req: %+v", req)
-
-	controller := api.ReplicationController{
-		ObjectMeta: api.ObjectMeta{
-			Name:   req.Name,
-			Labels: req.Labels,
-		},
-		Spec: api.ReplicationControllerSpec{
-			Replicas: req.Replicas,
-			Selector: req.Labels, //FIXME: replicas and selectors shouldn't be the same thing!
-			Template: &api.PodTemplateSpec{
-				ObjectMeta: api.ObjectMeta{
-					Labels: req.Labels,
-				},
-				Spec: api.PodSpec{
-					Containers: []api.Container{
-						{
-							Name:  req.Name, //FIXME: container name should be different from replica-controller name, yet invisible for the user
-							Image: req.ImageURL,
-						},
-					},
-				},
-			},
-		},
-	}
+//UpdateDeployment replaces a deployment, which rolls out the changes of the template.
+//The resource version of deployment must be the current one.
+func (c *Client) UpdateDeployment(namespace string, deployment *Deployment) (*Deployment, error) {
+	var result Deployment
+	err := c.do("PUT", objectPath(appsAPI, namespace, "deployments", deployment.Metadata.Name), deployment, &result)
+	return &result, err
+}
 
-	glog.Infof("controller: %+v", controller)
-	result, err := client.ReplicationControllers(api.NamespaceDefault).Create(&controller)
-	if err != nil {
-		glog.Error("Error starting a replication controller.")
-		return nil, err
+//DeleteDeployment deletes a deployment and its pods
+func (c *Client) DeleteDeployment(namespace string, name string) error {
+	options := DeleteOptions{Kind: "DeleteOptions", APIVersion: "v1", PropagationPolicy: PropagationBackground}
+	return c.do("DELETE", objectPath(appsAPI, namespace, "deployments", name), &options, nil)
+}
+
+//GetService returns a service
+func (c *Client) GetService(namespace string, name string) (*Service, error) {
+	var service Service
+	err := c.do("GET", objectPath(coreAPI, namespace, "services", name), nil, &service)
+	return &service, err
+}
+
+//CreateService creates a service
+func (c *Client) CreateService(namespace string, service *Service) (*Service, error) {
+	var result Service
+	err := c.do("POST", objectPath(coreAPI, namespace, "services", ""), service, &result)
+	return &result, err
+}
+
+//UpdateService replaces a service. The resource version of service must be the current one.
+func (c *Client) UpdateService(namespace string, service *Service) (*Service, error) {
+	var result Service
+	err := c.do("PUT", objectPath(coreAPI, namespace, "services", service.Metadata.Name), service, &result)
+	return &result, err
+}
+
+//DeleteService deletes a service
+func (c *Client) DeleteService(namespace string, name string) error {
+	return c.do("DELETE", objectPath(coreAPI, namespace, "services", name), nil, nil)
+}
+
+//ListIngresses lists the ingresses of a namespace, or of all of them with NamespaceAll, matching the label selector
+func (c *Client) ListIngresses(namespace string, selector string) (*IngressList, error) {
+	var list IngressList
+	err := c.do("GET", listPath(networkingAPI, namespace, "ingresses", selector), nil, &list)
+	return &list, err
+}
+
+//GetIngress returns an ingress
+func (c *Client) GetIngress(namespace string, name string) (*Ingress, error) {
+	var ingress Ingress
+	err := c.do("GET", objectPath(networkingAPI, namespace, "ingresses", name), nil, &ingress)
+	return &ingress, err
+}
+
+//CreateIngress creates an ingress
+func (c *Client) CreateIngress(namespace string, ingress *Ingress) (*Ingress, error) {
+	var result Ingress
+	err := c.do("POST", objectPath(networkingAPI, namespace, "ingresses", ""), ingress, &result)
+	return &result, err
+}
+
+//UpdateIngress replaces an ingress. The resource version of ingress must be the current one.
+func (c *Client) UpdateIngress(namespace string, ingress *Ingress) (*Ingress, error) {
+	var result Ingress
+	err := c.do("PUT", objectPath(networkingAPI, namespace, "ingresses", ingress.Metadata.Name), ingress, &result)
+	return &result, err
+}
+
+//DeleteIngress deletes an ingress
+func (c *Client) DeleteIngress(namespace string, name string) error {
+	return c.do("DELETE", objectPath(networkingAPI, namespace, "ingresses", name), nil, nil)
+}
+
+//paths of the API groups
+const (
+	coreAPI       = "/api/v1"
+	appsAPI       = "/apis/apps/v1"
+	networkingAPI = "/apis/networking.k8s.io/v1"
+)
+
+//objectPath returns the path of an object of an API group, or of the collection if name is empty.
+//Without namespace the path is the one of the objects not in a namespace, or of the collection in all the namespaces.
+func objectPath(api string, namespace string, resource string, name string) string {
+	path := fmt.Sprintf("%s/%s", api, resource)
+	if namespace != NamespaceAll {
+		path = fmt.Sprintf("%s/namespaces/%s/%s", api, namespace, resource)
+	}
+	if name != "" {
+		path += "/" + name
 	}
-	glog.Info(result)
-	return &KubernetesDeployResponse{Status: strconv.FormatInt(result.Status.ObservedGeneration, 10),
-			Name: result.ObjectMeta.Name},
-		nil
+	return path
+}
 
+func listPath(api string, namespace string, resource string, selector string) string {
+	path := objectPath(api, namespace, resource, "")
+	if selector != "" {
+		path += "?labelSelector=" + url.QueryEscape(selector)
+	}
+	return path
 }
 
-//Delete deletes services, replication containers, pods that were created with Deploy above
-func Delete(deleteReq *KubernetesDeleteRequest) error {
-	err := client.ReplicationControllers(api.NamespaceDefault).Delete(deleteReq.Name)
+//do sends a request with body as JSON and decodes the response into result, if not nil.
+//Failed requests return a *StatusError.
+func (c *Client) do(method string, path string, body interface{}, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, c.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	res, err := c.HTTPClient.Do(req)
 	if err != nil {
-		glog.Error(err)
 		return err
 	}
-	err = client.Services(api.NamespaceDefault).Delete(deleteReq.Name + SERVICE_SUFFIX)
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		glog.Error(err)
 		return err
 	}
-	return nil
-}
-
-//making human readable the magic that Kubernetes creates!
-func describeStatus(stateName string, state api.ContainerState) (string, string) {
-	switch {
-	case state.Running != nil:
-		return fmt.Sprintf("%s: Running\n", stateName), ""
-	case state.Waiting != nil:
-		if state.Waiting.Reason != "" {
-			return fmt.Sprintf("%s: Waiting\n", stateName), fmt.Sprintf("Reason: %s\n", state.Waiting.Reason)
-		} else {
-			return fmt.Sprintf("%s: Waiting\n", stateName), ""
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		statusErr := StatusError{}
+		if json.Unmarshal(data, &statusErr.Status) != nil || statusErr.Status.Code == 0 {
+			statusErr.Status.Code = res.StatusCode
 		}
-	case state.Terminated != nil:
-		if state.Terminated.Reason != "" {
-			return fmt.Sprintf("%s: Terminated\n", stateName), fmt.Sprintf("Reason: %s\n", state.Terminated.Reason)
-		} else {
-			return fmt.Sprintf("%s: Terminated\n", stateName), ""
+		if statusErr.Status.Reason == "" && res.StatusCode == http.StatusNotFound {
+			statusErr.Status.Reason = StatusReasonNotFound
 		}
-	default:
-		return fmt.Sprintf("%s: Waiting\n", stateName), ""
+		return &statusErr
+	}
+	if result == nil {
+		return nil
 	}
+	return json.Unmarshal(data, result)
 }
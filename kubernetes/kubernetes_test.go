@@ -1,50 +1,180 @@
-// +build ignore
-
 package kubernetes
 
 import (
-	"fmt"
 	"testing"
 )
 
-func TestGetPods(t *testing.T) {
-	GetPods()
+func testDeployment(name string, team string) *Deployment {
+	replicas := 2
+	labels := map[string]string{"app": name, "team": team}
+	return &Deployment{
+		Metadata: ObjectMeta{Name: name, Labels: labels},
+		Spec: DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: PodTemplateSpec{
+				Metadata: ObjectMeta{Labels: labels},
+				Spec:     PodSpec{Containers: []Container{{Name: name, Image: "pierone/" + name + ":1.0"}}},
+			},
+			Strategy: DeploymentStrategy{Type: RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &RollingUpdateDeployment{MaxUnavailable: FromString("25%"), MaxSurge: &IntOrString{IntVal: 1}}},
+		},
+	}
 }
 
-func TestDeploy(t *testing.T) {
-	deployReq := KubernetesDeployRequest{
-		Name:     "cat3",
-		Labels:   map[string]string{"name": "cat-label"},
-		ImageURL: "pierone.stups.zalan.do/cat/cat-hello-aws:0.0.1",
-		Replicas: 2,
-		Ports:    []int{8080},
+func TestDeployments(t *testing.T) {
+	fake := NewFakeServer()
+	defer fake.Close()
+	client := NewClient(fake.URL, "secret")
+
+	created, err := client.CreateDeployment(NamespaceDefault, testDeployment("shop", "tm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Metadata.ResourceVersion == "" || created.Metadata.Namespace != NamespaceDefault {
+		t.Fatalf("unexpected metadata %+v", created.Metadata)
+	}
+	if strategy := created.Spec.Strategy.RollingUpdate; *strategy.MaxUnavailable != *FromString("25%") || *strategy.MaxSurge != (IntOrString{IntVal: 1}) {
+		t.Fatalf("unexpected strategy %+v", strategy)
 	}
-	_, err := Deploy(&deployReq)
+	if _, err = client.CreateDeployment(NamespaceDefault, testDeployment("shop", "tm")); !IsAlreadyExists(err) {
+		t.Fatalf("expected the deployment to exist already, got %v", err)
+	}
+	client.CreateDeployment(NamespaceDefault, testDeployment("cart", "other"))
+
+	list, err := client.ListDeployments(NamespaceDefault, SelectorFromSet(map[string]string{"team": "tm"}))
 	if err != nil {
-		fmt.Print(err)
-		t.FailNow()
-	} else {
-		fmt.Print("Success")
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].Metadata.Name != "shop" {
+		t.Fatalf("expected only shop, got %+v", list.Items)
+	}
+
+	deployment, err := client.GetDeployment(NamespaceDefault, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := 5
+	deployment.Spec.Replicas = &replicas
+	updated, err := client.UpdateDeployment(NamespaceDefault, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updated.Spec.Replicas != 5 || updated.Metadata.ResourceVersion == deployment.Metadata.ResourceVersion ||
+		updated.Metadata.Generation != 2 {
+		t.Fatalf("unexpected update %+v", updated)
+	}
+	//the resource version sent is not the current one anymore
+	if _, err = client.UpdateDeployment(NamespaceDefault, deployment); err == nil || IsNotFound(err) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+
+	if err = client.DeleteDeployment(NamespaceDefault, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetDeployment(NamespaceDefault, "shop"); !IsNotFound(err) {
+		t.Fatalf("expected the deployment to be deleted, got %v", err)
+	}
+	if err = client.DeleteDeployment(NamespaceDefault, "shop"); !IsNotFound(err) {
+		t.Fatalf("expected not found deleting twice, got %v", err)
 	}
 }
 
-func TestGetDeployInfo(t *testing.T) {
-	req := KubernetesDeployInfoRequest{Name: "guestbook-ucbv2", Labels: map[string]string{}}
-	info, err := DeployInfoKubernetes(&req)
+func TestNamespaces(t *testing.T) {
+	fake := NewFakeServer()
+	defer fake.Close()
+	client := NewClient(fake.URL, "")
+
+	if _, err := client.GetNamespace("team-tm"); !IsNotFound(err) {
+		t.Fatalf("expected the namespace to be missing, got %v", err)
+	}
+	created, err := client.CreateNamespace(&Namespace{Metadata: ObjectMeta{Name: "team-tm"}})
+	if err != nil || created.Metadata.Name != "team-tm" || created.Metadata.Namespace != "" {
+		t.Fatalf("unexpected namespace %+v, error %v", created, err)
+	}
+	if _, err = client.GetNamespace("team-tm"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.CreateNamespace(&Namespace{Metadata: ObjectMeta{Name: "team-tm"}}); !IsAlreadyExists(err) {
+		t.Fatalf("expected the namespace to exist already, got %v", err)
+	}
+
+	client.CreateDeployment("team-tm", testDeployment("shop", "tm"))
+	client.CreateDeployment("team-other", testDeployment("shop", "other"))
+	client.CreateDeployment("team-other", testDeployment("cart", "other"))
+	list, err := client.ListDeployments(NamespaceAll, "app=shop")
 	if err != nil {
-		fmt.Print(err)
-		t.FailNow()
-	} else {
-		fmt.Println(info)
+		t.Fatal(err)
+	}
+	if len(list.Items) != 2 || list.Items[0].Metadata.Namespace != "team-other" || list.Items[1].Metadata.Namespace != "team-tm" {
+		t.Fatalf("expected shop in both namespaces, got %+v", list.Items)
+	}
+	if list, _ = client.ListDeployments("team-tm", ""); len(list.Items) != 1 {
+		t.Fatalf("expected only the deployment of team-tm, got %+v", list.Items)
 	}
 }
 
-func TestDelete(t *testing.T) {
-	deployReq := KubernetesDeleteRequest{Name: "cat3"}
-	err := Delete(&deployReq)
+func TestIngresses(t *testing.T) {
+	fake := NewFakeServer()
+	defer fake.Close()
+	client := NewClient(fake.URL, "")
+
+	backend := IngressBackend{Service: &IngressServiceBackend{Name: "shop-service", Port: ServiceBackendPort{Number: 8080}}}
+	ingress := &Ingress{Metadata: ObjectMeta{Name: "shop-ingress"}, Spec: IngressSpec{Rules: []IngressRule{{Host: "shop.example.org",
+		HTTP: &HTTPIngressRuleValue{Paths: []HTTPIngressPath{{Path: "/", PathType: PathTypePrefix, Backend: backend}}}}}}}
+	created, err := client.CreateIngress(NamespaceDefault, ingress)
 	if err != nil {
-		t.FailNow()
-	} else {
-		fmt.Printf("Delete successful")
+		t.Fatal(err)
+	}
+	if fake.Object("/apis/networking.k8s.io/v1/namespaces/default/ingresses/shop-ingress") == nil {
+		t.Fatalf("expected the ingress in the networking API, got requests %v", fake.Requests)
+	}
+	created.Spec.Rules[0].Host = "shop.example.com"
+	if _, err = client.UpdateIngress(NamespaceDefault, created); err != nil {
+		t.Fatal(err)
+	}
+	read, err := client.GetIngress(NamespaceDefault, "shop-ingress")
+	if err != nil || read.Spec.Rules[0].Host != "shop.example.com" || read.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port.Number != 8080 {
+		t.Fatalf("unexpected ingress %+v, error %v", read, err)
+	}
+	if list, err := client.ListIngresses(NamespaceAll, ""); err != nil || len(list.Items) != 1 || list.Items[0].Metadata.Namespace != NamespaceDefault {
+		t.Fatalf("expected the ingress in the list of all the namespaces, got %+v, error %v", list, err)
+	}
+	if err = client.DeleteIngress(NamespaceDefault, "shop-ingress"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetIngress(NamespaceDefault, "shop-ingress"); !IsNotFound(err) {
+		t.Fatalf("expected the ingress to be deleted, got %v", err)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	fake := NewFakeServer()
+	defer fake.Close()
+	version, err := NewClient(fake.URL, "").ServerVersion()
+	if err != nil || version.GitVersion == "" {
+		t.Fatalf("unexpected version %+v, error %v", version, err)
+	}
+	if _, err = NewClient(fake.URL+"/missing", "").ServerVersion(); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestMatchesSelector(t *testing.T) {
+	object := map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "shop", "team": "tm"}}}
+	for selector, expected := range map[string]bool{
+		"":                  true,
+		"app=shop":          true,
+		"app==shop,team=tm": true,
+		"app=cart":          false,
+		"team!=tm":          false,
+		"team!=other":       true,
+		"team":              true,
+		"!team":             false,
+		"!version":          true,
+	} {
+		if matchesSelector(object, selector) != expected {
+			t.Errorf("selector %q should match: %t", selector, expected)
+		}
 	}
 }
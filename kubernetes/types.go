@@ -1,59 +1,428 @@
 package kubernetes
 
-//KubernetesDeployRequest struct to request creation of replication controllers
-type KubernetesDeployRequest struct {
-	Name        string
-	Ports       []int
-	Labels      map[string]string
-	ImageURL    string
-	Env         map[string]string
-	Replicas    int
-	CPULimit    int
-	MemoryLimit int
+import "encoding/json"
+
+//The types below are the subset of the Kubernetes v1 API objects used by chimp, with the same JSON names
+
+//ObjectMeta is the metadata of every object
+type ObjectMeta struct {
+	Name              string            `json:"name,omitempty"`
+	Namespace         string            `json:"namespace,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	CreationTimestamp string            `json:"creationTimestamp,omitempty"`
+}
+
+//ListMeta is the metadata of a list of objects
+type ListMeta struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+//Status is returned by the API server for failed requests
+type Status struct {
+	Kind    string `json:"kind,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+//Reasons of the failed requests
+const (
+	StatusReasonNotFound      = "NotFound"
+	StatusReasonAlreadyExists = "AlreadyExists"
+	StatusReasonConflict      = "Conflict"
+	StatusReasonInvalid       = "Invalid"
+)
+
+//VersionInfo is the version of the API server
+type VersionInfo struct {
+	Major      string `json:"major"`
+	Minor      string `json:"minor"`
+	GitVersion string `json:"gitVersion"`
+}
+
+//DeleteOptions are sent with a delete, p.e. to delete the pods of a controller too
+type DeleteOptions struct {
+	Kind              string `json:"kind,omitempty"`
+	APIVersion        string `json:"apiVersion,omitempty"`
+	PropagationPolicy string `json:"propagationPolicy,omitempty"`
+}
+
+//PropagationBackground deletes the dependents of an object, like the pods of a controller, in the background
+const PropagationBackground = "Background"
+
+//Namespace groups objects, the names of the objects are unique in a namespace
+type Namespace struct {
+	Kind       string     `json:"kind,omitempty"`
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Metadata   ObjectMeta `json:"metadata"`
+}
+
+//Pod is a group of containers running together on a node
+type Pod struct {
+	Kind       string     `json:"kind,omitempty"`
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       PodSpec    `json:"spec"`
+	Status     PodStatus  `json:"status,omitempty"`
+}
+
+//PodList is a list of pods
+type PodList struct {
+	Metadata ListMeta `json:"metadata"`
+	Items    []Pod    `json:"items"`
+}
+
+//PodSpec describes the containers of a pod
+type PodSpec struct {
+	Containers []Container `json:"containers"`
+	Volumes    []Volume    `json:"volumes,omitempty"`
+	NodeName   string      `json:"nodeName,omitempty"`
+}
+
+//Volume is a volume of a pod, a directory of the node or an empty directory living as long as the pod
+type Volume struct {
+	Name     string                `json:"name"`
+	HostPath *HostPathVolumeSource `json:"hostPath,omitempty"`
+	EmptyDir *EmptyDirVolumeSource `json:"emptyDir,omitempty"`
+}
+
+//HostPathVolumeSource is a directory of the node
+type HostPathVolumeSource struct {
+	Path string `json:"path"`
+}
+
+//EmptyDirVolumeSource is an empty directory created for the pod
+type EmptyDirVolumeSource struct{}
+
+//Container is a container of a pod
+type Container struct {
+	Name           string               `json:"name"`
+	Image          string               `json:"image"`
+	Ports          []ContainerPort      `json:"ports,omitempty"`
+	Env            []EnvVar             `json:"env,omitempty"`
+	Resources      ResourceRequirements `json:"resources,omitempty"`
+	VolumeMounts   []VolumeMount        `json:"volumeMounts,omitempty"`
+	LivenessProbe  *Probe               `json:"livenessProbe,omitempty"`
+	ReadinessProbe *Probe               `json:"readinessProbe,omitempty"`
+}
+
+//Names of the resources of a container
+const (
+	ResourceCPU              = "cpu"
+	ResourceMemory           = "memory"
+	ResourceEphemeralStorage = "ephemeral-storage"
+)
+
+//ResourceRequirements are the quantities of the resources reserved for a container and the ones it cannot exceed,
+//by resource name
+type ResourceRequirements struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+//VolumeMount mounts a volume of the pod in a container
+type VolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+//Probe checks a container with one of the actions, zero values are defaulted by the API server
+type Probe struct {
+	HTTPGet             *HTTPGetAction   `json:"httpGet,omitempty"`
+	TCPSocket           *TCPSocketAction `json:"tcpSocket,omitempty"`
+	Exec                *ExecAction      `json:"exec,omitempty"`
+	InitialDelaySeconds int              `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int              `json:"periodSeconds,omitempty"`
+	FailureThreshold    int              `json:"failureThreshold,omitempty"`
+}
+
+//HTTPGetAction checks that a GET of the path on the port succeeds
+type HTTPGetAction struct {
+	Path string `json:"path,omitempty"`
+	Port int    `json:"port"`
+}
+
+//TCPSocketAction checks that the port accepts connections
+type TCPSocketAction struct {
+	Port int `json:"port"`
 }
 
-//KubernetesDeployResponse struct used as response to every deploy
-type KubernetesDeployResponse struct {
-	Status string
-	Name   string
+//ExecAction checks that the command exits with 0 inside the container
+type ExecAction struct {
+	Command []string `json:"command"`
 }
 
-//KubernetesDeleteRequest struct to request delete of replication controllers
-type KubernetesDeleteRequest struct {
-	Name string
+//ContainerPort is a port exposed by a container
+type ContainerPort struct {
+	Name          string `json:"name,omitempty"`
+	ContainerPort int    `json:"containerPort"`
+	HostPort      int    `json:"hostPort,omitempty"`
+	Protocol      string `json:"protocol,omitempty"` //TCP or UDP
 }
 
-//KubernetesDeployInfoResponse struct to give information to the caller about the status
-type KubernetesDeployInfoRequest struct {
-	Name   string
-	Labels map[string]string
+//EnvVar is an environment variable of a container
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
-type ContainerInfo struct {
-	ImageURL string
-	Status   string
-	Message  string
+//Phases of a pod
+const (
+	PodPending   = "Pending"
+	PodRunning   = "Running"
+	PodSucceeded = "Succeeded"
+	PodFailed    = "Failed"
+)
+
+//PodStatus is the observed state of a pod
+type PodStatus struct {
+	Phase             string            `json:"phase,omitempty"`
+	Message           string            `json:"message,omitempty"`
+	Reason            string            `json:"reason,omitempty"`
+	HostIP            string            `json:"hostIP,omitempty"`
+	PodIP             string            `json:"podIP,omitempty"`
+	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+//ContainerStatus is the observed state of a container of a pod
+type ContainerStatus struct {
+	Name         string         `json:"name"`
+	Ready        bool           `json:"ready"`
+	RestartCount int            `json:"restartCount"`
+	Image        string         `json:"image"`
+	State        ContainerState `json:"state"`
+}
+
+//ContainerState is one of running, waiting or terminated
+type ContainerState struct {
+	Waiting    *ContainerStateWaiting    `json:"waiting,omitempty"`
+	Running    *ContainerStateRunning    `json:"running,omitempty"`
+	Terminated *ContainerStateTerminated `json:"terminated,omitempty"`
+}
+
+//ContainerStateWaiting is the state of a container not started yet
+type ContainerStateWaiting struct {
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+//ContainerStateRunning is the state of a running container
+type ContainerStateRunning struct {
+	StartedAt string `json:"startedAt,omitempty"`
+}
+
+//ContainerStateTerminated is the state of a container which exited
+type ContainerStateTerminated struct {
+	ExitCode int    `json:"exitCode"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+//PodTemplateSpec describes the pods created by a controller
+type PodTemplateSpec struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+}
+
+//LabelSelector selects the objects having all the given labels
+type LabelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
+}
+
+//Deployment keeps the given number of replicas of a pod running and replaces them with rolling updates
+type Deployment struct {
+	Kind       string           `json:"kind,omitempty"`
+	APIVersion string           `json:"apiVersion,omitempty"`
+	Metadata   ObjectMeta       `json:"metadata"`
+	Spec       DeploymentSpec   `json:"spec"`
+	Status     DeploymentStatus `json:"status,omitempty"`
+}
+
+//DeploymentList is a list of deployments
+type DeploymentList struct {
+	Metadata ListMeta     `json:"metadata"`
+	Items    []Deployment `json:"items"`
+}
+
+//DeploymentSpec is the desired state of a deployment
+type DeploymentSpec struct {
+	Replicas *int               `json:"replicas"`
+	Selector *LabelSelector     `json:"selector"`
+	Template PodTemplateSpec    `json:"template"`
+	Strategy DeploymentStrategy `json:"strategy,omitempty"`
+}
+
+//Types of deployment strategies
+const (
+	RollingUpdateDeploymentStrategyType = "RollingUpdate"
+	RecreateDeploymentStrategyType      = "Recreate"
+)
+
+//DeploymentStrategy tells how the pods of a deployment are replaced
+type DeploymentStrategy struct {
+	Type          string                   `json:"type,omitempty"`
+	RollingUpdate *RollingUpdateDeployment `json:"rollingUpdate,omitempty"`
+}
+
+//RollingUpdateDeployment limits the pods unavailable and the ones on top of the requested replicas during
+//a rolling update, as numbers or percentages like "25%"
+type RollingUpdateDeployment struct {
+	MaxUnavailable *IntOrString `json:"maxUnavailable,omitempty"`
+	MaxSurge       *IntOrString `json:"maxSurge,omitempty"`
+}
+
+//DeploymentStatus is the observed state of a deployment
+type DeploymentStatus struct {
+	ObservedGeneration  int64                 `json:"observedGeneration,omitempty"`
+	Replicas            int                   `json:"replicas,omitempty"`
+	UpdatedReplicas     int                   `json:"updatedReplicas,omitempty"`
+	ReadyReplicas       int                   `json:"readyReplicas,omitempty"`
+	AvailableReplicas   int                   `json:"availableReplicas,omitempty"`
+	UnavailableReplicas int                   `json:"unavailableReplicas,omitempty"`
+	Conditions          []DeploymentCondition `json:"conditions,omitempty"`
+}
+
+//Condition of a deployment which failed to progress
+const (
+	DeploymentProgressing    = "Progressing"
+	ProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+)
+
+//DeploymentCondition is a condition of a deployment, like Progressing
+type DeploymentCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+//IntOrString is a value which can be a number or a string, like the limits of a rolling update
+type IntOrString struct {
+	IntVal   int
+	StrVal   string
+	IsString bool
+}
+
+//FromString returns the value of a string, like "25%"
+func FromString(value string) *IntOrString {
+	return &IntOrString{StrVal: value, IsString: true}
+}
+
+//FromInt returns the value of a number, like 1
+func FromInt(value int) *IntOrString {
+	return &IntOrString{IntVal: value}
+}
+
+//MarshalJSON writes the value as a JSON number or string
+func (v IntOrString) MarshalJSON() ([]byte, error) {
+	if v.IsString {
+		return json.Marshal(v.StrVal)
+	}
+	return json.Marshal(v.IntVal)
+}
+
+//UnmarshalJSON reads the value from a JSON number or string
+func (v *IntOrString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		v.IsString = true
+		return json.Unmarshal(data, &v.StrVal)
+	}
+	v.IsString = false
+	return json.Unmarshal(data, &v.IntVal)
+}
+
+//Types of services
+const (
+	ServiceTypeClusterIP = "ClusterIP"
+	ServiceTypeNodePort  = "NodePort"
+)
+
+//Service exposes the ports of the pods matching its selector
+type Service struct {
+	Kind       string      `json:"kind,omitempty"`
+	APIVersion string      `json:"apiVersion,omitempty"`
+	Metadata   ObjectMeta  `json:"metadata"`
+	Spec       ServiceSpec `json:"spec"`
+}
+
+//ServiceSpec describes the ports and the pods of a service
+type ServiceSpec struct {
+	Type      string            `json:"type,omitempty"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	Ports     []ServicePort     `json:"ports"`
+	ClusterIP string            `json:"clusterIP,omitempty"`
+}
+
+//ServicePort is a port of a service, forwarded to TargetPort of the pods
+type ServicePort struct {
+	Name       string `json:"name,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Port       int    `json:"port"`
+	TargetPort int    `json:"targetPort,omitempty"`
+	NodePort   int    `json:"nodePort,omitempty"`
+}
+
+//Ingress routes the HTTP requests for a host to a service
+type Ingress struct {
+	Kind       string      `json:"kind,omitempty"`
+	APIVersion string      `json:"apiVersion,omitempty"`
+	Metadata   ObjectMeta  `json:"metadata"`
+	Spec       IngressSpec `json:"spec"`
+}
+
+//IngressList is a list of ingresses
+type IngressList struct {
+	Metadata ListMeta  `json:"metadata"`
+	Items    []Ingress `json:"items"`
+}
+
+//IngressSpec describes the rules of an ingress
+type IngressSpec struct {
+	Rules []IngressRule `json:"rules"`
+}
+
+//IngressRule routes the requests for Host
+type IngressRule struct {
+	Host string                `json:"host,omitempty"`
+	HTTP *HTTPIngressRuleValue `json:"http,omitempty"`
+}
+
+//HTTPIngressRuleValue lists the paths routed by a rule
+type HTTPIngressRuleValue struct {
+	Paths []HTTPIngressPath `json:"paths"`
+}
+
+//Types of the paths of an ingress
+const (
+	PathTypePrefix = "Prefix"
+	PathTypeExact  = "Exact"
+)
+
+//HTTPIngressPath routes the requests for Path to Backend
+type HTTPIngressPath struct {
+	Path     string         `json:"path,omitempty"`
+	PathType string         `json:"pathType"`
+	Backend  IngressBackend `json:"backend"`
 }
 
-type KubernetesPodInfo struct {
-	Status     string
-	Endpoints  []string
-	Ports      []*KubePort
-	Containers []*ContainerInfo
+//IngressBackend is where the requests are routed to
+type IngressBackend struct {
+	Service *IngressServiceBackend `json:"service,omitempty"`
 }
 
-type KubePort struct {
-	Port     int
-	Protocol string
+//IngressServiceBackend is a port of a service, by number or by name
+type IngressServiceBackend struct {
+	Name string             `json:"name"`
+	Port ServiceBackendPort `json:"port"`
 }
 
-//KubernetesDeployInfoResponse struct to give information to the caller about the status
-//TODO: status must be somehow an aggregate of what is appening of the containers?
-type KubernetesDeployInfoResponse struct {
-	Name      string
-	Status    string //If not all of the pods/containers are running, we ruturn a "pending" state, "done" otherwise
-	Instances int    //TODO remove this field as it can be easily inferred
-	Env       map[string]string
-	Labels    map[string]string
-	Replicas  []*KubernetesPodInfo
+//ServiceBackendPort is a port of a service, either Name or Number is set
+type ServiceBackendPort struct {
+	Name   string `json:"name,omitempty"`
+	Number int    `json:"number,omitempty"`
 }
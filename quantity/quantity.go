@@ -0,0 +1,96 @@
+//Package quantity parses the resource quantities of the deploy requests, in the format used by Kubernetes:
+//a decimal number followed by an optional suffix, p.e. "500m", "1.5", "512Mi", "2Gi" or "10G".
+//It is shared by client and server, so that a malformed quantity is reported before sending a request.
+package quantity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//MiB is the number of bytes in a mebibyte, the unit of memory and disk used by the backends
+const MiB = 1 << 20
+
+//multipliers of the supported suffixes. MB and GB are accepted for compatibility with the older
+//definitions and read as Mi and Gi, since the backends always meant mebibytes.
+var multipliers = map[string]float64{
+	"m":  1e-3,
+	"k":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+//Parse parses a quantity and returns its value in base units, p.e. cores or bytes
+func Parse(quantity string) (float64, error) {
+	number, suffix := split(strings.TrimSpace(quantity))
+	if number == "" {
+		return 0, fmt.Errorf("invalid quantity %q: a number is expected", quantity)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q: %s is not a number", quantity, number)
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("invalid quantity %q: it cannot be negative", quantity)
+	}
+	if suffix == "" {
+		return value, nil
+	}
+	multiplier, ok := multipliers[suffix]
+	if !ok {
+		return 0, fmt.Errorf("invalid quantity %q: unknown suffix %s", quantity, suffix)
+	}
+	return value * multiplier, nil
+}
+
+//ParseCPU parses a number of CPUs, fractions are expressed as decimals ("0.25") or millicores ("250m").
+//An empty quantity is 0, which lets the backend decide.
+func ParseCPU(quantity string) (float64, error) {
+	if quantity == "" {
+		return 0, nil
+	}
+	_, suffix := split(strings.TrimSpace(quantity))
+	if suffix != "" && suffix != "m" {
+		return 0, fmt.Errorf("invalid CPU quantity %q: only the suffix m (millicores) is allowed", quantity)
+	}
+	return Parse(quantity)
+}
+
+//ParseMebibytes parses an amount of memory or disk and returns it in mebibytes. A number without suffix
+//is read as mebibytes, like in the older definitions. An empty quantity is 0, which lets the backend decide.
+func ParseMebibytes(quantity string) (float64, error) {
+	if quantity == "" {
+		return 0, nil
+	}
+	_, suffix := split(strings.TrimSpace(quantity))
+	if suffix == "" {
+		return Parse(quantity)
+	}
+	if suffix == "m" {
+		return 0, fmt.Errorf("invalid quantity %q: fractions of bytes are not allowed", quantity)
+	}
+	bytes, err := Parse(quantity)
+	if err != nil {
+		return 0, err
+	}
+	return bytes / MiB, nil
+}
+
+//split splits a quantity into its number and its suffix
+func split(quantity string) (string, string) {
+	end := strings.IndexFunc(quantity, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if end < 0 {
+		return quantity, ""
+	}
+	return quantity[:end], quantity[end:]
+}
@@ -0,0 +1,38 @@
+package quantity
+
+import "testing"
+
+func TestParseCPU(t *testing.T) {
+	cases := map[string]float64{"": 0, "1": 1, "1.5": 1.5, "0.25": 0.25, "500m": 0.5, " 2 ": 2}
+	for quantity, expected := range cases {
+		cpus, err := ParseCPU(quantity)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", quantity, err)
+		} else if cpus != expected {
+			t.Errorf("%q: expected %v, got %v", quantity, expected, cpus)
+		}
+	}
+	for _, quantity := range []string{"abc", "1Gi", "-1", "1..5", "m"} {
+		if _, err := ParseCPU(quantity); err == nil {
+			t.Errorf("%q should be invalid", quantity)
+		}
+	}
+}
+
+func TestParseMebibytes(t *testing.T) {
+	cases := map[string]float64{"": 0, "2048": 2048, "2048MB": 2048, "2GB": 2048, "512Mi": 512, "2Gi": 2048,
+		"1.5Gi": 1536, "1024Ki": 1, "10G": 1e10 / MiB}
+	for quantity, expected := range cases {
+		mebibytes, err := ParseMebibytes(quantity)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", quantity, err)
+		} else if mebibytes != expected {
+			t.Errorf("%q: expected %v, got %v", quantity, expected, mebibytes)
+		}
+	}
+	for _, quantity := range []string{"Gi", "12XB", "500m", "-1Gi", "1.2.3Mi"} {
+		if _, err := ParseMebibytes(quantity); err == nil {
+			t.Errorf("%q should be invalid", quantity)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+//Package secrets resolves the secret references used in the env of the apps, like secret://TEAM/NAME.
+//A secret belongs to a team and can be used only by the apps of that team.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/chimp/conf"
+)
+
+//Scheme is the prefix of the env values referencing a secret
+const Scheme = "secret://"
+
+//Store reads the value of the secrets
+type Store interface {
+	//Get returns the value of the secret name of team
+	Get(team, name string) (string, error)
+}
+
+//AccessError is returned when a team uses a secret of another team
+type AccessError struct {
+	Reference string
+	Team      string
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("team %q cannot access secret %s", e.Team, e.Reference)
+}
+
+//New creates the store configured for the server, nil if there is none
+func New(config conf.Secrets) (Store, error) {
+	switch config.Store {
+	case "":
+		return nil, nil
+	case "file":
+		return NewFileStore(config.Dir)
+	default:
+		return nil, fmt.Errorf("unknown secret store %s", config.Store)
+	}
+}
+
+//IsReference returns true if the value references a secret
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+//ParseReference splits a reference into the team owning the secret and its name
+func ParseReference(reference string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(reference, Scheme), "/", 2)
+	if !IsReference(reference) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid secret reference %s, expected %sTEAM/NAME", reference, Scheme)
+	}
+	for _, element := range strings.Split(parts[1], "/") {
+		if element == "" || element == "." || element == ".." {
+			return "", "", fmt.Errorf("invalid secret reference %s", reference)
+		}
+	}
+	return parts[0], parts[1], nil
+}
+
+//Resolve returns the value of a referenced secret. If checkTeam is set, the secret must belong to team.
+func Resolve(store Store, reference string, team string, checkTeam bool) (string, error) {
+	owner, name, err := ParseReference(reference)
+	if err != nil {
+		return "", err
+	}
+	if checkTeam && owner != team {
+		return "", &AccessError{Reference: reference, Team: team}
+	}
+	if store == nil {
+		return "", errors.New("no secret store is configured")
+	}
+	return store.Get(owner, name)
+}
+
+//FileStore reads every secret from a file, Dir/TEAM/NAME
+type FileStore struct {
+	Dir string
+}
+
+//NewFileStore creates a store reading the secrets from the given directory
+func NewFileStore(dir string) (*FileStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("secret store %s is not a directory", dir)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+//Get returns the content of the secret file, without the final newline
+func (fs *FileStore) Get(team, name string) (string, error) {
+	if team == "" || strings.Contains(team, "/") || team == "." || team == ".." {
+		return "", fmt.Errorf("invalid team %q", team)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(fs.Dir, team, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("secret %s of team %s not found", name, team)
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
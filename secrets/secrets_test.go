@@ -0,0 +1,59 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zalando/chimp/conf"
+)
+
+func TestParseReference(t *testing.T) {
+	team, name, err := ParseReference("secret://cats/db/password")
+	if err != nil || team != "cats" || name != "db/password" {
+		t.Fatalf("unexpected reference %s %s, error %v", team, name, err)
+	}
+	for _, invalid := range []string{"cats/db", "secret://cats", "secret:///db", "secret://cats/../dogs/db", "secret://cats/db//x"} {
+		if _, _, err := ParseReference(invalid); err == nil {
+			t.Errorf("%s should be invalid", invalid)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.MkdirAll(filepath.Join(dir, "cats"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "cats", "db"), []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := New(conf.Secrets{Store: "file", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := Resolve(store, "secret://cats/db", "cats", true)
+	if err != nil || value != "s3cr3t" {
+		t.Fatalf("unexpected secret %q, error %v", value, err)
+	}
+	if _, err = Resolve(store, "secret://cats/db", "dogs", true); err == nil {
+		t.Fatal("team dogs should not access the secrets of cats")
+	} else if _, ok := err.(*AccessError); !ok {
+		t.Fatalf("expected an access error, got %s", err)
+	}
+	if value, err = Resolve(store, "secret://cats/db", "", false); err != nil || value != "s3cr3t" {
+		t.Fatalf("without team check the secret should be resolved, got %q, error %v", value, err)
+	}
+	if _, err = Resolve(store, "secret://cats/missing", "cats", true); err == nil {
+		t.Fatal("a missing secret should be an error")
+	}
+	if _, err = Resolve(nil, "secret://cats/db", "cats", true); err == nil {
+		t.Fatal("without store the secret cannot be resolved")
+	}
+}
@@ -1,5 +1,10 @@
 package types
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 //CreateRequest is the request of deployment
 type CreateRequest struct {
 	BaseRequest
@@ -12,16 +17,30 @@ type UpdateRequest struct {
 
 //BaseRequest represents common data among create/update request
 type BaseRequest struct {
-	Name        string            // "shop"
-	Ports       []int             // [8080]
-	Labels      map[string]string // ["env": "live", "instance": "shop"]
-	ImageURL    string
-	Env         map[string]string // {"FOO": "bar", ..}
-	Replicas    int               // 4, creates 4 given container
-	CPULimit    int
-	MemoryLimit int
-	Force       bool
-	Volumes     []*Volume
+	Name           string            `json:"name"`   // "shop"
+	Ports          []Port            `json:"ports"`  // [{ContainerPort: 8080, Protocol: "tcp"}]
+	Labels         map[string]string `json:"labels"` // ["env": "live", "instance": "shop"]
+	ImageURL       string            `json:"imageURL"`
+	Env            map[string]string `json:"env"`         // {"FOO": "bar", ..}
+	Replicas       int               `json:"replicas"`    // 4, creates 4 given container
+	CPULimit       float64           `json:"cpuLimit"`    //number of CPUs, 0 lets the backend decide
+	MemoryLimit    float64           `json:"memoryLimit"` //MiB
+	DiskLimit      float64           `json:"diskLimit"`   //MiB
+	Force          bool              `json:"force"`
+	Volumes        []*Volume         `json:"volumes"`
+	HealthChecks   []*HealthCheck    `json:"healthChecks"`
+	UpdateStrategy *UpdateStrategy   `json:"updateStrategy"`
+	Dependencies   []string          `json:"dependencies"` //names of the apps of the same group that have to be deployed first
+	Constraints    []*Constraint     `json:"constraints"`
+	Host           string            `json:"host"` //host name of the app, instead of the one from the EndpointPattern of chimp-server
+	Caller         Caller            `json:"-"`
+}
+
+//Caller identifies who sends a request to the backend. Team is empty if authentication is disabled,
+//Admin is true for the teams allowed to manage the apps of every team.
+type Caller struct {
+	Team  string
+	Admin bool
 }
 
 // Actions on Artifacts
@@ -30,6 +49,7 @@ const (
 	LIST
 	INFO
 	DELETE
+	VERSIONS
 )
 
 //ArtifactRequest request about exactly one deploy artifact
@@ -37,14 +57,18 @@ type ArtifactRequest struct {
 	Action int // DELETE, MONITOR, ..
 	Name   string
 	Labels map[string]string // ["env": "live", "instance": "shop"]
+	Caller Caller
 }
 
 //Replica describes the status of an instance of the app
 type Replica struct {
-	Status     string       `json:"status"`
-	Endpoints  []string     `json:"endpoints"`
-	Ports      []*PortType  `json:"ports"`
-	Containers []*Container `json:"containers"`
+	ID           string               `json:"id"`
+	Status       string               `json:"status"`
+	Endpoints    []string             `json:"endpoints"`
+	Ports        []*PortType          `json:"ports"`
+	Containers   []*Container         `json:"containers"`
+	HealthChecks []*HealthCheckResult `json:"healthChecks"`
+	Warnings     []string             `json:"warnings"` //problems met while getting the information of the replica
 }
 
 //Artifact is used to  retrieve information on an app
@@ -58,7 +82,16 @@ type Artifact struct {
 	RequestedReplicas int                `json:"requestedReplicas"`
 	CPUS              float64            `json:"cpus"`
 	Memory            float64            `json:"memory"`
+	Disk              float64            `json:"disk"`
 	Endpoint          string             `json:"endpoint"`
+	HealthChecks      []*HealthCheck     `json:"healthChecks"`
+	Dependencies      []string           `json:"dependencies"`
+	Constraints       []*Constraint      `json:"constraints"`
+	Host              string             `json:"host"`
+	ImageURL          string             `json:"imageURL"`
+	Ports             []Port             `json:"ports"`
+	Volumes           []*Volume          `json:"volumes"`
+	UpdateStrategy    *UpdateStrategy    `json:"updateStrategy"`
 }
 
 //PortType represents the port and protocol used
@@ -67,6 +100,60 @@ type PortType struct {
 	Protocol string `json:"protocol"`
 }
 
+//Quantity is an amount of a resource, p.e. "0.5" CPUs or "512Mi" of memory, see the quantity package.
+//It can be given as a JSON string or number.
+type Quantity string
+
+//UnmarshalJSON reads a quantity from a string or from a number
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		*q = Quantity(number)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*q = Quantity(str)
+	return nil
+}
+
+//Port protocols
+const (
+	PortProtocolTCP = "tcp"
+	PortProtocolUDP = "udp"
+)
+
+//Port is a port exposed by the container of an app. A plain number is read as a TCP container port,
+//so that the definitions listing ports as integers keep working.
+type Port struct {
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"` //tcp (default) or udp
+	Name          string `json:"name"`
+	HostPort      int    `json:"hostPort"`    //0 lets the backend pick a random port
+	ServicePort   int    `json:"servicePort"` //0 lets the backend pick one, where supported
+}
+
+//UnmarshalJSON reads a port from a number or from an object
+func (p *Port) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*p = Port{ContainerPort: number}
+		return nil
+	}
+	type plainPort Port //without the UnmarshalJSON method
+	return json.Unmarshal(data, (*plainPort)(p))
+}
+
+//ProtocolOrDefault returns the protocol of the port in lower case, TCP if not set
+func (p *Port) ProtocolOrDefault() string {
+	if p.Protocol == "" {
+		return PortProtocolTCP
+	}
+	return strings.ToLower(p.Protocol)
+}
+
 //Container represents the information of the particular container of a replica.
 //Currently we suppose that one replica has exactly one container which is not true when mapping kubernetes,
 //see pod -> containers mappings.
@@ -75,9 +162,38 @@ type Container struct {
 	Ports    []*PortType       `json:"ports"`
 	Status   string            `json:"status"`
 	LogInfo  map[string]string `json:"loginfo"`
+	LogLinks []*LogLink        `json:"logLinks"`
 	Volumes  []*Volume         `json:"volumes"`
 }
 
+//LogLink is a link to the logs of a container in a log management system
+type LogLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+//Actions of the changes found by a dry run
+const (
+	DiffAdded   = "ADDED"
+	DiffRemoved = "REMOVED"
+	DiffChanged = "CHANGED"
+)
+
+//FieldChange is the change of a setting of an app, p.e. "env.FOO" or "imageURL". Values are JSON.
+type FieldChange struct {
+	Field     string `json:"field"`
+	Action    string `json:"action"`
+	Current   string `json:"current"`
+	Requested string `json:"requested"`
+}
+
+//DiffResult is the result of a dry run: the changes that the request would make to the app
+type DiffResult struct {
+	Name    string         `json:"name"`
+	Exists  bool           `json:"exists"` //false if the app is not deployed yet, then every setting is added
+	Changes []*FieldChange `json:"changes"`
+}
+
 //ListDeployments is a list of names of apps currently deployed
 type ListDeployments struct {
 	Deployments []string `json:"deployments"`
@@ -88,6 +204,114 @@ type ScaleRequest struct {
 	Name     string
 	Replicas int
 	Force    bool
+	Caller   Caller
+}
+
+//DeploymentResult is the response to the requests that start a deployment in the backend
+type DeploymentResult struct {
+	Name         string `json:"name"`
+	DeploymentID string `json:"deploymentID"`
+}
+
+//RolloutRequest is a request about the deployments in progress for an app.
+//If DeploymentID is set, only that deployment is considered.
+type RolloutRequest struct {
+	Name         string
+	DeploymentID string
+	Caller       Caller
+}
+
+//Status of a rollout
+const (
+	RolloutInProgress = "IN_PROGRESS"
+	RolloutDone       = "DONE"
+	RolloutFailed     = "FAILED"
+)
+
+//Rollout describes the progress of the deployments of an app
+type Rollout struct {
+	Name        string               `json:"name"`
+	Status      string               `json:"status"`  //IN_PROGRESS, DONE or FAILED
+	Message     string               `json:"message"` //last failure, if any
+	Deployments []*RolloutDeployment `json:"deployments"`
+}
+
+//RolloutDeployment is a deployment in progress in the backend
+type RolloutDeployment struct {
+	ID             string   `json:"id"`
+	Version        string   `json:"version"`
+	CurrentStep    int      `json:"currentStep"`
+	TotalSteps     int      `json:"totalSteps"`
+	CurrentActions []string `json:"currentActions"`
+}
+
+//Types of events
+const (
+	EventStatusUpdate         = "STATUS_UPDATE"          //a replica changed status, p.e. TASK_RUNNING or TASK_FAILED
+	EventHealthChanged        = "HEALTH_CHANGED"         //a replica became alive or not alive
+	EventHealthCheckFailed    = "HEALTH_CHECK_FAILED"    //a health check failed for a replica
+	EventAppTerminated        = "APP_TERMINATED"         //the app was deleted
+	EventDeploymentStep       = "DEPLOYMENT_STEP"        //a deployment step of the app completed
+	EventDeploymentStepFailed = "DEPLOYMENT_STEP_FAILED" //a deployment step of the app failed
+)
+
+//Event is something that happened to an app in the backend
+type Event struct {
+	Type      string `json:"type"`
+	App       string `json:"app"`
+	ReplicaID string `json:"replicaID"`
+	Host      string `json:"host"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+}
+
+//KillRequest is the request to kill the replicas of an app. If ReplicaID is empty all the replicas are killed.
+//Unless Scale is set the backend replaces the killed replicas.
+type KillRequest struct {
+	Name      string
+	ReplicaID string
+	Scale     bool
+	Caller    Caller
+}
+
+//KillResult lists the replicas killed by a KillRequest
+type KillResult struct {
+	Name     string   `json:"name"`
+	Replicas []string `json:"replicas"`
+}
+
+//CancelRequest is the request to cancel the deployments in progress for an app.
+//Unless Force is set, the backend rolls the app back to the state before each deployment.
+type CancelRequest struct {
+	Name   string
+	Force  bool
+	Caller Caller
+}
+
+//CancelledDeployment describes a deployment cancelled by a CancelRequest
+type CancelledDeployment struct {
+	ID         string `json:"id"`
+	Version    string `json:"version"`
+	RollbackID string `json:"rollbackID"` //the deployment rolling back the app, empty if forced
+}
+
+//CancelResult lists the deployments cancelled by a CancelRequest
+type CancelResult struct {
+	Name        string                 `json:"name"`
+	Deployments []*CancelledDeployment `json:"deployments"`
+}
+
+//RollbackRequest is a request for rolling back an app to one of its previous versions
+type RollbackRequest struct {
+	Name    string
+	Version string //if empty, the version before the current one is used
+	Caller  Caller
+}
+
+//ListVersions is a list of the versions of an app, the most recent first
+type ListVersions struct {
+	Versions []string `json:"versions"`
 }
 
 //Volume represent a volume that can be mounted in an app
@@ -98,24 +322,82 @@ type Volume struct {
 	Mode          string `json:"mode"`
 }
 
+//Protocols supported by health checks
+const (
+	HealthCheckHTTP    = "HTTP"
+	HealthCheckTCP     = "TCP"
+	HealthCheckCommand = "COMMAND"
+)
+
+//HealthCheck describes how the backend checks that a replica of an app is healthy
+type HealthCheck struct {
+	Protocol               string `json:"protocol"` // HTTP, TCP or COMMAND
+	Path                   string `json:"path"`     // only for HTTP, p.e. "/health"
+	Command                string `json:"command"`  // only for COMMAND, the command run inside the container
+	PortIndex              int    `json:"portIndex"`
+	IntervalSeconds        int    `json:"intervalSeconds"`
+	GracePeriodSeconds     int    `json:"gracePeriodSeconds"`
+	MaxConsecutiveFailures int    `json:"maxConsecutiveFailures"`
+}
+
+//HealthCheckResult is the last known result of a health check for one replica.
+//Results are in the same order as the health checks of the app.
+type HealthCheckResult struct {
+	Alive               bool   `json:"alive"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastSuccess         string `json:"lastSuccess"`
+	LastFailure         string `json:"lastFailure"`
+}
+
+//UpdateStrategy controls how the replicas of an app are replaced during an update.
+//Both values are fractions of the requested replicas between 0.0 and 1.0; the backend default is used for a value not set.
+type UpdateStrategy struct {
+	MinimumHealthyCapacity *float64 `json:"minimumHealthyCapacity,omitempty"` //replicas that must stay healthy during the update
+	MaximumOverCapacity    *float64 `json:"maximumOverCapacity,omitempty"`    //replicas that can be started on top of the requested ones
+}
+
+//Operators of the placement constraints
+const (
+	ConstraintUnique  = "UNIQUE"   //every replica on a different value of the field, p.e. one per host
+	ConstraintCluster = "CLUSTER"  //every replica on the given value of the field
+	ConstraintGroupBy = "GROUP_BY" //replicas spread evenly among the values of the field, optionally how many
+	ConstraintLike    = "LIKE"     //only where the field matches the regular expression in value
+	ConstraintUnlike  = "UNLIKE"   //only where the field does not match the regular expression in value
+)
+
+//Constraint restricts where the replicas of an app are placed. Field is "hostname" or an attribute of the nodes,
+//p.e. "zone".
+type Constraint struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
 //ChimpDefinition is a general definition for an application.
 //A chimp definition can contain several deploy requests.
 type ChimpDefinition struct {
+	Group         string //if set, the deploy requests are deployed atomically as a group with this name
 	DeployRequest []CmdClientRequest
 }
 
 //CmdClientRequest is a request to deploy an application
 type CmdClientRequest struct {
-	Name        string
-	ImageURL    string
-	Replicas    int
-	Ports       []int
-	Labels      map[string]string
-	Env         map[string]string
-	CPULimit    int
-	MemoryLimit string
-	Force       bool
-	Volumes     []*Volume
+	Name           string
+	ImageURL       string
+	Replicas       int
+	Ports          []Port
+	Labels         map[string]string
+	Env            map[string]string
+	CPULimit       Quantity
+	MemoryLimit    Quantity
+	DiskLimit      Quantity
+	Force          bool
+	Volumes        []*Volume
+	HealthChecks   []*HealthCheck
+	UpdateStrategy *UpdateStrategy
+	Dependencies   []string
+	Constraints    []*Constraint
+	Host           string
 }
 
 //Error is a small struct for an error type
@@ -125,14 +407,52 @@ type Error struct {
 
 //DeployRequest is the struct used to represent a request to deploy
 type DeployRequest struct {
-	Name        string            // "shop"
-	Labels      map[string]string // {"env": "live", "project": "shop"}
-	Env         map[string]string // {"FOO": "bar", ..}
-	Replicas    int               // 4, creates 4 given container
-	Ports       []int
-	ImageURL    string
-	CPULimit    int
-	MemoryLimit string
-	Force       bool
-	Volumes     []*Volume
+	Name           string            `json:"name"`     // "shop"
+	Labels         map[string]string `json:"labels"`   // {"env": "live", "project": "shop"}
+	Env            map[string]string `json:"env"`      // {"FOO": "bar", ..}
+	Replicas       int               `json:"replicas"` // 4, creates 4 given container
+	Ports          []Port            `json:"ports"`
+	ImageURL       string            `json:"imageURL"`
+	CPULimit       Quantity          `json:"cpuLimit"`
+	MemoryLimit    Quantity          `json:"memoryLimit"`
+	DiskLimit      Quantity          `json:"diskLimit"`
+	Force          bool              `json:"force"`
+	Volumes        []*Volume         `json:"volumes"`
+	HealthChecks   []*HealthCheck    `json:"healthChecks"`
+	UpdateStrategy *UpdateStrategy   `json:"updateStrategy"`
+	Dependencies   []string          `json:"dependencies"`
+	Constraints    []*Constraint     `json:"constraints"`
+	Host           string            `json:"host"`
+}
+
+//GroupDeployRequest is the request to deploy several apps atomically as a group
+type GroupDeployRequest struct {
+	Name string
+	Apps []DeployRequest
+}
+
+//GroupRequest is the request of a group deployment sent to the backend
+type GroupRequest struct {
+	Name string
+	Apps []*BaseRequest
+}
+
+//GroupArtifact is used to retrieve information on a group of apps
+type GroupArtifact struct {
+	Name string      `json:"name"`
+	Apps []*Artifact `json:"apps"`
+}
+
+//BackendInfo describes the backend chimp-server is connected to
+type BackendInfo struct {
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Leader    string            `json:"leader"`
+	Endpoints []*EndpointStatus `json:"endpoints"`
+}
+
+//EndpointStatus tells if one of the configured endpoints of the backend is reachable
+type EndpointStatus struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
 }